@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/ForceCLI/force/config"
 	. "github.com/ForceCLI/force/error"
 	. "github.com/ForceCLI/force/lib"
 )
@@ -47,10 +48,19 @@ var cmdAura = &Command{
 
 	force aura create -t=<entity type> <entityName>
 
+	force aura create -t component -controller -helper -style MyCmp
+
 	force aura delete -f=<fullFilePath>
 
 	force aura list
 
+	Create creates the bundle in the org and writes its files, along with
+	the .manifest used by push, to "aura/<entityName>" in the source
+	directory. The entity type is one of application, component, event,
+	interface or tokens. Components and applications can include a
+	controller (-controller), helper (-helper), renderer (-renderer) and
+	style (-style); components can also include a design (-design).
+
 	`,
 }
 
@@ -62,11 +72,17 @@ func init() {
 	cmdAura.Flag.StringVar(&auraentityname, "entityname", "", "fully qualified file name for entity")
 	cmdAura.Flag.StringVar(&metadataType, "t", "", "fully qualified file name for entity")
 	cmdAura.Flag.StringVar(&auraentityname, "n", "", "fully qualified file name for entity")
+	cmdAura.Flag.BoolVar(&auraParts.Controller, "controller", false, "include a controller")
+	cmdAura.Flag.BoolVar(&auraParts.Helper, "helper", false, "include a helper")
+	cmdAura.Flag.BoolVar(&auraParts.Renderer, "renderer", false, "include a renderer")
+	cmdAura.Flag.BoolVar(&auraParts.Style, "style", false, "include a style")
+	cmdAura.Flag.BoolVar(&auraParts.Design, "design", false, "include a design")
 }
 
 var (
 	auraentityname string
 	metadataType   string
+	auraParts      AuraBundleParts
 )
 
 func runAura(cmd *Command, args []string) {
@@ -94,11 +110,13 @@ func runAura(cmd *Command, args []string) {
 
 	switch strings.ToLower(subcommand) {
 	case "create":
-		/*if *auraentitytype == "" || *auraentityname == "" {
-			fmt.Println("Must specify entity type and name")
-			os.Exit(2)
-		}*/
-		ErrorAndExit("force aura create not yet implemented")
+		if auraentityname == "" {
+			auraentityname = cmd.Flag.Arg(0)
+		}
+		if metadataType == "" || auraentityname == "" {
+			ErrorAndExit("Must specify entity type and name")
+		}
+		runCreateAura(force, metadataType, auraentityname)
 
 	case "delete":
 		runDeleteAura()
@@ -116,6 +134,49 @@ func runAura(cmd *Command, args []string) {
 	}
 }
 
+func runCreateAura(force *Force, entityType string, name string) {
+	files, err := NewAuraBundleFiles(entityType, name, auraParts)
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	root, err := config.GetSourceDir()
+	ExitIfNoSourceDir(err)
+	bundleDir := filepath.Join(root, "aura", name)
+	if _, err := os.Stat(bundleDir); err == nil {
+		ErrorAndExit("%s already exists", bundleDir)
+	}
+
+	bundle, err, _ := force.CreateAuraBundle(name)
+	if err != nil {
+		ErrorAndExit("Failed to create bundle %s: %s", name, err.Error())
+	}
+	if err := os.MkdirAll(bundleDir, 0755); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	manifest := BundleManifest{Name: name, Id: bundle.Id}
+	for _, file := range files {
+		fileName := filepath.Join(bundleDir, file.FileName)
+		component, err, _ := force.CreateAuraComponent(map[string]string{
+			"AuraDefinitionBundleId": bundle.Id,
+			"DefType":                file.DefType,
+			"Format":                 file.Format,
+			"Source":                 file.Source,
+		})
+		if err != nil {
+			ErrorAndExit("Failed to create %s: %s", file.FileName, err.Error())
+		}
+		if err := ioutil.WriteFile(fileName, []byte(file.Source), 0644); err != nil {
+			ErrorAndExit(err.Error())
+		}
+		manifest.Files = append(manifest.Files, ComponentFile{FileName: fileName, ComponentId: component.Id})
+		// Keep the manifest current so that push works even if a later
+		// definition fails
+		bmBody, _ := json.Marshal(manifest)
+		ioutil.WriteFile(filepath.Join(bundleDir, ".manifest"), bmBody, 0644)
+	}
+	fmt.Printf("Created %s %s in %s\n", strings.ToLower(entityType), name, bundleDir)
+}
+
 func runDeleteAura() {
 	absPath, _ := filepath.Abs(resourcepaths[0])
 	//resourcepaths = absPath
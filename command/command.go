@@ -13,20 +13,29 @@ var Commands = []*Command{
 	cmdAura,
 	cmdBigObject,
 	cmdBulk,
+	cmdCompare,
+	cmdConfig,
+	cmdCoverage,
 	cmdCreate,
 	cmdDataPipe,
+	cmdDelete,
 	cmdDescribe,
+	cmdDiff,
 	cmdEventLogFile,
 	cmdExport,
 	cmdFetch,
 	cmdField,
 	cmdHelp,
+	helpForceIgnore,
+	helpProject,
 	cmdImport,
 	cmdLimits,
 	cmdLog,
 	cmdLogin,
 	cmdLogins,
 	cmdLogout,
+	cmdManifest,
+	cmdNormalize,
 	cmdNotifySet,
 	cmdOauth,
 	cmdOpen,
@@ -37,6 +46,7 @@ var Commands = []*Command{
 	cmdQuickDeploy,
 	cmdRecord,
 	cmdRest,
+	cmdRollback,
 	cmdSecurity,
 	cmdSobject,
 	cmdTest,
@@ -79,3 +89,15 @@ func (c *Command) Runnable() bool {
 func (c *Command) List() bool {
 	return c.Short != ""
 }
+
+// Returns whether any of the named flags was given on the command line.
+func flagSet(cmd *Command, names ...string) (set bool) {
+	cmd.Flag.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				set = true
+			}
+		}
+	})
+	return
+}
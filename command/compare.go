@@ -0,0 +1,153 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ForceCLI/force/config"
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+)
+
+var cmdCompare = &Command{
+	Run:   runCompare,
+	Usage: "compare -source <login> -target <login> [-x package.xml] [-d directory] [-diff]",
+	Short: "Compare the metadata of two orgs",
+	Long: `
+Compare the metadata of two orgs
+
+Retrieves the same package from two saved logins and reports the members that
+were added, removed or modified in the source compared to the target. It
+also writes a package to the output directory that would bring the target in
+line with the source: the added and modified members with a package.xml, and
+a destructiveChanges.xml listing the removed members. Deploy it with
+force import -d <directory>, logged in to the target.
+
+Without -x, the package contains the metadata in the local source
+directories.
+
+Options
+  -source, -s     Login to compare from, e.g. a sandbox
+  -target, -t     Login to compare to, e.g. production
+  -xml, -x        Package.xml of the metadata to compare
+  -directory, -d  Directory to write the deployable package to (default compare)
+  -diff           Show the differences in each file
+
+Examples:
+
+  force compare -s me@example.com.dev -t me@example.com
+
+  force compare -s me@example.com.dev -t me@example.com -x package.xml -d release
+`,
+}
+
+var (
+	compareSource    string
+	compareTarget    string
+	comparePackage   string
+	compareDirectory string
+	compareShowDiff  bool
+)
+
+func init() {
+	cmdCompare.Flag.StringVar(&compareSource, "source", "", "source login")
+	cmdCompare.Flag.StringVar(&compareSource, "s", "", "source login")
+	cmdCompare.Flag.StringVar(&compareTarget, "target", "", "target login")
+	cmdCompare.Flag.StringVar(&compareTarget, "t", "", "target login")
+	cmdCompare.Flag.StringVar(&comparePackage, "xml", "", "package.xml of metadata to compare")
+	cmdCompare.Flag.StringVar(&comparePackage, "x", "", "package.xml of metadata to compare")
+	cmdCompare.Flag.StringVar(&compareDirectory, "directory", "compare", "output directory")
+	cmdCompare.Flag.StringVar(&compareDirectory, "d", "compare", "output directory")
+	cmdCompare.Flag.BoolVar(&compareShowDiff, "diff", false, "show file differences")
+}
+
+func runCompare(cmd *Command, args []string) {
+	if compareSource == "" || compareTarget == "" {
+		ErrorAndExit("Both -source and -target are required")
+	}
+	if _, err := os.Stat(compareDirectory); err == nil {
+		ErrorAndExit("%s already exists", compareDirectory)
+	}
+
+	var query ForceMetadataQuery
+	if comparePackage == "" {
+		roots, err := config.SourceDirs()
+		ExitIfNoSourceDir(err)
+		_, query = localMetadataFiles(roots)
+		if len(query) == 0 {
+			ErrorAndExit("Nothing to compare")
+		}
+	}
+
+	source := retrieveForCompare(compareSource, query)
+	target := retrieveForCompare(compareTarget, query)
+
+	comparison := CompareMetadataMembers(target, source)
+	if compareShowDiff {
+		diff := CompareMetadataFiles(target, source)
+		for _, names := range [][]string{diff.Added, diff.Removed, diff.Modified} {
+			for _, name := range names {
+				fmt.Print(MetadataFileDiff(name, target, source, compareTarget+"/", compareSource+"/"))
+			}
+		}
+	}
+	printComparison(comparison)
+	if comparison.Empty() {
+		return
+	}
+
+	for name, data := range comparison.DeployFiles(source) {
+		file := filepath.Join(compareDirectory, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			ErrorAndExit(err.Error())
+		}
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			ErrorAndExit(err.Error())
+		}
+	}
+	fmt.Printf("\nWrote package to %s; deploy it to %s with force import -d %s\n", compareDirectory, compareTarget, compareDirectory)
+}
+
+// Retrieve the package given by -x, or query, from the saved login.
+func retrieveForCompare(login string, query ForceMetadataQuery) (files ForceMetadataFiles) {
+	force, err := GetForce(login)
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	fmt.Printf("Retrieving from %s...\n", login)
+	var problems []string
+	if comparePackage != "" {
+		files, problems, err = force.Metadata.RetrieveByPackageXml(comparePackage)
+	} else {
+		files, problems, err = force.Metadata.Retrieve(query)
+	}
+	if err != nil {
+		ErrorAndExit("Could not retrieve from %s: %s", login, err.Error())
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", login, problem)
+	}
+	return
+}
+
+func printComparison(comparison MetadataComparison) {
+	if comparison.Empty() {
+		fmt.Println("No differences")
+		return
+	}
+	printMembers := func(heading string, members []MetadataMember) {
+		if len(members) == 0 {
+			return
+		}
+		fmt.Println(heading)
+		for _, member := range members {
+			fmt.Printf("  %s: %s\n", member.Type, member.Name)
+		}
+	}
+	printMembers(fmt.Sprintf("Added (only in %s):", compareSource), comparison.Added)
+	printMembers(fmt.Sprintf("Removed (only in %s):", compareTarget), comparison.Removed)
+	printMembers("Modified:", comparison.Modified)
+	fmt.Printf("%d added, %d removed, %d modified\n", len(comparison.Added), len(comparison.Removed), len(comparison.Modified))
+}
@@ -0,0 +1,268 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ForceCLI/force/config"
+	"github.com/ForceCLI/force/desktop"
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+)
+
+var cmdConfig = &Command{
+	Run:   runConfig,
+	Usage: "config (list | get <key> | set <key> <value>) [-global]",
+	Short: "Manage project and global settings",
+	Long: `
+Manage project and global settings
+
+Project settings are stored in .force/config.json in the project directory,
+which is found by looking in the current directory and its parents. They
+provide defaults for commands run within the project; flags given on the
+command line take precedence.
+
+Project settings
+  account                   Login to use instead of the active one
+  apiVersion                API version to use instead of the login's
+  sourceDirs                Comma-separated source directories, default first
+  queryFormat               Default output format of force query
+  normalize                 Whether force fetch normalizes the XML it retrieves
+  decomposeObjects          Whether force fetch splits objects into a file per
+                            field, record type, list view, etc., e.g.
+                            objects/Book__c/fields/Title__c.field. Push and
+                            import recompose them; pushing a field's file
+                            deploys just that field
+  deploy.allowMissingFiles  Defaults for the deployment options of force push
+  deploy.autoUpdatePackage  and force import
+  deploy.checkOnly
+  deploy.ignoreWarnings
+  deploy.purgeOnDelete
+  deploy.rollbackOnError
+  deploy.runTests
+  deploy.testLevel
+
+Global settings
+  account                   Active login
+  notifications             Whether to show desktop notifications
+
+Setting a value to "" removes it.
+
+Options
+  -global, -g  Manage global settings instead of project settings
+
+Examples:
+
+  force config list
+
+  force config set account me@example.com
+
+  force config set deploy.testLevel RunLocalTests
+
+  force config set sourceDirs core/src,integrations/src
+
+  force config get apiVersion
+
+  force config set -global notifications true
+`,
+}
+
+var globalConfig bool
+
+type globalSetting struct {
+	get func() string
+	set func(value string) error
+}
+
+var globalSettings = map[string]globalSetting{
+	"account": {
+		get: func() string {
+			account, _ := config.Config.LoadLocalOrGlobal("current", "account")
+			return account
+		},
+		set: func(value string) error {
+			if value == "" {
+				return config.Config.Delete("current", "account")
+			}
+			return SetActiveLogin(value)
+		},
+	},
+	"notifications": {
+		get: func() string {
+			return strconv.FormatBool(desktop.GetShouldNotify())
+		},
+		set: func(value string) error {
+			if value == "" {
+				value = "false"
+			}
+			shouldNotify, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("notifications must be true or false")
+			}
+			desktop.SetShouldNotify(shouldNotify)
+			return nil
+		},
+	},
+}
+
+func init() {
+	cmdConfig.Flag.BoolVar(&globalConfig, "global", false, "manage global settings")
+	cmdConfig.Flag.BoolVar(&globalConfig, "g", false, "manage global settings")
+}
+
+func runConfig(cmd *Command, args []string) {
+	if len(args) == 0 {
+		cmd.PrintUsage()
+		return
+	}
+	subcommand := args[0]
+	if err := cmd.Flag.Parse(args[1:]); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	args = cmd.Flag.Args()
+
+	switch strings.ToLower(subcommand) {
+	case "list":
+		if globalConfig {
+			listGlobalSettings()
+		} else {
+			listProjectSettings()
+		}
+	case "get":
+		if len(args) != 1 {
+			ErrorAndExit("Usage: force config get <key>")
+		}
+		if globalConfig {
+			fmt.Println(findGlobalSetting(args[0]).get())
+		} else {
+			value, _ := activeProjectConfig().Get(args[0])
+			fmt.Println(value)
+		}
+	case "set":
+		if len(args) != 2 {
+			ErrorAndExit("Usage: force config set <key> <value>")
+		}
+		if globalConfig {
+			if err := findGlobalSetting(args[0]).set(args[1]); err != nil {
+				ErrorAndExit(err.Error())
+			}
+		} else {
+			setProjectSetting(args[0], args[1])
+		}
+	default:
+		ErrorAndExit("Unknown subcommand %s; use list, get or set", subcommand)
+	}
+}
+
+func listProjectSettings() {
+	settings := activeProjectConfig().Settings()
+	for _, key := range config.ProjectSettingKeys() {
+		if value, ok := settings[key]; ok {
+			fmt.Printf("%s=%s\n", key, value)
+		}
+	}
+}
+
+func listGlobalSettings() {
+	var keys []string
+	for key := range globalSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%s=%s\n", key, globalSettings[key].get())
+	}
+}
+
+func findGlobalSetting(key string) globalSetting {
+	setting, found := globalSettings[key]
+	if !found {
+		ErrorAndExit("Unknown global setting %s; valid settings are account, notifications", key)
+	}
+	return setting
+}
+
+// Update the project settings, creating .force/config.json in the project
+// directory if there isn't one.
+func setProjectSetting(key string, value string) {
+	pc, err := config.FindProjectConfig()
+	if err != nil && !os.IsNotExist(err) {
+		ErrorAndExit(err.Error())
+	}
+	if err != nil {
+		dir, err := config.ProjectDir()
+		if err != nil {
+			ErrorAndExit(err.Error())
+		}
+		pc = &config.ProjectConfig{Dir: dir}
+	}
+	if err := pc.Set(key, value); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	if err := pc.Save(); err != nil {
+		ErrorAndExit("Could not save project settings: %s", err.Error())
+	}
+}
+
+func activeProjectConfig() *config.ProjectConfig {
+	pc, err := config.ActiveProjectConfig()
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	return pc
+}
+
+// Apply the project's defaults to the flags of cmd that weren't given on the
+// command line. Settings that can't be read are ignored with a warning, so
+// that they don't keep other commands from running.
+func ApplyProjectConfig(cmd *Command) {
+	switch cmd {
+	case cmdPush, cmdImport, cmdQuery, cmdFetch:
+	default:
+		return
+	}
+	pc, err := config.ActiveProjectConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ignoring project settings: %s\n", err.Error())
+		return
+	}
+	switch cmd {
+	case cmdPush, cmdImport:
+		applyDeployConfig(cmd, pc.Deploy)
+	case cmdQuery:
+		if pc.QueryFormat != "" && !flagSet(cmd, "format", "f") {
+			queryOutputFormat = pc.QueryFormat
+		}
+	case cmdFetch:
+		if pc.Normalize != nil && !flagSet(cmd, "normalize") {
+			fetchNormalize = *pc.Normalize
+		}
+		fetchDecomposeObjects = pc.DecomposeObjects != nil && *pc.DecomposeObjects
+	}
+}
+
+func applyDeployConfig(cmd *Command, deploy *config.DeployConfig) {
+	if deploy == nil {
+		return
+	}
+	applyBool := func(value *bool, flag *bool, names ...string) {
+		if value != nil && !flagSet(cmd, names...) {
+			*flag = *value
+		}
+	}
+	applyBool(deploy.AllowMissingFiles, allowMissingFilesFlag, "allowmissingfiles", "m")
+	applyBool(deploy.AutoUpdatePackage, autoUpdatePackageFlag, "autoupdatepackage", "u")
+	applyBool(deploy.CheckOnly, checkOnlyFlag, "checkonly", "c")
+	applyBool(deploy.IgnoreWarnings, ignoreWarningsFlag, "ignorewarnings", "i")
+	applyBool(deploy.PurgeOnDelete, purgeOnDeleteFlag, "purgeondelete", "p")
+	applyBool(deploy.RollbackOnError, rollBackOnErrorFlag, "rollbackonerror", "r")
+	if deploy.TestLevel != "" && !flagSet(cmd, "testlevel", "testLevel", "l") {
+		*testLevelFlag = deploy.TestLevel
+	}
+	if len(deploy.RunTests) > 0 && !flagSet(cmd, "test") {
+		testsToRun = deploy.RunTests
+	}
+}
@@ -0,0 +1,81 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ForceCLI/force/config"
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+)
+
+var cmdCoverage = &Command{
+	Usage: "coverage [-uncovered-only] <ClassName>",
+	Short: "Show line coverage of an Apex class or trigger",
+	Long: `
+Show the source of an Apex class or trigger with covered lines marked + and
+uncovered lines marked -, using the coverage from the most recent test runs.
+
+The local source is used if it exists; otherwise the source is retrieved
+from the org.
+
+Coverage Options
+  -uncovered-only    Only show uncovered lines
+  -nocolor           Don't color covered and uncovered lines
+
+Examples:
+
+  force coverage MyClass
+  force coverage -uncovered-only MyTrigger
+`,
+}
+
+var (
+	uncoveredOnly   bool
+	noCoverageColor bool
+)
+
+func init() {
+	cmdCoverage.Flag.BoolVar(&uncoveredOnly, "uncovered-only", false, "only show uncovered lines")
+	cmdCoverage.Flag.BoolVar(&noCoverageColor, "nocolor", false, "don't color output")
+	cmdCoverage.Run = runCoverage
+}
+
+func runCoverage(cmd *Command, args []string) {
+	if len(args) != 1 {
+		ErrorAndExit("must specify a class or trigger")
+	}
+	name := args[0]
+	force, _ := ActiveForce()
+	coverage, err := force.GetCodeCoverageAggregate([]string{name})
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	if len(coverage) == 0 {
+		ErrorAndExit("No coverage found for %s; run its tests first", name)
+	}
+	source, err := apexSource(force, coverage[0])
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	err = WriteAnnotatedCoverage(os.Stdout, source, coverage[0], uncoveredOnly, !noCoverageColor)
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+}
+
+// Read the class or trigger from the source directory, falling back to the
+// body stored in the org.
+func apexSource(force *Force, coverage ApexCoverage) (source string, err error) {
+	root, err := config.GetSourceDir()
+	if err == nil {
+		data, readErr := ioutil.ReadFile(filepath.Join(root, coverage.SourcePath()))
+		if readErr == nil {
+			return string(data), nil
+		}
+	}
+	fmt.Fprintf(os.Stderr, "No local source for %s; using source from org\n", coverage.Name)
+	return force.GetApexBody(coverage.Name, coverage.IsTrigger)
+}
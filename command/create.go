@@ -2,17 +2,53 @@ package command
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/ForceCLI/force/config"
 	. "github.com/ForceCLI/force/error"
 	. "github.com/ForceCLI/force/lib"
 )
 
 var cmdCreate = &Command{
-	Usage: "create --type <ApexClass, ApexPage, ApexComponent, ApexTrigger> --name <item name> [--sobject <trigger object>]",
-	Short: "Creates a new, empty Apex Class, Trigger, Visualforce page, or Component.",
+	Usage: "create --type <ApexClass, ApexPage, ApexComponent, ApexTrigger, lwc, template> --name <item name> [--sobject <trigger object>]",
+	Short: "Creates a new, empty Apex Class, Trigger, Visualforce page, Component, or Lightning web component.",
 	Long: `
-Creates a new, empty Apex Class, Trigger, Visualforce page, or Component.
+Creates a new, empty Apex Class, Trigger, Visualforce page, Component, or
+Lightning web component, or creates metadata from a template.
+
+Lightning web components are created in the lwc folder of the source
+directory and then deployed. They require API version 45.0 or later.
+
+Templates
+  A template is a folder in .force/templates in the project directory (the
+  directory containing src or metadata) or in your home directory. Each
+  file in the folder is written to the same path in the source directory
+  and then deployed. File names and contents can use these variables:
+
+  {{.Name}}        Name given with -name
+  {{.SObject}}     SObject given with -sobject
+  {{.ApiVersion}}  Current API version, e.g. 40.0
+  {{.Author}}      Your name
+
+  and the functions lowerFirst, upperFirst, lower and upper.  For example,
+  .force/templates/ClassWithTest could contain classes/{{.Name}}.cls,
+  classes/{{.Name}}.cls-meta.xml, classes/{{.Name}}Test.cls and
+  classes/{{.Name}}Test.cls-meta.xml.
+
+  Project templates take precedence over your own, which take precedence
+  over the built-in templates for the types above.
+
+Options
+  -type, -t      Type or template to create
+  -name, -n      Name of thing to be created
+  -sobject, -s   SObject of trigger
+  -list          List available templates
 
 Examples:
 
@@ -23,12 +59,19 @@ Examples:
   force create -t ApexPage -n CoolPage
 
   force create -t ApexComponent -n CoolComponent
+
+  force create -t lwc -n coolComponent
+
+  force create -t ClassWithTest -n AccountService
+
+  force create -list
 `,
 }
 var (
-	what        string
-	sObjectName string
-	itemName    string
+	what          string
+	sObjectName   string
+	itemName      string
+	listTemplates bool
 )
 
 func init() {
@@ -40,68 +83,160 @@ func init() {
 	cmdCreate.Flag.StringVar(&itemName, "name", "", "Name of thing to be created.")
 	cmdCreate.Flag.StringVar(&what, "what", "", "What type of thing to create [deprecated: use type]")
 	cmdCreate.Flag.StringVar(&what, "w", "", "What type of thing to create [deprecated: use t]")
+	cmdCreate.Flag.BoolVar(&listTemplates, "list", false, "List available templates.")
 	cmdCreate.Run = runCreate
 }
 
 func runCreate(cmd *Command, args []string) {
-	force, _ := ActiveForce()
-	if len(what) == 0 || len(itemName) == 0 {
+	if !listTemplates && (len(what) == 0 || len(itemName) == 0) {
 		cmd.PrintUsage()
-	} else {
-		attrs := make(map[string]string)
-		switch strings.ToLower(what) {
-		case "apexclass":
-			attrs = getApexDefinition()
-		case "apextrigger":
-			if len(sObjectName) == 0 {
-				cmd.PrintUsage()
-				return
-			}
-			attrs = getTriggerDefinition()
-		case "apexcomponent":
-			attrs = getVFComponentDefinition()
-		case "visualforce", "apexpage":
-			what = "apexpage"
-			attrs = getVFDefinition()
-		}
+		return
+	}
+	templates, problems := LoadTemplates(config.TemplateDirs())
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+	if listTemplates {
+		printTemplates(templates)
+		return
+	}
+	switch strings.ToLower(what) {
+	case "visualforce":
+		what = "ApexPage"
+	case "lightningcomponentbundle":
+		what = "lwc"
+	}
+	tmpl, found := FindTemplate(templates, what)
+	if !found {
+		ErrorAndExit("No template named %s; use force create -list to see available templates", what)
+	}
+	if strings.EqualFold(tmpl.ToolingType, "ApexTrigger") && len(sObjectName) == 0 {
+		cmd.PrintUsage()
+		return
+	}
+	files, err := tmpl.Render(TemplateVars{
+		Name:       itemName,
+		SObject:    sObjectName,
+		ApiVersion: ApiVersionNumber(),
+		Author:     templateAuthor(),
+	})
+	if err != nil {
+		ErrorAndExit("Could not render template %s: %s", tmpl.Name, err.Error())
+	}
 
-		_, err := force.CreateToolingRecord(what, attrs)
-		if err != nil {
-			ErrorAndExit(fmt.Sprintf("Failed to create %s %s: %s", itemName, what, err.Error()))
-		} else {
-			fmt.Printf("Created new %s named %s.\n", what, itemName)
+	if tmpl.ToolingType != "" {
+		createToolingRecord(tmpl.ToolingType, files)
+		return
+	}
+	if strings.EqualFold(tmpl.Name, "lwc") {
+		if version, _ := strconv.ParseFloat(ApiVersionNumber(), 64); version < 45 {
+			ErrorAndExit("Lightning web components require API version 45.0 or later; use force apiversion to change it")
 		}
 	}
+	createFromTemplate(files)
 }
 
-func getVFDefinition() (attrs map[string]string) {
-	attrs = make(map[string]string)
-	attrs["markup"] = "<apex:page>\n\n</apex:page>"
-	attrs["name"] = itemName
-	attrs["masterlabel"] = strings.Replace(itemName, " ", "_", -1)
-	return
+func printTemplates(templates []Template) {
+	sort.Slice(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+	for _, t := range templates {
+		fmt.Printf("%-30s %s\n", t.Name, t.Source)
+	}
+}
+
+// The author is the user's full name, if known.
+func templateAuthor() string {
+	usr, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	if usr.Name != "" {
+		return usr.Name
+	}
+	return usr.Username
+}
+
+// Create an Apex class or trigger, or Visualforce page or component, from
+// the body rendered by its built-in template.
+func createToolingRecord(toolingType string, files map[string]string) {
+	force, _ := ActiveForce()
+	var body string
+	for _, b := range files {
+		body = b
+	}
+	var attrs map[string]string
+	switch toolingType {
+	case "ApexClass":
+		attrs = getApexDefinition(body)
+	case "ApexTrigger":
+		attrs = getTriggerDefinition(body)
+	case "ApexComponent", "ApexPage":
+		attrs = getVFDefinition(body)
+	}
+
+	_, err := force.CreateToolingRecord(strings.ToLower(toolingType), attrs)
+	if err != nil {
+		ErrorAndExit(fmt.Sprintf("Failed to create %s %s: %s", itemName, toolingType, err.Error()))
+	} else {
+		fmt.Printf("Created new %s named %s.\n", toolingType, itemName)
+	}
+}
+
+// Write the files rendered from a template to the source directory and
+// deploy them.
+func createFromTemplate(files map[string]string) {
+	root, err := config.GetSourceDir()
+	ExitIfNoSourceDir(err)
+	var paths []string
+	for path := range files {
+		fileName := filepath.Join(root, path)
+		if _, err := os.Stat(fileName); err == nil {
+			ErrorAndExit("%s already exists", fileName)
+		}
+		paths = append(paths, fileName)
+	}
+	sort.Strings(paths)
+	deployPaths := make(map[string]bool)
+	var toPush []string
+	for _, fileName := range paths {
+		rel, _ := filepath.Rel(root, fileName)
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			ErrorAndExit(err.Error())
+		}
+		if err := ioutil.WriteFile(fileName, []byte(files[rel]), 0644); err != nil {
+			ErrorAndExit(err.Error())
+		}
+		fmt.Printf("Created %s\n", fileName)
+		pushPath := ReplaceComponentWithBundle(fileName)
+		if !deployPaths[pushPath] {
+			deployPaths[pushPath] = true
+			toPush = append(toPush, pushPath)
+		}
+	}
+	PushByPaths(toPush, false, make(map[string]string), &ForceDeployOptions{})
 }
 
-func getVFComponentDefinition() (attrs map[string]string) {
+func getVFDefinition(markup string) (attrs map[string]string) {
 	attrs = make(map[string]string)
-	attrs["markup"] = "<apex:component>\n\n</apex:component>"
+	attrs["markup"] = markup
 	attrs["name"] = itemName
 	attrs["masterlabel"] = strings.Replace(itemName, " ", "_", -1)
 	return
 }
 
-func getApexDefinition() (attrs map[string]string) {
+func getApexDefinition(body string) (attrs map[string]string) {
 	attrs = make(map[string]string)
 	attrs["status"] = "Active"
-	attrs["body"] = fmt.Sprintf("public with sharing class %s {\n\n}", itemName)
+	attrs["body"] = body
 	attrs["name"] = itemName
 	return
 }
 
-func getTriggerDefinition() (attrs map[string]string) {
+func getTriggerDefinition(body string) (attrs map[string]string) {
 	attrs = make(map[string]string)
 	attrs["status"] = "Active"
-	attrs["body"] = fmt.Sprintf("trigger %s on %s (before insert, after insert, before update, after update, before delete, after delete, after undelete) { \n\n }", itemName, sObjectName)
+	attrs["body"] = body
 	attrs["name"] = itemName
 	attrs["TableEnumOrId"] = sObjectName
 	return
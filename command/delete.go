@@ -0,0 +1,198 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+)
+
+var cmdDelete = &Command{
+	Run:   runDelete,
+	Usage: "delete (-t <metadata type> -n <name>... | -f <path>...) [-pre] [deployment options]",
+	Short: "Delete metadata from the org and the local files",
+	Long: `
+Delete metadata from the org and the local files
+
+Deploys a destructive change deleting the named members, or the members of
+the given files and directories, after checking that they exist in the org.
+Once the deploy succeeds, the local files of the members are removed.
+
+The members are listed in destructiveChangesPost.xml, or in
+destructiveChangesPre.xml with -pre.
+
+Options
+  -type, -t               Metadata type of the members to delete
+  -name, -n               Name of a member to delete (multiple ok; requires -type)
+  -filepath, -f           Path of a file or directory to delete (multiple ok)
+  -pre                    Delete the members before the rest of the deploy
+
+Deployment Options
+  -checkonly, -c          Validate the deletion without deleting anything
+  -purgeondelete, -p      If set the deleted components are not stored in recycle bin
+  -test                   Run tests in class (implies -l RunSpecifiedTests)
+  -testlevel, -l          Set test level (NoTestRun, RunSpecifiedTests, RunLocalTests, RunAllTestsInOrg)
+  -ignorewarnings, -i     Indicates if warnings should fail deployment or not
+  -reporter               Write results to a report file (junit, json)
+  -reportfile             Report file name (default test-results.xml or test-results.json)
+
+Examples:
+
+  force delete -t ApexClass -n OldController -n OldController_Test
+
+  force delete -f src/classes/OldController.cls -f src/lwc/oldComponent
+
+  force delete -checkonly -l RunLocalTests -t ApexTrigger -n OldTrigger
+`,
+}
+
+var (
+	deleteType  string
+	deleteNames metaName
+	deletePaths metaName
+	deletePre   bool
+)
+
+func init() {
+	cmdDelete.Flag.StringVar(&deleteType, "type", "", "metadata type")
+	cmdDelete.Flag.StringVar(&deleteType, "t", "", "metadata type")
+	cmdDelete.Flag.Var(&deleteNames, "name", "name of metadata to delete")
+	cmdDelete.Flag.Var(&deleteNames, "n", "name of metadata to delete")
+	cmdDelete.Flag.Var(&deletePaths, "filepath", "path of metadata to delete")
+	cmdDelete.Flag.Var(&deletePaths, "f", "path of metadata to delete")
+	cmdDelete.Flag.BoolVar(&deletePre, "pre", false, "delete before the rest of the deploy")
+	cmdDelete.Flag.BoolVar(checkOnlyFlag, "checkonly", false, "set check only")
+	cmdDelete.Flag.BoolVar(checkOnlyFlag, "c", false, "set check only")
+	cmdDelete.Flag.BoolVar(purgeOnDeleteFlag, "purgeondelete", false, "set purge on delete")
+	cmdDelete.Flag.BoolVar(purgeOnDeleteFlag, "p", false, "set purge on delete")
+	cmdDelete.Flag.Var(&testsToRun, "test", "Test(s) to run")
+	cmdDelete.Flag.StringVar(testLevelFlag, "testlevel", "NoTestRun", "set test level")
+	cmdDelete.Flag.StringVar(testLevelFlag, "l", "NoTestRun", "set test level")
+	cmdDelete.Flag.BoolVar(ignoreWarningsFlag, "ignorewarnings", false, "set ignore warnings")
+	cmdDelete.Flag.BoolVar(ignoreWarningsFlag, "i", false, "set ignore warnings")
+	cmdDelete.Flag.StringVar(&reportFormat, "reporter", "", "write results to a report file (junit, json)")
+	cmdDelete.Flag.StringVar(&reportFile, "reportfile", "", "report file name")
+}
+
+func runDelete(cmd *Command, args []string) {
+	paths := append(deletePaths, args...)
+	if len(deleteNames) > 0 && deleteType == "" {
+		ErrorAndExit("The -type (-t) parameter is required with -name.")
+	}
+	if deleteType != "" && len(deleteNames) == 0 {
+		ErrorAndExit("Name the members to delete with -name (-n).")
+	}
+	if deleteType == "" && len(paths) == 0 {
+		ErrorAndExit("Nothing to delete. Please specify members with -type and -name or files with -filepath.")
+	}
+	if err := ValidateReportFormat(reportFormat); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	force, _ := ActiveForce()
+	force.LoadMetadataTypes()
+
+	pb := NewFetchBuilder()
+	var localPaths []string
+	if deleteType != "" {
+		mdType := findMetadataTypeOrExit(force, deleteType)
+		for _, name := range deleteNames {
+			if strings.Contains(name, "*") {
+				ErrorAndExit("Wildcards can't be used to delete metadata: %s", name)
+			}
+			pb.AddMetaToPackage(mdType.Name, name)
+		}
+		found, _ := localPathsForMembers(mdType, deleteNames)
+		localPaths = append(localPaths, WithMetaFiles(found)...)
+	}
+	for _, path := range paths {
+		localPaths = append(localPaths, addPathToDelete(&pb, path)...)
+	}
+
+	query := pb.Query()
+	missing, err := force.Metadata.MissingMembers(query)
+	if err != nil {
+		ErrorAndExit("Could not list metadata: %s", err.Error())
+	}
+	if len(missing) > 0 {
+		var names []string
+		for _, member := range missing {
+			names = append(names, fmt.Sprintf("  %s: %s", member.Type, member.Name))
+		}
+		ErrorAndExit("The following don't exist in the org:\n%s", strings.Join(names, "\n"))
+	}
+
+	opts := deployOpts()
+	DeleteMembers(query, deletePre, opts)
+	if opts.CheckOnly {
+		return
+	}
+	for _, path := range localPaths {
+		if err := os.RemoveAll(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not remove %s: %s\n", path, err.Error())
+			continue
+		}
+		fmt.Printf("Removed %s\n", path)
+		// Remove the bundle or type directory if it's now empty
+		os.Remove(filepath.Dir(path))
+	}
+}
+
+// Add the members of the file or directory at path to the package, and
+// return the local files to remove with them: the file and its -meta.xml
+// file, the whole bundle for a file in an aura or lwc bundle, or the files
+// in the directory that were added.
+func addPathToDelete(pb *PackageBuilder, path string) (localPaths []string) {
+	path = ReplaceComponentWithBundle(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	if !info.IsDir() {
+		source := MetaPathToSourcePath(path)
+		if _, err := pb.AddFile(source); err != nil {
+			ErrorAndExit(err.Error())
+		}
+		return WithMetaFiles([]string{source})
+	}
+	err = filepath.Walk(path, func(walkPath string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			if f.Name() == "__tests__" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isNotMetadataFile(walkPath) || filepath.Base(filepath.Dir(walkPath)) == "lwc" {
+			return nil
+		}
+		if _, err = pb.AddFile(walkPath); err != nil {
+			return err
+		}
+		localPaths = append(localPaths, walkPath)
+		return nil
+	})
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	return
+}
+
+// Returns the paths with the -meta.xml file of each file that has one added
+// after it.
+func WithMetaFiles(paths []string) (withMeta []string) {
+	for _, path := range paths {
+		withMeta = append(withMeta, path)
+		if strings.HasSuffix(path, "-meta.xml") || containsString(paths, path+"-meta.xml") {
+			continue
+		}
+		if _, err := os.Stat(path + "-meta.xml"); err == nil {
+			withMeta = append(withMeta, path+"-meta.xml")
+		}
+	}
+	return
+}
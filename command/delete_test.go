@@ -0,0 +1,30 @@
+package command_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/ForceCLI/force/command"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Delete", func() {
+	Describe("WithMetaFiles", func() {
+		It("should add the -meta.xml file of each file that has one", func() {
+			dir, _ := ioutil.TempDir("", "force-delete")
+			defer os.RemoveAll(dir)
+			for _, name := range []string{"Foo.cls", "Foo.cls-meta.xml", "Bar.cls", "Baz.cls", "Baz.cls-meta.xml"} {
+				Expect(ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)).To(Succeed())
+			}
+			foo := filepath.Join(dir, "Foo.cls")
+			bar := filepath.Join(dir, "Bar.cls")
+			baz := filepath.Join(dir, "Baz.cls")
+			Expect(WithMetaFiles([]string{foo, bar, baz, baz + "-meta.xml"})).To(Equal([]string{
+				foo, foo + "-meta.xml", bar, baz, baz + "-meta.xml",
+			}))
+		})
+	})
+})
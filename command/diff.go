@@ -0,0 +1,302 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ForceCLI/force/config"
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+)
+
+var cmdDiff = &Command{
+	Run:   runDiff,
+	Usage: "diff [-name-only] [-t <metadata type> [-n <name>]...] [paths]",
+	Short: "Show differences between local metadata and the org",
+	Long: `
+Show differences between local metadata and the org
+
+Retrieves the metadata matching the given files and directories, or the given
+type and names, and shows what pushing the local files would change. XML is
+normalized before comparing so that differences in element order and
+whitespace are ignored. With no arguments, all source directories are
+compared.
+
+Added files exist only locally; removed files exist only in the org.
+
+Options
+  -type, -t      Metadata type to compare
+  -name, -n      Name of metadata to compare (multiple ok; requires -type)
+  -name-only     List the names of changed files instead of showing diffs,
+                 each preceded by A (added), D (removed) or M (modified)
+
+Examples:
+
+  force diff src/classes/MyClass.cls
+
+  force diff src/lwc/myComponent src/objects
+
+  force diff -t ApexClass -n MyClass -n MyOtherClass
+
+  force diff -name-only
+`,
+}
+
+var (
+	diffType     string
+	diffNames    metaName
+	diffNameOnly bool
+)
+
+func init() {
+	cmdDiff.Flag.StringVar(&diffType, "type", "", "metadata type")
+	cmdDiff.Flag.StringVar(&diffType, "t", "", "metadata type")
+	cmdDiff.Flag.Var(&diffNames, "name", "name of metadata")
+	cmdDiff.Flag.Var(&diffNames, "n", "name of metadata")
+	cmdDiff.Flag.BoolVar(&diffNameOnly, "name-only", false, "only list changed files")
+}
+
+func runDiff(cmd *Command, args []string) {
+	if len(diffNames) > 0 && diffType == "" {
+		ErrorAndExit("The -type (-t) parameter is required with -name.")
+	}
+	force, _ := ActiveForce()
+	force.LoadMetadataTypes()
+
+	paths := args
+	var missing ForceMetadataQuery
+	if diffType != "" {
+		mdType := findMetadataTypeOrExit(force, diffType)
+		diffType = mdType.Name
+		typePaths, notLocal := localPathsForMembers(mdType, diffNames)
+		paths = append(paths, typePaths...)
+		if len(notLocal) > 0 {
+			missing = append(missing, ForceMetadataQueryElement{Name: []string{diffType}, Members: notLocal})
+		}
+	} else if len(paths) == 0 {
+		roots, err := config.SourceDirs()
+		ExitIfNoSourceDir(err)
+		paths = roots
+	}
+
+	local, query := localMetadataFiles(paths)
+	query = append(query, missing...)
+	if len(query) == 0 {
+		ErrorAndExit("Nothing to compare")
+	}
+	org, problems, err := force.Metadata.Retrieve(query)
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+
+	diff := CompareMetadataFiles(org, local)
+	printMetadataDiff(diff, org, local, "org/", "local/")
+}
+
+// Print the differences between the original and updated files: the names
+// of the changed files with -name-only, marked A, D or M like git diff
+// --name-status, otherwise unified diffs followed by a summary.
+func printMetadataDiff(diff MetadataDiff, original, updated ForceMetadataFiles, fromPrefix, toPrefix string) {
+	if diffNameOnly {
+		for _, changes := range []struct {
+			status string
+			names  []string
+		}{{"A", diff.Added}, {"D", diff.Removed}, {"M", diff.Modified}} {
+			for _, name := range changes.names {
+				fmt.Printf("%s\t%s\n", changes.status, name)
+			}
+		}
+		return
+	}
+	for _, names := range [][]string{diff.Added, diff.Removed, diff.Modified} {
+		for _, name := range names {
+			fmt.Print(MetadataFileDiff(name, original, updated, fromPrefix, toPrefix))
+		}
+	}
+	if diff.Empty() {
+		fmt.Println("No differences")
+		return
+	}
+	fmt.Println()
+	printNames := func(heading string, names []string) {
+		if len(names) == 0 {
+			return
+		}
+		fmt.Println(heading)
+		for _, name := range names {
+			fmt.Println("  " + name)
+		}
+	}
+	printNames("Added:", diff.Added)
+	printNames("Removed:", diff.Removed)
+	printNames("Modified:", diff.Modified)
+	fmt.Printf("%d added, %d removed, %d modified\n", len(diff.Added), len(diff.Removed), len(diff.Modified))
+}
+
+// Returns the metadata type with the given name or directory name.
+func findMetadataTypeOrExit(force *Force, typeName string) MetadataType {
+	types, _ := force.MetadataTypes()
+	mdType, found := FindMetadataType(types, typeName)
+	if !found {
+		if mdType, found = FindMetadataTypeByDirectory(types, typeName); !found {
+			ErrorAndExit("Unknown metadata type %s", typeName)
+		}
+	}
+	return mdType
+}
+
+// Returns the local files of the named members of a metadata type, or of
+// all its members if there are no names, and the names that aren't found
+// locally.
+func localPathsForMembers(mdType MetadataType, names []string) (paths []string, notLocal []string) {
+	roots, err := config.SourceDirs()
+	ExitIfNoSourceDir(err)
+	for _, root := range roots {
+		dir := filepath.Join(root, mdType.DirectoryName)
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if len(names) == 0 {
+			paths = append(paths, dir)
+		}
+	}
+	for _, name := range names {
+		var found []string
+		for _, root := range roots {
+			dir := filepath.Join(root, mdType.DirectoryName)
+			memberPath := filepath.Join(dir, filepath.FromSlash(name))
+			if info, err := os.Stat(memberPath); err == nil && info.IsDir() {
+				found = append(found, memberPath)
+			}
+			matches, _ := filepath.Glob(memberPath + ".*")
+			for _, match := range matches {
+				if !strings.HasSuffix(match, "-meta.xml") || !containsString(matches, strings.TrimSuffix(match, "-meta.xml")) {
+					found = append(found, match)
+				}
+			}
+		}
+		if len(found) == 0 {
+			notLocal = append(notLocal, name)
+		}
+		paths = append(paths, found...)
+	}
+	return
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Read the files at paths, which may be files or directories in the source
+// directories, keyed by their path relative to their source directory. A
+// file's -meta.xml file is included with it, and a file in an aura or lwc
+// bundle brings in the whole bundle. Also returns a query retrieving the
+// corresponding members.
+func localMetadataFiles(paths []string) (files ForceMetadataFiles, query ForceMetadataQuery) {
+	roots, err := config.SourceDirs()
+	ExitIfNoSourceDir(err)
+	ignore, err := LoadProjectForceIgnore()
+	if err != nil {
+		ErrorAndExit("Could not read .forceignore: %s", err.Error())
+	}
+	files = make(ForceMetadataFiles)
+	pb := NewFetchBuilder()
+
+	addFile := func(root string, path string) {
+		if ignore.Ignored(path) || isNotMetadataFile(path) {
+			return
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if _, seen := files[rel]; seen {
+			return
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			ErrorAndExit(err.Error())
+		}
+		files[rel] = data
+		if _, err := pb.AddFile(path); err != nil {
+			ErrorAndExit(err.Error())
+		}
+	}
+
+	for _, path := range paths {
+		path, err := filepath.Abs(ReplaceComponentWithBundle(path))
+		if err != nil {
+			ErrorAndExit(err.Error())
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		root := sourceDirContaining(roots, path)
+		if root == "" {
+			ErrorAndExit("%s is not in a source directory", path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			ErrorAndExit(err.Error())
+		}
+		if !info.IsDir() {
+			source := MetaPathToSourcePath(path)
+			addFile(root, source)
+			if _, err := os.Stat(source + "-meta.xml"); err == nil {
+				addFile(root, source+"-meta.xml")
+			}
+			continue
+		}
+		filepath.Walk(path, func(walkPath string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if f.IsDir() {
+				// Unpacked static resources are compared as their .resource files
+				if walkPath != path && (ignore.Ignored(walkPath) || f.Name() == "__tests__" || filepath.Base(filepath.Dir(walkPath)) == "staticresources") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Base(filepath.Dir(walkPath)) != "lwc" {
+				addFile(root, walkPath)
+			}
+			return nil
+		})
+	}
+	// Decomposed objects are compared as the object files they deploy as
+	if files, err = RecomposeObjectFiles(files); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	query = pb.Query()
+	return
+}
+
+// Files in source directories that aren't metadata.
+func isNotMetadataFile(path string) bool {
+	name := filepath.Base(path)
+	return name == "package.xml" || name == ".DS_Store" || strings.HasPrefix(name, "destructiveChanges")
+}
+
+// Returns the source directory containing path, or "" if none does.
+func sourceDirContaining(roots []string, path string) string {
+	for _, root := range roots {
+		resolved, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(resolved, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return resolved
+		}
+	}
+	return ""
+}
@@ -2,10 +2,8 @@ package command
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/ForceCLI/force/config"
 	. "github.com/ForceCLI/force/error"
@@ -21,22 +19,52 @@ Export metadata to a local directory
 
 Export Options
   -w, -warnings  # Display warnings about metadata that cannot be retrieved
+  -v, -verbose   # Report files excluded by .forceignore (see force help forceignore)
+  -since         # Only retrieve members changed since a time, or since the last export with "last"
+  -concurrency   # Number of retrieves to run at once (default 3)
+  -chunk-size    # Maximum estimated number of files per retrieve (default 5000)
+
+Files are written as they're unzipped, so the export isn't held in memory.
+
+Large exports are split into several retrieves that stay under the limits on
+the number of files and the size of a retrieve, and run concurrently. Failed
+retrieves are retried on their own, and split further if they fail again.
+Profiles, permission sets and translations are retrieved in one retrieve
+together with the types they refer to, so that they're complete.
+
+With -since, the members of every type are listed first and only those
+modified after the given time are retrieved. The time is a timestamp such as
+2020-01-02T15:04:05Z or a date such as 2020-01-02 in local time. The org's
+time at the start of each successful export is remembered for each org in
+.force/state.json in the project directory, and -since last uses the time of
+the last export, so a scheduled job can keep a mirror of the org up to date
+cheaply.
 
 Examples:
 
   force export
 
   force export org/schema
+
+  force export -since last
 `,
 }
 
 var (
 	showWarnings bool
+	exportSince  string
+	concurrency  int
+	chunkSize    int
 )
 
 func init() {
 	cmdExport.Flag.BoolVar(&showWarnings, "w", false, "show warnings")
 	cmdExport.Flag.BoolVar(&showWarnings, "warnings", false, "show warnings")
+	cmdExport.Flag.BoolVar(&Verbose, "v", false, "report ignored files")
+	cmdExport.Flag.BoolVar(&Verbose, "verbose", false, "report ignored files")
+	cmdExport.Flag.StringVar(&exportSince, "since", "", "only retrieve members changed since a time or last")
+	cmdExport.Flag.IntVar(&concurrency, "concurrency", DefaultRetrieveConcurrency, "number of retrieves to run at once")
+	cmdExport.Flag.IntVar(&chunkSize, "chunk-size", DefaultRetrieveChunkSize, "maximum estimated number of files per retrieve")
 }
 
 func runExport(cmd *Command, args []string) {
@@ -51,128 +79,17 @@ func runExport(cmd *Command, args []string) {
 		ErrorAndExit(err.Error())
 	}
 	force, _ := ActiveForce()
-	sobjects, err := force.ListSobjects()
+	force.Metadata.RetrieveConcurrency = concurrency
+	force.Metadata.RetrieveChunkSize = chunkSize
+	syncStart := force.SyncStartTime()
+	types, err := force.MetadataTypes()
 	if err != nil {
-		ErrorAndExit(err.Error())
-	}
-	stdObjects := make([]string, 1, len(sobjects)+1)
-	stdObjects[0] = "*"
-	for _, sobject := range sobjects {
-		name := sobject["name"].(string)
-		if !sobject["custom"].(bool) && !strings.HasSuffix(name, "__Tag") && !strings.HasSuffix(name, "__History") && !strings.HasSuffix(name, "__Share") {
-			stdObjects = append(stdObjects, name)
-		}
+		ErrorAndExit("Could not get metadata types: %s", err.Error())
 	}
-	stdObjects = append(stdObjects, "Activity")
-	query := ForceMetadataQuery{
-		{Name: []string{"AccountSettings"}, Members: []string{"*"}},
-		{Name: []string{"ActivitiesSettings"}, Members: []string{"*"}},
-		{Name: []string{"AddressSettings"}, Members: []string{"*"}},
-		{Name: []string{"AnalyticSnapshot"}, Members: []string{"*"}},
-		{Name: []string{"ApexClass"}, Members: []string{"*"}},
-		{Name: []string{"ApexComponent"}, Members: []string{"*"}},
-		{Name: []string{"ApexPage"}, Members: []string{"*"}},
-		{Name: []string{"ApexTrigger"}, Members: []string{"*"}},
-		{Name: []string{"ApprovalProcess"}, Members: []string{"*"}},
-		{Name: []string{"AssignmentRules"}, Members: []string{"*"}},
-		{Name: []string{"Audience"}, Members: []string{"*"}},
-		{Name: []string{"AuraDefinitionBundle"}, Members: []string{"*"}},
-		{Name: []string{"AuthProvider"}, Members: []string{"*"}},
-		{Name: []string{"AutoResponseRules"}, Members: []string{"*"}},
-		{Name: []string{"BusinessHoursSettings"}, Members: []string{"*"}},
-		{Name: []string{"BusinessProcess"}, Members: []string{"*"}},
-		{Name: []string{"CallCenter"}, Members: []string{"*"}},
-		{Name: []string{"CaseSettings"}, Members: []string{"*"}},
-		{Name: []string{"ChatterAnswersSettings"}, Members: []string{"*"}},
-		{Name: []string{"CompanySettings"}, Members: []string{"*"}},
-		{Name: []string{"Community"}, Members: []string{"*"}},
-		{Name: []string{"CompactLayout"}, Members: []string{"*"}},
-		{Name: []string{"ConnectedApp"}, Members: []string{"*"}},
-		{Name: []string{"ContentAsset"}, Members: []string{"*"}},
-		{Name: []string{"ContractSettings"}, Members: []string{"*"}},
-		{Name: []string{"CustomApplication"}, Members: []string{"*"}},
-		{Name: []string{"CustomApplicationComponent"}, Members: []string{"*"}},
-		{Name: []string{"CustomField"}, Members: []string{"*"}},
-		{Name: []string{"CustomLabels"}, Members: []string{"*"}},
-		{Name: []string{"CustomMetadata"}, Members: []string{"*"}},
-		{Name: []string{"CustomObject"}, Members: stdObjects},
-		{Name: []string{"CustomObjectTranslation"}, Members: []string{"*"}},
-		{Name: []string{"CustomPageWebLink"}, Members: []string{"*"}},
-		{Name: []string{"CustomPermission"}, Members: []string{"*"}},
-		{Name: []string{"CustomSite"}, Members: []string{"*"}},
-		{Name: []string{"CustomTab"}, Members: []string{"*"}},
-		{Name: []string{"DataCategoryGroup"}, Members: []string{"*"}},
-		{Name: []string{"DuplicateRule"}, Members: []string{"*"}},
-		{Name: []string{"EntitlementProcess"}, Members: []string{"*"}},
-		{Name: []string{"EntitlementSettings"}, Members: []string{"*"}},
-		{Name: []string{"EntitlementTemplate"}, Members: []string{"*"}},
-		{Name: []string{"ExternalDataSource"}, Members: []string{"*"}},
-		{Name: []string{"FieldSet"}, Members: []string{"*"}},
-		{Name: []string{"FlexiPage"}, Members: []string{"*"}},
-		{Name: []string{"Flow"}, Members: []string{"*"}},
-		{Name: []string{"FlowDefinition"}, Members: []string{"*"}},
-		{Name: []string{"Folder"}, Members: []string{"*"}},
-		{Name: []string{"ForecastingSettings"}, Members: []string{"*"}},
-		{Name: []string{"Group"}, Members: []string{"*"}},
-		{Name: []string{"HomePageComponent"}, Members: []string{"*"}},
-		{Name: []string{"HomePageLayout"}, Members: []string{"*"}},
-		{Name: []string{"IdeasSettings"}, Members: []string{"*"}},
-		{Name: []string{"KnowledgeSettings"}, Members: []string{"*"}},
-		{Name: []string{"Layout"}, Members: []string{"*"}},
-		{Name: []string{"Letterhead"}, Members: []string{"*"}},
-		{Name: []string{"ListView"}, Members: []string{"*"}},
-		{Name: []string{"LiveAgentSettings"}, Members: []string{"*"}},
-		{Name: []string{"LiveChatAgentConfig"}, Members: []string{"*"}},
-		{Name: []string{"LiveChatButton"}, Members: []string{"*"}},
-		{Name: []string{"LiveChatDeployment"}, Members: []string{"*"}},
-		{Name: []string{"MatchingRules"}, Members: []string{"*"}},
-		{Name: []string{"MilestoneType"}, Members: []string{"*"}},
-		{Name: []string{"MobileSettings"}, Members: []string{"*"}},
-		{Name: []string{"NamedFilter"}, Members: []string{"*"}},
-		{Name: []string{"Network"}, Members: []string{"*"}},
-		{Name: []string{"OpportunitySettings"}, Members: []string{"*"}},
-		{Name: []string{"PermissionSet"}, Members: []string{"*"}},
-		{Name: []string{"Portal"}, Members: []string{"*"}},
-		{Name: []string{"PostTemplate"}, Members: []string{"*"}},
-		{Name: []string{"ProductSettings"}, Members: []string{"*"}},
-		{Name: []string{"Profile"}, Members: []string{"*"}},
-		{Name: []string{"ProfileSessionSetting"}, Members: []string{"*"}},
-		{Name: []string{"Queue"}, Members: []string{"*"}},
-		{Name: []string{"QuickAction"}, Members: []string{"*"}},
-		{Name: []string{"QuoteSettings"}, Members: []string{"*"}},
-		{Name: []string{"RecordType"}, Members: []string{"*"}},
-		{Name: []string{"RemoteSiteSetting"}, Members: []string{"*"}},
-		{Name: []string{"ReportType"}, Members: []string{"*"}},
-		{Name: []string{"Role"}, Members: []string{"*"}},
-		{Name: []string{"SamlSsoConfig"}, Members: []string{"*"}},
-		{Name: []string{"Scontrol"}, Members: []string{"*"}},
-		{Name: []string{"SecuritySettings"}, Members: []string{"*"}},
-		{Name: []string{"SharingReason"}, Members: []string{"*"}},
-		{Name: []string{"SharingRules"}, Members: []string{"*"}},
-		{Name: []string{"Skill"}, Members: []string{"*"}},
-		{Name: []string{"StaticResource"}, Members: []string{"*"}},
-		{Name: []string{"Territory"}, Members: []string{"*"}},
-		{Name: []string{"Translations"}, Members: []string{"*"}},
-		{Name: []string{"ValidationRule"}, Members: []string{"*"}},
-		{Name: []string{"Workflow"}, Members: []string{"*"}},
-	}
-
-	folders, err := force.GetAllFolders()
+	query, err := force.ExpandWildcards(exportQuery(types))
 	if err != nil {
-		err = fmt.Errorf("Could not get folders: %s", err.Error())
 		ErrorAndExit(err.Error())
 	}
-	for foldersType, foldersName := range folders {
-		if foldersType == "Email" {
-			foldersType = "EmailTemplate"
-		}
-		members, err := force.GetMetadataInFolders(foldersType, foldersName)
-		if err != nil {
-			err = fmt.Errorf("Could not get metadata in folders: %s", err.Error())
-			ErrorAndExit(err.Error())
-		}
-		query = append(query, ForceMetadataQueryElement{Name: []string{string(foldersType)}, Members: members})
-	}
 
 	if root == "" {
 		root, err = config.GetSourceDir()
@@ -181,7 +98,17 @@ func runExport(cmd *Command, args []string) {
 			ErrorAndExit(err.Error())
 		}
 	}
-	files, problems, err := force.Metadata.Retrieve(query)
+	if exportSince != "" {
+		if query = changedSince(force, query, exportSince, "export"); len(query) == 0 {
+			recordSync(force, "export", syncStart)
+			return
+		}
+	}
+	ignore, err := LoadProjectForceIgnore()
+	if err != nil {
+		ErrorAndExit("Could not read .forceignore: %s", err.Error())
+	}
+	problems, err := force.Metadata.RetrieveToDir(query, root, ignore.Ignored)
 	if err != nil {
 		fmt.Printf("Encountered and error with retrieve...\n")
 		ErrorAndExit(err.Error())
@@ -191,15 +118,29 @@ func runExport(cmd *Command, args []string) {
 			fmt.Fprintln(os.Stderr, problem)
 		}
 	}
-	for name, data := range files {
-		file := filepath.Join(root, name)
-		dir := filepath.Dir(file)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			ErrorAndExit(err.Error())
+	if err := force.RecordRetrievedMembers(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not record exported members: %s\n", err.Error())
+	}
+	recordSync(force, "export", syncStart)
+	fmt.Printf("Exported to %s\n", root)
+}
+
+// Retrieve every type and child type. The wildcards must be expanded for
+// the members that they don't cover, such as standard objects and members
+// in folders.
+func exportQuery(types []MetadataType) (query ForceMetadataQuery) {
+	seen := make(map[string]bool)
+	add := func(name string, members []string) {
+		if !seen[name] {
+			seen[name] = true
+			query = append(query, ForceMetadataQueryElement{Name: []string{name}, Members: members})
 		}
-		if err := ioutil.WriteFile(filepath.Join(root, name), data, 0644); err != nil {
-			ErrorAndExit(err.Error())
+	}
+	for _, t := range types {
+		add(t.Name, []string{"*"})
+		for _, child := range t.ChildXmlNames {
+			add(child, []string{"*"})
 		}
 	}
-	fmt.Printf("Exported to %s\n", root)
+	return
 }
@@ -10,7 +10,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/ForceCLI/force/config"
 	. "github.com/ForceCLI/force/error"
@@ -27,6 +29,10 @@ var cmdFetch = &Command{
   -u, -unpack     # unpack any zipped static resources (ignored if type is not StaticResource)
   -p, -preserve   # preserve the zip file
   -x, -xml        # provide a package.xml file to fetch data specified within
+  -v, -verbose    # report files excluded by .forceignore (see force help forceignore)
+  -since          # only retrieve members changed since a time (2020-01-02T15:04:05Z, or 2020-01-02 in local time), or since the last fetch of the same types and names with "last"
+  -normalize      # write XML files in canonical form so that fetches don't reorder them (default from the normalize project setting; see force help normalize)
+  -profiles-with  # retrieve profiles or permission sets with all members of these types and merge them into the local files
 
 Export specified artifact(s) to a local directory. Use "package" type to retrieve an unmanaged package.
 
@@ -36,6 +42,28 @@ Examples
   force fetch -t Aura -n MyComponent -d /Users/me/Documents/Project/home
   force fetch -t AuraDefinitionBundle -t ApexClass
   force fetch -x myproj/metadata/package.xml
+  force fetch -t lwc -n myComponent
+  force fetch -t classes -t triggers
+  force fetch -t ApexClass -t ApexPage -since 2020-01-02
+  force fetch -t Report -since last
+  force fetch -t Profile -t PermissionSet -normalize
+  force fetch -t Profile -profiles-with CustomObject,ApexClass,ApexPage
+  force fetch -t PermissionSet -n Sales -profiles-with CustomTab,CustomApplication
+
+Metadata types can also be given by their directory names, e.g. classes for
+ApexClass.
+
+Fetching a whole type, or * in a package.xml, also retrieves the members that
+the wildcard doesn't cover: standard objects, members in folders such as
+reports, and members installed from managed packages.
+
+The org's time at the start of each successful fetch by type is remembered
+in .force/state.json in the project directory for -since last.
+
+A profile or permission set only includes its permissions for the members
+retrieved with it, so merging replaces only the elements for the given
+types, such as classAccesses for ApexClass, and keeps the others. The
+members of the given types aren't written.
 `,
 }
 
@@ -63,6 +91,11 @@ var (
 	preserveZip     bool
 	mdbase          string
 	packageXml      string
+	fetchSince      string
+	fetchNormalize  bool
+	// Set by the decomposeObjects project setting
+	fetchDecomposeObjects bool
+	fetchProfilesWith     metaName
 )
 
 func init() {
@@ -78,6 +111,11 @@ func init() {
 	cmdFetch.Flag.BoolVar(&preserveZip, "preserve", false, "keep zip file on disk")
 	cmdFetch.Flag.StringVar(&packageXml, "x", "", "Package.xml file to use for fetch.")
 	cmdFetch.Flag.StringVar(&packageXml, "xml", "", "Package.xml file to use for fetch.")
+	cmdFetch.Flag.BoolVar(&Verbose, "v", false, "Report ignored files")
+	cmdFetch.Flag.BoolVar(&Verbose, "verbose", false, "Report ignored files")
+	cmdFetch.Flag.StringVar(&fetchSince, "since", "", "only retrieve members changed since a time or last")
+	cmdFetch.Flag.BoolVar(&fetchNormalize, "normalize", false, "write XML files in canonical form")
+	cmdFetch.Flag.Var(&fetchProfilesWith, "profiles-with", "types to retrieve profiles or permission sets with")
 	cmdFetch.Run = runFetch
 	makefile = true
 }
@@ -172,6 +210,8 @@ func persistBundles(bundles AuraDefinitionBundleResult, definitions AuraDefiniti
 					entity += ".design"
 				case "INTERFACE":
 					entity += ".intf"
+				case "TOKENS":
+					entity += ".tokens"
 				default:
 					entity += fmt.Sprintf("%s.js", naming)
 				}
@@ -191,43 +231,73 @@ func persistBundles(bundles AuraDefinitionBundleResult, definitions AuraDefiniti
 	return
 }
 
+// Returns a query retrieving every member of the types, with the wildcards
+// expanded for the members they don't cover.
 func getWildcardQuery(force *Force, metadataTypes metaName) (query ForceMetadataQuery, err error) {
-	var folders FolderedMetadata
-	// For foldered metadata types, which don't support wildcards, get the list
-	// of folders and all metadata within each folder.
 	for _, metadataType := range metadataTypes {
-		switch metadataType {
-		case "EmailTemplate":
-			fallthrough
-		case "Dashboard":
-			fallthrough
-		case "Report":
-			fallthrough
-		case "Document":
-			if folders == nil {
-				folders, err = force.GetAllFolders()
-			}
-			if err != nil {
-				ErrorAndExit(err.Error())
-			}
-			folderType := FolderType(metadataType)
-			members, err := force.GetMetadataInFolders(folderType, folders[folderType])
-			if err != nil {
-				err = fmt.Errorf("Could not get metadata in folders: %s", err.Error())
-				ErrorAndExit(err.Error())
-			}
-			query = append(query, ForceMetadataQueryElement{Name: []string{string(folderType)}, Members: members})
+		query = append(query, ForceMetadataQueryElement{Name: []string{metadataType}, Members: []string{"*"}})
+	}
+	return force.ExpandWildcards(query)
+}
+
+// Returns the metadata type names for the given types, which may also be
+// given as directory names, e.g. classes for ApexClass.
+func resolveMetadataTypes(force *Force, names metaName) (resolved metaName) {
+	types, _ := force.MetadataTypes()
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "lwc":
+			name = "LightningComponentBundle"
 		default:
-			mq := ForceMetadataQueryElement{
-				Name:    []string{metadataType},
-				Members: []string{"*"},
+			if _, found := FindMetadataType(types, name); !found {
+				if t, found := FindMetadataTypeByDirectory(types, name); found {
+					name = t.Name
+				}
 			}
-			query = append(query, mq)
 		}
+		resolved = append(resolved, name)
 	}
 	return
 }
 
+// Identifies a fetch of the given types and names when remembering the
+// time of the last fetch.
+func fetchSyncScope(types, names metaName) string {
+	sortedTypes := append([]string(nil), types...)
+	sort.Strings(sortedTypes)
+	scope := "fetch -t " + strings.Join(sortedTypes, ",")
+	if len(names) > 0 {
+		sortedNames := append([]string(nil), names...)
+		sort.Strings(sortedNames)
+		scope += " -n " + strings.Join(sortedNames, ",")
+	}
+	return scope
+}
+
+// Narrow the query to the members changed since the time given to -since.
+func changedSince(force *Force, query ForceMetadataQuery, since string, scope string) ForceMetadataQuery {
+	sinceTime, err := force.SinceTime(since, scope)
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	if sinceTime.IsZero() {
+		fmt.Println("No previous sync; retrieving everything")
+		return query
+	}
+	fmt.Printf("Listing members changed since %s...\n", sinceTime.Local().Format(time.RFC1123))
+	changed := force.Metadata.ChangedMembersQuery(query, sinceTime)
+	if len(changed) == 0 {
+		fmt.Printf("Nothing changed since %s\n", sinceTime.Local().Format(time.RFC1123))
+	}
+	return changed
+}
+
+func recordSync(force *Force, scope string, t time.Time) {
+	if err := force.RecordSync(scope, t); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not record time of sync: %s\n", err.Error())
+	}
+}
+
 func runFetch(cmd *Command, args []string) {
 
 	force, _ := ActiveForce()
@@ -238,11 +308,33 @@ func runFetch(cmd *Command, args []string) {
 	if len(metadataTypes) > 1 && len(metadataName) > 1 {
 		ErrorAndExit("You cannot specify entity names if you specify more than one metadata type.")
 	}
+	if fetchSince != "" && (len(packageXml) > 0 || (len(metadataTypes) == 1 && (strings.ToLower(metadataTypes[0]) == "aura" || strings.ToLower(metadataTypes[0]) == "package"))) {
+		ErrorAndExit("-since can only be used to fetch metadata types")
+	}
 
 	var files ForceMetadataFiles
 	var problems []string
 	var err error
 	var expandResources bool = unpack
+	// What was fetched and when it started, for remembering the time of the
+	// fetch with -since
+	var syncScope string
+	var syncStart time.Time
+
+	if len(metadataTypes) > 1 || (len(metadataTypes) == 1 && strings.ToLower(metadataTypes[0]) != "aura" && strings.ToLower(metadataTypes[0]) != "package") {
+		metadataTypes = resolveMetadataTypes(force, metadataTypes)
+	}
+	if len(fetchProfilesWith) > 0 {
+		if len(packageXml) > 0 || fetchSince != "" {
+			ErrorAndExit("-profiles-with cannot be used with -xml or -since")
+		}
+		for _, t := range metadataTypes {
+			if t != "Profile" && t != "PermissionSet" {
+				ErrorAndExit("-profiles-with can only be used to fetch Profile or PermissionSet")
+			}
+		}
+		fetchProfilesWith = resolveMetadataTypes(force, fetchProfilesWith)
+	}
 
 	if len(metadataTypes) == 1 && strings.ToLower(metadataTypes[0]) == "aura" {
 		if len(metadataName) > 0 {
@@ -267,6 +359,9 @@ func runFetch(cmd *Command, args []string) {
 	} else {
 		if len(packageXml) > 0 {
 			files, problems, err = force.Metadata.RetrieveByPackageXml(packageXml)
+			if err != nil {
+				ErrorAndExit(err.Error())
+			}
 		} else {
 			query := ForceMetadataQuery{}
 			if len(metadataName) > 0 {
@@ -274,14 +369,33 @@ func runFetch(cmd *Command, args []string) {
 					Name:    metadataTypes,
 					Members: metadataName,
 				}
-				query = append(query, mq)
+				query, err = force.ExpandWildcards(append(query, mq))
+				if err != nil {
+					ErrorAndExit(err.Error())
+				}
 			} else {
 				query, err = getWildcardQuery(force, metadataTypes)
 				if err != nil {
 					ErrorAndExit(err.Error())
 				}
 			}
-			files, problems, err = force.Metadata.Retrieve(query)
+			syncScope = fetchSyncScope(metadataTypes, metadataName)
+			syncStart = force.SyncStartTime()
+			if fetchSince != "" {
+				query = changedSince(force, query, fetchSince, syncScope)
+				if len(query) == 0 {
+					recordSync(force, syncScope, syncStart)
+					return
+				}
+			}
+			if len(fetchProfilesWith) > 0 {
+				files, problems, err = force.RetrieveProfilesWith(query, fetchProfilesWith)
+				if err == nil && len(files) == 0 {
+					ErrorAndExit("Could not find any objects for " + strings.Join(metadataTypes, ", "))
+				}
+			} else {
+				files, problems, err = force.Metadata.Retrieve(query)
+			}
 			if err != nil {
 				ErrorAndExit(err.Error())
 			}
@@ -300,20 +414,55 @@ func runFetch(cmd *Command, args []string) {
 		ErrorAndExit(err.Error())
 	}
 	existingPackage, _ := pathExists(filepath.Join(root, "package.xml"))
+	// Route each file to the source directory that already has it
+	var project *config.Project
+	if targetDirectory == "" {
+		project, _ = config.FindProject()
+	}
+	fileRoot := func(name string) string {
+		if project != nil && name != "package.xml" {
+			return project.OwningSourceDir(name)
+		}
+		return root
+	}
+	ignore, err := LoadProjectForceIgnore()
+	if err != nil {
+		ErrorAndExit("Could not read .forceignore: %s", err.Error())
+	}
 
 	for _, problem := range problems {
 		fmt.Fprintln(os.Stderr, problem)
 	}
-	if len(files) == 1 {
+	// Retrieves include a package.xml, except with -profiles-with
+	if len(files) == 1 && len(fetchProfilesWith) == 0 {
 		ErrorAndExit("Could not find any objects for " + strings.Join(metadataTypes, ", ") + ". (Is the metadata type correct?)")
 	}
+	if fetchNormalize {
+		if err := CanonicalizeMetadataFiles(files); err != nil {
+			ErrorAndExit(err.Error())
+		}
+	}
+	if fetchDecomposeObjects {
+		if files, err = DecomposeObjectFiles(files); err != nil {
+			ErrorAndExit(err.Error())
+		}
+	}
 	for name, data := range files {
 		if !existingPackage || name != "package.xml" {
+			root := fileRoot(name)
 			file := filepath.Join(root, name)
+			if ignore.Ignored(file) {
+				continue
+			}
 			dir := filepath.Dir(file)
 			if err := os.MkdirAll(dir, 0755); err != nil {
 				ErrorAndExit(err.Error())
 			}
+			if len(fetchProfilesWith) > 0 {
+				if data, err = mergeLocalProfile(file, data, fetchProfilesWith); err != nil {
+					ErrorAndExit("Could not merge %s: %s", file, err.Error())
+				}
+			}
 			if err := ioutil.WriteFile(filepath.Join(root, name), data, 0644); err != nil {
 				ErrorAndExit(err.Error())
 			}
@@ -354,6 +503,27 @@ func runFetch(cmd *Command, args []string) {
 		}
 	}
 
+	// Children deleted from objects fetched whole are removed locally
+	if fetchDecomposeObjects {
+		for _, path := range StaleObjectChildFiles(files, fileRoot) {
+			if ignore.Ignored(path) {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Could not remove %s: %s\n", path, err.Error())
+				continue
+			}
+			fmt.Printf("Removed %s\n", path)
+		}
+	}
+
+	if err := force.RecordRetrievedMembers(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not record fetched members: %s\n", err.Error())
+	}
+	if syncScope != "" {
+		recordSync(force, syncScope, syncStart)
+	}
+
 	// Now we need to see if we have any zips to expand
 	if expandResources && len(resourcesMap) > 0 {
 		for _, value := range resourcesMap {
@@ -403,6 +573,19 @@ func runFetch(cmd *Command, args []string) {
 	fmt.Printf("Exported to %s\n", root)
 }
 
+// Merge a profile or permission set retrieved with all members of the types
+// into the local file, if there is one.
+func mergeLocalProfile(file string, data []byte, types []string) (merged []byte, err error) {
+	local, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		local, err = nil, nil
+	}
+	if err != nil {
+		return
+	}
+	return MergeProfileXml(local, data, types)
+}
+
 func pathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
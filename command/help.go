@@ -14,6 +14,52 @@ var cmdHelp = &Command{
 	Long:  `Help shows usage for a command.`,
 }
 
+var helpForceIgnore = &Command{
+	Usage: "forceignore",
+	Short: "Files excluded from deploys and retrieves",
+	Long: `
+A .forceignore file in the project directory lists patterns of files that
+push and import don't deploy, and that fetch and export don't write when
+they're retrieved. It uses the same syntax as .gitignore:
+
+  # Jest tests and local configuration
+  **/__tests__/**
+  jsconfig.json
+  *.bak
+  !keep.bak
+
+The project directory is the one with a force-project.json file, or else the
+one containing the src or metadata directory. Run push, import, fetch or
+export with -verbose to report the files that are excluded.
+`,
+}
+
+var helpProject = &Command{
+	Usage: "project",
+	Short: "Projects with several source directories",
+	Long: `
+A force-project.json file declares a project's source directories, the
+default one first or marked as such:
+
+  {
+    "packageDirectories": [
+      {"path": "core", "default": true},
+      {"path": "integrations"}
+    ]
+  }
+
+The sourceDirs project setting does the same without the file; see force
+help config. With several source directories:
+
+  push    looks in all of them when pushing by type or name, and deploys
+          the matches together
+  import  combines them into one deploy with a generated package.xml,
+          unless -directory is given
+  fetch   writes each retrieved file to the directory that already has it,
+          and new files to the default one
+`,
+}
+
 func init() {
 	cmdHelp.Run = runHelp // break init loop
 }
@@ -45,6 +91,9 @@ Available commands:{{range .Commands}}{{if .Runnable}}{{if .List}}
    {{.Name | printf "%-8s"}}  {{.Short}}{{end}}{{end}}{{end}}
 
 Run 'force help [command]' for details.
+
+Additional help topics:{{range .Commands}}{{if not .Runnable}}
+   {{.Name | printf "%-11s"}}  {{.Short}}{{end}}{{end}}
 `[1:]))
 
 func PrintUsage() {
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/ForceCLI/force/config"
 	. "github.com/ForceCLI/force/error"
 	. "github.com/ForceCLI/force/lib"
 )
@@ -31,6 +32,14 @@ Deployment Options
   -ignorewarnings, -i     Indicates if warnings should fail deployment or not
   -directory, -d 		  Path to the package.xml file to import
   -verbose, -v 			  Provide detailed feedback on operation
+  -reporter               Write results to a report file (junit, json)
+  -reportfile             Report file name (default test-results.xml or test-results.json)
+  -force                  Deploy even if members were changed in the org since they were fetched
+
+Files matching .forceignore aren't deployed; see force help forceignore.
+
+In a project with several source directories, they're combined into one
+deploy unless -directory is given; see force help project.
 
 Examples:
 
@@ -39,6 +48,8 @@ Examples:
   force import -directory=my_metadata -c -r -v
 
   force import -checkonly -runalltests
+
+  force import -runalltests -reporter junit -reportfile results.xml
 `,
 }
 
@@ -54,6 +65,8 @@ var (
 	ignoreWarningsFlag    = cmdImport.Flag.Bool("ignorewarnings", false, "set ignore warnings")
 	directory             = cmdImport.Flag.String("directory", "metadata", "relative path to package.xml")
 	verbose               = cmdImport.Flag.Bool("verbose", false, "give more verbose output")
+	reportFormat          string
+	reportFile            string
 )
 
 func init() {
@@ -69,60 +82,31 @@ func init() {
 	cmdImport.Flag.BoolVar(ignoreWarningsFlag, "i", false, "set ignore warnings")
 	cmdImport.Flag.StringVar(directory, "d", "metadata", "relative path to package.xml")
 	cmdImport.Flag.Var(&testsToRun, "test", "Test(s) to run")
+	cmdImport.Flag.StringVar(&reportFormat, "reporter", "", "write results to a report file (junit, json)")
+	cmdImport.Flag.StringVar(&reportFile, "reportfile", "", "report file name")
+	cmdImport.Flag.BoolVar(&forcePush, "force", false, "deploy even if changed in the org since fetched")
 }
 
 func runImport(cmd *Command, args []string) {
 	if len(args) > 0 {
 		ErrorAndExit("Unrecognized argument: " + args[0])
 	}
-
-	wd, _ := os.Getwd()
-	usr, err := user.Current()
-	var dir string
-
-	//Manually handle shell expansion short cut
-	if err != nil {
-		if strings.HasPrefix(*directory, "~") {
-			ErrorAndExit("Cannot determine tilde expansion, please use relative or absolute path to directory.")
-		} else {
-			dir = *directory
-		}
-	} else {
-		if strings.HasPrefix(*directory, "~") {
-			dir = strings.Replace(*directory, "~", usr.HomeDir, 1)
-		} else {
-			dir = *directory
-		}
+	if err := ValidateReportFormat(reportFormat); err != nil {
+		ErrorAndExit(err.Error())
 	}
+	Verbose = *verbose
 
-	root := filepath.Join(wd, dir)
-
-	// Check for absolute path
-	if filepath.IsAbs(dir) {
-		root = dir
+	var paths map[string]string
+	var files ForceMetadataFiles
+	var root string
+	if project, err := config.FindProject(); err == nil && !flagSet(cmd, "directory", "d") {
+		files = projectMetadataFiles(project)
+		root = strings.Join(project.SourceDirs(), ", ")
+	} else {
+		paths, files, root = directoryMetadataFiles()
 	}
 
 	force, _ := ActiveForce()
-	files := make(ForceMetadataFiles)
-	if _, err := os.Stat(filepath.Join(root, "package.xml")); os.IsNotExist(err) {
-		ErrorAndExit(" \n" + filepath.Join(root, "package.xml") + "\ndoes not exist")
-	}
-
-	err = filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
-		if f.Mode().IsRegular() {
-			if f.Name() != ".DS_Store" {
-				data, err := ioutil.ReadFile(path)
-				if err != nil {
-					ErrorAndExit(err.Error())
-				}
-				files[strings.Replace(path, fmt.Sprintf("%s%s", root, string(os.PathSeparator)), "", -1)] = data
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		ErrorAndExit(err.Error())
-	}
 	var DeploymentOptions ForceDeployOptions
 	DeploymentOptions.AllowMissingFiles = *allowMissingFilesFlag
 	DeploymentOptions.AutoUpdatePackage = *autoUpdatePackageFlag
@@ -135,8 +119,15 @@ func runImport(cmd *Command, args []string) {
 		DeploymentOptions.TestLevel = "RunAllTestsInOrg"
 	}
 	DeploymentOptions.RunTests = testsToRun
+	DeploymentOptions.IgnoreConflicts = forcePush
+
+	query, err := PackageXmlQuery(importPackageXml(paths, files))
+	if err != nil {
+		ErrorAndExit("Could not read package.xml: %s", err.Error())
+	}
+	CheckDeployConflicts(force, query, &DeploymentOptions)
 
-	result, err := force.Metadata.Deploy(files, DeploymentOptions)
+	result, err := force.Metadata.DeployPaths(paths, files, DeploymentOptions)
 	problems := result.Details.ComponentFailures
 	successes := result.Details.ComponentSuccesses
 	testFailures := result.Details.RunTestResult.TestFailures
@@ -191,6 +182,13 @@ func runImport(cmd *Command, args []string) {
 		}
 	}
 
+	report := NewDeployReport(result, nil)
+	if reportFormat != "" {
+		if err := report.Write(reportFormat, reportFile); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+
 	if len(problems) > 0 {
 		err = errors.New("Some components failed deployment")
 	} else if len(testFailures) > 0 {
@@ -199,7 +197,103 @@ func runImport(cmd *Command, args []string) {
 		err = errors.New(fmt.Sprintf("Status: %s", result.Status))
 	}
 	if err != nil {
-		ErrorAndExit(err.Error())
+		ErrorAndExitWithCode(report.ExitCode(), err.Error())
 	}
+	RecordDeployedMembers(force, query, &DeploymentOptions)
 	fmt.Printf("Imported from %s\n", root)
 }
+
+// Returns the package.xml among the files to deploy.
+func importPackageXml(paths map[string]string, files ForceMetadataFiles) []byte {
+	if data, found := files["package.xml"]; found {
+		return data
+	}
+	data, err := ioutil.ReadFile(paths["package.xml"])
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	return data
+}
+
+// Find the files to deploy in the directory given by -directory, which must
+// contain a package.xml. They're returned by path, to be read as the zip is
+// built, except for decomposed objects, which are recomposed in memory.
+func directoryMetadataFiles() (paths map[string]string, files ForceMetadataFiles, root string) {
+	wd, _ := os.Getwd()
+	usr, err := user.Current()
+	var dir string
+
+	//Manually handle shell expansion short cut
+	if err != nil {
+		if strings.HasPrefix(*directory, "~") {
+			ErrorAndExit("Cannot determine tilde expansion, please use relative or absolute path to directory.")
+		} else {
+			dir = *directory
+		}
+	} else {
+		if strings.HasPrefix(*directory, "~") {
+			dir = strings.Replace(*directory, "~", usr.HomeDir, 1)
+		} else {
+			dir = *directory
+		}
+	}
+
+	root = filepath.Join(wd, dir)
+
+	// Check for absolute path
+	if filepath.IsAbs(dir) {
+		root = dir
+	}
+
+	paths = make(map[string]string)
+	if _, err := os.Stat(filepath.Join(root, "package.xml")); os.IsNotExist(err) {
+		ErrorAndExit(" \n" + filepath.Join(root, "package.xml") + "\ndoes not exist")
+	}
+
+	ignore, err := LoadProjectForceIgnore()
+	if err != nil {
+		ErrorAndExit("Could not read .forceignore: %s", err.Error())
+	}
+	err = filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if path != root && ignore.Ignored(path) {
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if f.Mode().IsRegular() {
+			if f.Name() != ".DS_Store" {
+				paths[strings.Replace(path, fmt.Sprintf("%s%s", root, string(os.PathSeparator)), "", -1)] = path
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	if paths, files, err = RecomposeObjectPaths(paths); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	return
+}
+
+// Combine the project's source directories into one deploy, with a
+// package.xml generated from their contents.
+func projectMetadataFiles(project *config.Project) ForceMetadataFiles {
+	pb := NewPushBuilder()
+	var badPaths []string
+	for _, root := range project.SourceDirs() {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		_, dirBadPaths, err := pb.AddDirectory(root)
+		if err != nil {
+			ErrorAndExit(err.Error())
+		}
+		badPaths = append(badPaths, dirBadPaths...)
+	}
+	if len(badPaths) > 0 {
+		ErrorAndExit("Could not add the following files:\n %s", strings.Join(badPaths, "\n "))
+	}
+	return pb.ForceMetadataFiles()
+}
@@ -0,0 +1,307 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ForceCLI/force/config"
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+)
+
+var cmdManifest = &Command{
+	Run:   runManifest,
+	Usage: "manifest generate [paths] | -org [-t <type>]... [-exclude-managed] | -git <revision> [-destructive <file>]",
+	Short: "Generate a package.xml",
+	Long: `
+Generate a package.xml
+
+From a directory, the package.xml covers every file in the given files and
+directories, or in all source directories if none are given.
+
+With -org, it covers every member of the given types in the org, or of all
+types, as listed by listMetadata.
+
+With -git, it covers the files changed since the given revision, or in the
+given range of revisions, in the source directories. Members whose files
+were all deleted can be written to a destructiveChanges.xml with
+-destructive.
+
+Types and members are sorted, so the output is stable. The package.xml is
+written to standard output unless -output is given.
+
+Options
+  -output, -o        File to write the package.xml to
+  -org               List the members in the org
+  -type, -t          Type of members to list with -org (multiple ok)
+  -exclude-managed   Leave out members installed from managed packages
+  -git               Revision or range of revisions to take changed files from
+  -destructive       File to write a destructiveChanges.xml of deleted members to
+
+Examples:
+
+  force manifest generate -o src/package.xml
+
+  force manifest generate src/classes src/lwc
+
+  force manifest generate -org -t ApexClass -t CustomObject -exclude-managed
+
+  force manifest generate -git main -o package.xml -destructive destructiveChanges.xml
+
+  force manifest generate -git v1.0..v1.1
+`,
+}
+
+var (
+	manifestOutput         string
+	manifestFromOrg        bool
+	manifestTypes          metaName
+	manifestExcludeManaged bool
+	manifestGitRevision    string
+	manifestDestructive    string
+)
+
+func init() {
+	cmdManifest.Flag.StringVar(&manifestOutput, "output", "", "file to write the package.xml to")
+	cmdManifest.Flag.StringVar(&manifestOutput, "o", "", "file to write the package.xml to")
+	cmdManifest.Flag.BoolVar(&manifestFromOrg, "org", false, "list members in the org")
+	cmdManifest.Flag.Var(&manifestTypes, "type", "metadata type to list")
+	cmdManifest.Flag.Var(&manifestTypes, "t", "metadata type to list")
+	cmdManifest.Flag.BoolVar(&manifestExcludeManaged, "exclude-managed", false, "leave out managed package members")
+	cmdManifest.Flag.StringVar(&manifestGitRevision, "git", "", "revision to take changed files from")
+	cmdManifest.Flag.StringVar(&manifestDestructive, "destructive", "", "file to write destructiveChanges.xml to")
+}
+
+func runManifest(cmd *Command, args []string) {
+	if len(args) == 0 || strings.ToLower(args[0]) != "generate" {
+		cmd.PrintUsage()
+		return
+	}
+	if err := cmd.Flag.Parse(args[1:]); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	args = cmd.Flag.Args()
+	if manifestFromOrg && manifestGitRevision != "" {
+		ErrorAndExit("-org and -git can't be used together")
+	}
+	if (manifestFromOrg || manifestGitRevision != "") && len(args) > 0 {
+		ErrorAndExit("Paths can't be given with -org or -git")
+	}
+	if !manifestFromOrg && (len(manifestTypes) > 0 || manifestExcludeManaged) {
+		ErrorAndExit("-type and -exclude-managed require -org")
+	}
+	if manifestGitRevision == "" && manifestDestructive != "" {
+		ErrorAndExit("-destructive requires -git")
+	}
+
+	var query ForceMetadataQuery
+	switch {
+	case manifestFromOrg:
+		query = orgManifestQuery()
+	case manifestGitRevision != "":
+		var deleted ForceMetadataQuery
+		query, deleted = gitManifestQueries(manifestGitRevision)
+		if manifestDestructive != "" {
+			writeManifest(manifestDestructive, manifestBuilder(deleted).DestructiveChangesXml())
+		} else if len(deleted) > 0 {
+			fmt.Fprintln(os.Stderr, "Deleted members are left out; use -destructive to write them to a destructiveChanges.xml")
+		}
+	default:
+		if len(args) == 0 {
+			roots, err := config.SourceDirs()
+			ExitIfNoSourceDir(err)
+			args = roots
+		}
+		_, query = localMetadataFiles(args)
+	}
+	writeManifest(manifestOutput, manifestBuilder(query).PackageXml())
+}
+
+func manifestBuilder(query ForceMetadataQuery) PackageBuilder {
+	pb := NewFetchBuilder()
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			for _, member := range element.Members {
+				pb.AddMetaToPackage(typeName, member)
+			}
+		}
+	}
+	return pb
+}
+
+// Write the manifest to file, or to standard output if file is "".
+func writeManifest(file string, data []byte) {
+	if file == "" {
+		os.Stdout.Write(data)
+		fmt.Println()
+		return
+	}
+	if err := ioutil.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		ErrorAndExit(err.Error())
+	}
+}
+
+// Returns a query listing every member of the types given by -type, or of
+// all types, in the org.
+func orgManifestQuery() (query ForceMetadataQuery) {
+	force, _ := ActiveForce()
+	var typeNames []string
+	if len(manifestTypes) > 0 {
+		for _, name := range manifestTypes {
+			typeNames = append(typeNames, findMetadataTypeOrExit(force, name).Name)
+		}
+	} else {
+		types, err := force.MetadataTypes()
+		if err != nil {
+			ErrorAndExit("Could not get metadata types: %s", err.Error())
+		}
+		for _, t := range types {
+			typeNames = append(typeNames, t.Name)
+			typeNames = append(typeNames, t.ChildXmlNames...)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, typeName := range typeNames {
+		if seen[typeName] {
+			continue
+		}
+		seen[typeName] = true
+		properties, err := force.Metadata.ListAllMembers(typeName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not list %s: %s\n", typeName, err.Error())
+			continue
+		}
+		var members []string
+		for _, p := range properties {
+			if manifestExcludeManaged && IsManagedMember(p) {
+				continue
+			}
+			members = append(members, p.FullName)
+		}
+		if len(members) > 0 {
+			query = append(query, ForceMetadataQueryElement{Name: []string{typeName}, Members: members})
+		}
+	}
+	return
+}
+
+// Returns queries of the members whose files in the source directories
+// changed since the revision, and of the members whose files were all
+// deleted.
+func gitManifestQueries(revision string) (changed ForceMetadataQuery, deleted ForceMetadataQuery) {
+	top, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	top = strings.TrimSpace(top)
+	if resolved, err := filepath.EvalSymlinks(top); err == nil {
+		top = resolved
+	}
+	out, err := gitOutput("diff", "--name-status", "-z", "-M", revision)
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	roots, err := config.SourceDirs()
+	ExitIfNoSourceDir(err)
+
+	var changedPaths, deletedPaths []string
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); {
+		status := fields[i]
+		switch status[0] {
+		case 'R':
+			deletedPaths = append(deletedPaths, filepath.Join(top, fields[i+1]))
+			changedPaths = append(changedPaths, filepath.Join(top, fields[i+2]))
+			i += 3
+		case 'C':
+			changedPaths = append(changedPaths, filepath.Join(top, fields[i+2]))
+			i += 3
+		case 'D':
+			deletedPaths = append(deletedPaths, filepath.Join(top, fields[i+1]))
+			i += 2
+		default:
+			changedPaths = append(changedPaths, filepath.Join(top, fields[i+1]))
+			i += 2
+		}
+	}
+
+	var paths []string
+	deletedMembers := NewFetchBuilder()
+	for _, path := range deletedPaths {
+		root := sourceDirContaining(roots, path)
+		if root == "" || isNotMemberFile(path) {
+			continue
+		}
+		// A member with files left is changed rather than deleted
+		if bundle := ReplaceComponentWithBundle(path); bundle != path {
+			if _, err := os.Stat(bundle); err == nil {
+				paths = append(paths, bundle)
+				continue
+			}
+		}
+		if source := strings.TrimSuffix(path, "-meta.xml"); source != path {
+			if _, err := os.Stat(source); err == nil {
+				paths = append(paths, source)
+				continue
+			}
+		}
+		rel, _ := filepath.Rel(root, path)
+		typeName, member := MetadataMemberForFile(filepath.ToSlash(rel))
+		deletedMembers.AddMetaToPackage(typeName, member)
+	}
+	for _, path := range changedPaths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if sourceDirContaining(roots, path) != "" && !isNotMemberFile(path) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) > 0 {
+		_, changed = localMetadataFiles(paths)
+	}
+
+	// Members with files both changed and deleted aren't deleted
+	inPackage := make(map[MetadataMember]bool)
+	for _, element := range changed {
+		for _, member := range element.Members {
+			inPackage[MetadataMember{Type: element.Name[0], Name: member}] = true
+		}
+	}
+	for _, element := range deletedMembers.Query() {
+		var members []string
+		for _, member := range element.Members {
+			if !inPackage[MetadataMember{Type: element.Name[0], Name: member}] {
+				members = append(members, member)
+			}
+		}
+		if len(members) > 0 {
+			deleted = append(deleted, ForceMetadataQueryElement{Name: element.Name, Members: members})
+		}
+	}
+	return
+}
+
+// Files in source directories that don't belong to any member, including
+// the tooling files in aura and lwc directories and Jest tests.
+func isNotMemberFile(path string) bool {
+	dir := filepath.Base(filepath.Dir(path))
+	return isNotMetadataFile(path) || dir == "aura" || dir == "lwc" ||
+		strings.Contains(filepath.ToSlash(path), "/__tests__/")
+}
+
+func gitOutput(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,123 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ForceCLI/force/config"
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+)
+
+var cmdNormalize = &Command{
+	Run:   runNormalize,
+	Usage: "normalize [-check] [paths]",
+	Short: "Rewrite metadata XML files in canonical form",
+	Long: `
+Rewrite metadata XML files in canonical form
+
+Repeated elements are sorted by their key, e.g. fieldPermissions by field,
+objectPermissions by object and layoutAssignments by layout, elements are
+indented by four spaces, and lines end in \n. Other elements keep their
+order. The content of members with a -meta.xml file, such as classes and
+static resources, and of Aura and Lightning web component bundles is left
+alone. Files with comments, or with elements holding both text and other
+elements, can't be normalized and are reported as errors.
+
+The files in the given files and directories are normalized, or those in all
+source directories if none are given. Files matching .forceignore are
+skipped.
+
+Options
+  -check  List the files that aren't normalized without changing them, and
+          exit with an error if there are any
+
+Examples:
+
+  force normalize
+
+  force normalize src/profiles src/permissionsets
+
+  force normalize -check
+`,
+}
+
+var normalizeCheck bool
+
+func init() {
+	cmdNormalize.Flag.BoolVar(&normalizeCheck, "check", false, "list files that aren't normalized")
+}
+
+func runNormalize(cmd *Command, args []string) {
+	paths := args
+	if len(paths) == 0 {
+		var err error
+		paths, err = config.SourceDirs()
+		ExitIfNoSourceDir(err)
+	}
+	ignore, err := LoadProjectForceIgnore()
+	if err != nil {
+		ErrorAndExit("Could not read .forceignore: %s", err.Error())
+	}
+
+	var changed []string
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !f.Mode().IsRegular() || ignore.Ignored(path) {
+				return nil
+			}
+			isChanged, err := normalizeFile(path)
+			if err != nil {
+				return err
+			}
+			if isChanged {
+				changed = append(changed, path)
+			}
+			return nil
+		})
+		if err != nil {
+			ErrorAndExit(err.Error())
+		}
+	}
+
+	if normalizeCheck {
+		for _, path := range changed {
+			fmt.Println(path)
+		}
+		if len(changed) > 0 {
+			ErrorAndExit("%d files are not normalized", len(changed))
+		}
+		return
+	}
+	fmt.Printf("Normalized %d files\n", len(changed))
+}
+
+// Canonicalize the file if it's metadata XML, returning whether it changed.
+// With -check, the file is left unchanged.
+func normalizeFile(path string) (changed bool, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	_, metaErr := os.Stat(path + "-meta.xml")
+	if !IsMetadataXml(path, data, metaErr == nil) {
+		return
+	}
+	canonical, err := CanonicalizeXml(data)
+	if err != nil {
+		return false, fmt.Errorf("Could not normalize %s: %s", path, err.Error())
+	}
+	if bytes.Equal(canonical, data) {
+		return
+	}
+	if !normalizeCheck {
+		err = ioutil.WriteFile(path, canonical, 0644)
+	}
+	return true, err
+}
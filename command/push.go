@@ -33,6 +33,10 @@ Examples:
   force push -checkonly -test MyClass_Test metadata/classes/MyClass.cls
   force push -n MyApex -n MyObject__c
   git diff HEAD^ --name-only --diff-filter=ACM | force push -f -
+  force push -test MyClass_Test -reporter junit metadata/classes/MyClass.cls
+  force push -l RunLocalTests -min-coverage 85 -min-class-coverage 75 -t ApexClass
+  force push -snapshot rollback-2020-01-02 -t ApexClass
+  force push -f src/objects/Book__c/fields/Title__c.field
 
 Deployment Options
   -rollbackonerror, -r    Indicates whether any failure causes a complete rollback
@@ -44,13 +48,24 @@ Deployment Options
   -test                   Run tests in class (implies -l RunSpecifiedTests)
   -testlevel, -l          Set test level (NoTestRun, RunSpecifiedTests, RunLocalTests, RunAllTestsInOrg)
   -ignorewarnings, -i     Indicates if warnings should fail deployment or not
+  -reporter               Write results to a report file (junit, json)
+  -reportfile             Report file name (default test-results.xml or test-results.json)
+  -min-coverage           Fail unless overall coverage is at least this percentage
+  -min-class-coverage     Fail unless each class has at least this percentage of coverage
+  -verbose, -v            Report files excluded by .forceignore (see force help forceignore)
+  -force                  Deploy even if members were changed in the org since they were fetched
+  -snapshot               Before deploying, write a package to this directory that restores the org's versions (apply it with force rollback)
 `,
 }
 
 var (
-	namePaths     = make(map[string]string)
-	resourcepaths metaName
-	metaFolder    string
+	namePaths        = make(map[string]string)
+	resourcepaths    metaName
+	metaFolders      []string
+	forcePush        bool
+	snapshotDir      string
+	minCoverage      float64
+	minClassCoverage float64
 )
 
 func init() {
@@ -71,6 +86,14 @@ func init() {
 	cmdPush.Flag.BoolVar(autoUpdatePackageFlag, "u", false, "set auto update package")
 	cmdPush.Flag.BoolVar(ignoreWarningsFlag, "ignorewarnings", false, "set ignore warnings")
 	cmdPush.Flag.BoolVar(ignoreWarningsFlag, "i", false, "set ignore warnings")
+	cmdPush.Flag.StringVar(&reportFormat, "reporter", "", "write results to a report file (junit, json)")
+	cmdPush.Flag.StringVar(&reportFile, "reportfile", "", "report file name")
+	cmdPush.Flag.Float64Var(&minCoverage, "min-coverage", 0, "minimum overall coverage percentage")
+	cmdPush.Flag.Float64Var(&minClassCoverage, "min-class-coverage", 0, "minimum coverage percentage of each class")
+	cmdPush.Flag.BoolVar(verbose, "verbose", false, "give more verbose output")
+	cmdPush.Flag.BoolVar(verbose, "v", false, "give more verbose output")
+	cmdPush.Flag.BoolVar(&forcePush, "force", false, "deploy even if changed in the org since fetched")
+	cmdPush.Flag.StringVar(&snapshotDir, "snapshot", "", "directory to write a rollback package to")
 
 	// Ways to push
 	cmdPush.Flag.Var(&resourcepaths, "f", "Path to resource(s)")
@@ -83,18 +106,32 @@ func init() {
 	cmdPush.Run = runPush
 }
 
-func replaceAuraComponentWithBundle(inputPathToFile string) string {
-	dirPart, filePart := filepath.Split(inputPathToFile)
-	dirPart = filepath.Dir(dirPart)
-	if strings.Contains(dirPart, "aura") && filepath.Ext(filePart) != "" && filepath.Base(filepath.Dir(dirPart)) == "aura" {
-		inputPathToFile = dirPart
+// Returns the bundle folder of a file within an aura or lwc bundle, or the
+// path unchanged if it isn't part of a bundle.
+func ReplaceComponentWithBundle(inputPathToFile string) string {
+	if filepath.Ext(inputPathToFile) == "" {
+		return inputPathToFile
+	}
+	dir := filepath.Dir(inputPathToFile)
+	if bundleType := filepath.Base(filepath.Dir(dir)); bundleType == "aura" || bundleType == "lwc" {
+		return dir
 	}
 	return inputPathToFile
 }
 
 func runPush(cmd *Command, args []string) {
+	Verbose = *verbose
+	if err := ValidateReportFormat(reportFormat); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	if (minCoverage > 0 || minClassCoverage > 0) && *testLevelFlag == "NoTestRun" && !*runAllTestsFlag && len(testsToRun) == 0 {
+		ErrorAndExit("-min-coverage and -min-class-coverage require tests to be run")
+	}
 
 	if strings.ToLower(metadataType) == "package" {
+		if snapshotDir != "" {
+			ErrorAndExit("-snapshot cannot be used to push a package")
+		}
 		pushPackage()
 		return
 	}
@@ -121,11 +158,11 @@ func runPush(cmd *Command, args []string) {
 		// or to a folder. If it is a folder, we pickup the resources a different
 		// way than if it's a file.
 
-		// Replace aura file reference with full bundle folder because only the
-		// main component can be deployed by itself.
+		// Replace aura and lwc file references with the full bundle folder
+		// because bundles can only be deployed as a whole.
 		resorucepathsToPush := make(metaName, 0)
 		for _, fsPath := range resourcepaths {
-			resorucepathsToPush = append(resorucepathsToPush, replaceAuraComponentWithBundle(fsPath))
+			resorucepathsToPush = append(resorucepathsToPush, ReplaceComponentWithBundle(fsPath))
 		}
 		resourcepaths = resorucepathsToPush
 
@@ -148,11 +185,17 @@ func runPush(cmd *Command, args []string) {
 
 func isValidMetadataType() {
 	fmt.Printf("Validating and deploying push...\n")
-	// Look to see if we can find any resource for that metadata type
-	root, err := config.GetSourceDir()
+	// Look to see if we can find any resource for that metadata type in
+	// each of the source directories
+	roots, err := config.SourceDirs()
 	ExitIfNoSourceDir(err)
-	metaFolder = findMetadataTypeFolder(metadataType, root)
-	if metaFolder == "" {
+	metaFolders = nil
+	for _, root := range roots {
+		if metaFolder := findMetadataTypeFolder(metadataType, root); metaFolder != "" {
+			metaFolders = append(metaFolders, metaFolder)
+		}
+	}
+	if len(metaFolders) == 0 {
 		ErrorAndExit("No folders that contain %s metadata could be found.", metadataType)
 	}
 }
@@ -165,8 +208,14 @@ func metadataExists() {
 		message := ""
 		// Go throug the metadata folder to find the named resources
 		for _, name := range metadataName {
-			if len(wildCardSearch(metaFolder, strings.Split(name, ".")[0])) == 0 {
-				message += fmt.Sprintf("\nINVALID: No resource named %s found in %s", name, metaFolder)
+			found := false
+			for _, metaFolder := range metaFolders {
+				if len(wildCardSearch(metaFolder, strings.Split(name, ".")[0])) > 0 {
+					found = true
+				}
+			}
+			if !found {
+				message += fmt.Sprintf("\nINVALID: No resource named %s found in %s", name, strings.Join(metaFolders, ", "))
 				valid = false
 			}
 		}
@@ -247,7 +296,7 @@ func findMetadataTypeFolder(mdtype string, root string) (folder string) {
 		if firstEl == mdtype {
 			// This is sufficient for MD that does not have sub folders (classes, pages, etc)
 			// It is NOT sufficient for aura bundles
-			if mdtype == "AuraDefinitionBundle" {
+			if mdtype == "AuraDefinitionBundle" || mdtype == "LightningComponentBundle" {
 				// Need the parent of this folder to get all aura bundles in the directory
 				folder = filepath.Dir(filepath.Dir(path))
 			} else {
@@ -310,12 +359,23 @@ func FilenameMatchesMetadataName(filename string, metadataName string) bool {
 // static resource so that it can repack them and update the actual ".resource"
 // file.
 func pushByMetadataType() {
-	// TODO: get all files that match these types and make a list out of them
-
-	// Walk the metaFolder obtained during validation and compile a list of resources
-	// to be added to the package.
+	// Walk the metaFolders obtained during validation and compile a list of
+	// resources to be added to the package.
 	var files []string
+	for _, metaFolder := range metaFolders {
+		files = append(files, metadataTypeFiles(metaFolder)...)
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	// Push these files to the package maker/sender
+	PushByPaths(files, true, namePaths, deployOpts())
+}
 
+// Returns the files in metaFolder matching the -name flags, if any. Aura
+// bundles are pushed as they're found.
+func metadataTypeFiles(metaFolder string) (files []string) {
 	// Handle aura separately
 	if filepath.Base(metaFolder) == "aura" {
 		cur := ""
@@ -333,7 +393,34 @@ func pushByMetadataType() {
 		return
 	}
 
+	// Lightning web components are deployed as whole bundles
+	if filepath.Base(metaFolder) == "lwc" {
+		bundles, _ := ioutil.ReadDir(metaFolder)
+		for _, bundle := range bundles {
+			if !bundle.IsDir() || bundle.Name() == "__tests__" {
+				continue
+			}
+			if len(metadataName) == 0 {
+				files = append(files, filepath.Join(metaFolder, bundle.Name()))
+				continue
+			}
+			for _, name := range metadataName {
+				if bundle.Name() == name {
+					files = append(files, filepath.Join(metaFolder, bundle.Name()))
+				}
+			}
+		}
+		return
+	}
+
 	filepath.Walk(metaFolder, func(path string, f os.FileInfo, err error) error {
+		// Decomposed objects are pushed as their directories
+		if f.IsDir() && IsDecomposedObjectDir(path) {
+			if len(metadataName) == 0 || containsString(metadataName, f.Name()) {
+				files = append(files, path)
+			}
+			return filepath.SkipDir
+		}
 		// Check to see if this is a folder. This will be the case with static resources
 		// that have been unpacked.  Not entirely sure if this is the only time we will
 		// find a folder inside a metadata type folder.
@@ -381,9 +468,7 @@ func pushByMetadataType() {
 
 		return nil
 	})
-
-	// Push these files to the package maker/sender
-	PushByPaths(files, true, namePaths, deployOpts())
+	return
 }
 
 // Just zip up what ever is in the path
@@ -431,5 +516,11 @@ func deployOpts() *ForceDeployOptions {
 		opts.TestLevel = "RunAllTestsInOrg"
 	}
 	opts.RunTests = testsToRun
+	opts.ReportFormat = reportFormat
+	opts.ReportFile = reportFile
+	opts.MinCoverage = minCoverage
+	opts.MinClassCoverage = minClassCoverage
+	opts.IgnoreConflicts = forcePush
+	opts.Snapshot = snapshotDir
 	return &opts
 }
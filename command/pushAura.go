@@ -94,10 +94,10 @@ func pushAuraComponent(fname string) {
 
 func isValidAuraExtension(fname string) bool {
 	var ext = strings.Trim(strings.ToLower(filepath.Ext(fname)), " ")
-	if ext == ".app" || ext == ".cmp" || ext == ".evt" || ext == ".intf" {
+	if ext == ".app" || ext == ".cmp" || ext == ".evt" || ext == ".intf" || ext == ".tokens" {
 		return true
 	} else {
-		ErrorAndExit("You need to create an application (.app) or component (.cmp) or and event (.evt) as the first item in your bundle.")
+		ErrorAndExit("You need to create an application (.app), component (.cmp), event (.evt), interface (.intf) or tokens (.tokens) as the first item in your bundle.")
 	}
 	return false
 }
@@ -281,6 +281,9 @@ func getFormatByresourcepath(resourcepath string) (format string, defType string
 		} else if filepath.Ext(fname) == ".auradoc" {
 			format = "XML"
 			defType = "DOCUMENTATION"
+		} else if filepath.Ext(fname) == ".tokens" {
+			format = "XML"
+			defType = "TOKENS"
 		} else {
 			ErrorAndExit("Could not determine aura definition type.", fname)
 		}
@@ -25,4 +25,16 @@ var _ = Describe("Push", func() {
 		})
 	})
 
+	Describe("ReplaceComponentWithBundle", func() {
+		It("should replace aura files with their bundle", func() {
+			Expect(ReplaceComponentWithBundle("src/aura/myCmp/myCmpController.js")).To(Equal("src/aura/myCmp"))
+		})
+		It("should replace lwc files with their bundle", func() {
+			Expect(ReplaceComponentWithBundle("src/lwc/myCmp/myCmp.js-meta.xml")).To(Equal("src/lwc/myCmp"))
+		})
+		It("should not change other files", func() {
+			Expect(ReplaceComponentWithBundle("src/classes/MyClass.cls")).To(Equal("src/classes/MyClass.cls"))
+			Expect(ReplaceComponentWithBundle("src/lwc/myCmp")).To(Equal("src/lwc/myCmp"))
+		})
+	})
 })
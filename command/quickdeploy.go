@@ -3,6 +3,7 @@ package command
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	. "github.com/ForceCLI/force/error"
 	. "github.com/ForceCLI/force/lib"
@@ -16,12 +17,16 @@ Quick deploy validation id
 
 Deployment Options
   -verbose, -v	  Provide detailed feedback on operation
+  -reporter       Write results to a report file (junit, json)
+  -reportfile     Report file name (default test-results.xml or test-results.json)
 
 Examples:
 
   force quickdeploy 0Af1200000FFbBzCAL
 
   force quickdeploy -v 0Af0b000000ZvXH
+
+  force quickdeploy -reporter json 0Af0b000000ZvXH
 `,
 }
 
@@ -32,6 +37,8 @@ var (
 func init() {
 	cmdQuickDeploy.Run = runQuickDeploy
 	cmdQuickDeploy.Flag.BoolVar(verboseFlag, "v", false, "give more verbose output")
+	cmdQuickDeploy.Flag.StringVar(&reportFormat, "reporter", "", "write results to a report file (junit, json)")
+	cmdQuickDeploy.Flag.StringVar(&reportFile, "reportfile", "", "report file name")
 }
 
 func runQuickDeploy(cmd *Command, args []string) {
@@ -39,6 +46,9 @@ func runQuickDeploy(cmd *Command, args []string) {
 		ErrorAndExit("The quickdeploy command only accepts a single validation id")
 	}
 	quickDeployId := args[0]
+	if err := ValidateReportFormat(reportFormat); err != nil {
+		ErrorAndExit(err.Error())
+	}
 
 	force, err := ActiveForce()
 	if err != nil {
@@ -79,13 +89,19 @@ func runQuickDeploy(cmd *Command, args []string) {
 			}
 		}
 	}
+	report := NewDeployReport(result, nil)
+	if reportFormat != "" {
+		if err := report.Write(reportFormat, reportFile); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
 	if len(problems) > 0 {
 		err = errors.New("Some components failed deployment")
 	} else if !result.Success {
 		err = errors.New(fmt.Sprintf("Status: %s", result.Status))
 	}
 	if err != nil {
-		ErrorAndExit(err.Error())
+		ErrorAndExitWithCode(report.ExitCode(), err.Error())
 	}
 	fmt.Printf("Deploy Id %s\n", result.Id)
 }
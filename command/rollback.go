@@ -0,0 +1,58 @@
+package command
+
+import (
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+)
+
+var cmdRollback = &Command{
+	Run:   runRollback,
+	Usage: "rollback [deployment options] <directory>",
+	Short: "Deploy a rollback snapshot written by push -snapshot",
+	Long: `
+Deploy a rollback snapshot written by push -snapshot
+
+Restores the versions of the members that were in the org before the push,
+and deletes the members that the push created.
+
+Deployment Options
+  -checkonly, -c          Validate the rollback without saving it
+  -purgeondelete, -p      If set the deleted components are not stored in recycle bin
+  -test                   Run tests in class (implies -l RunSpecifiedTests)
+  -testlevel, -l          Set test level (NoTestRun, RunSpecifiedTests, RunLocalTests, RunAllTestsInOrg)
+  -ignorewarnings, -i     Indicates if warnings should fail deployment or not
+  -reporter               Write results to a report file (junit, json)
+  -reportfile             Report file name (default test-results.xml or test-results.json)
+
+Examples:
+
+  force push -snapshot rollback-2020-01-02 -t ApexClass
+  force rollback rollback-2020-01-02
+
+  force rollback -checkonly -l RunLocalTests rollback-2020-01-02
+`,
+}
+
+func init() {
+	cmdRollback.Flag.BoolVar(checkOnlyFlag, "checkonly", false, "set check only")
+	cmdRollback.Flag.BoolVar(checkOnlyFlag, "c", false, "set check only")
+	cmdRollback.Flag.BoolVar(purgeOnDeleteFlag, "purgeondelete", false, "set purge on delete")
+	cmdRollback.Flag.BoolVar(purgeOnDeleteFlag, "p", false, "set purge on delete")
+	cmdRollback.Flag.Var(&testsToRun, "test", "Test(s) to run")
+	cmdRollback.Flag.StringVar(testLevelFlag, "testlevel", "NoTestRun", "set test level")
+	cmdRollback.Flag.StringVar(testLevelFlag, "l", "NoTestRun", "set test level")
+	cmdRollback.Flag.BoolVar(ignoreWarningsFlag, "ignorewarnings", false, "set ignore warnings")
+	cmdRollback.Flag.BoolVar(ignoreWarningsFlag, "i", false, "set ignore warnings")
+	cmdRollback.Flag.StringVar(&reportFormat, "reporter", "", "write results to a report file (junit, json)")
+	cmdRollback.Flag.StringVar(&reportFile, "reportfile", "", "report file name")
+}
+
+func runRollback(cmd *Command, args []string) {
+	if len(args) != 1 {
+		ErrorAndExit("Specify the snapshot directory to roll back to")
+	}
+	if err := ValidateReportFormat(reportFormat); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	DeployRollbackSnapshot(args[0], deployOpts())
+}
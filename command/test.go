@@ -2,7 +2,10 @@ package command
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/ForceCLI/force/config"
 	"github.com/ForceCLI/force/desktop"
 	. "github.com/ForceCLI/force/error"
 	. "github.com/ForceCLI/force/lib"
@@ -10,7 +13,7 @@ import (
 )
 
 var cmdTest = &Command{
-	Usage: "test (all | classname... | classname.method...)",
+	Usage: "test (all | classname... | classname.method...) [-suite=suite]",
 	Short: "Run apex tests",
 	Long: `
 Run apex tests
@@ -19,6 +22,19 @@ Test Options
   -namespace=<namespace>     Select namespace to run test from
   -class=class               Select class to run tests from
   -v                         Verbose logging
+  -reporter=junit|json       Write results to a report file
+  -reportfile=file           Report file name (default test-results.xml or test-results.json)
+  -coverage=cobertura,lcov   Write line coverage of the tested classes (coverage.xml, lcov.info)
+  -coveragedir=dir           Directory to write coverage files to (default current directory)
+  -async                     Run tests asynchronously through the Tooling API, printing
+                             results as each test class finishes
+  -suite=suite               Run a test suite; may be repeated (implies -async)
+  -maxfailedtests=n          Stop after n test failures (implies -async)
+  -skipcodecoverage          Don't calculate code coverage (implies -async)
+  -min-coverage=n            Fail unless overall coverage is at least n percent
+  -min-class-coverage=n      Fail unless each class has at least n percent coverage
+  -fail-on-coverage-warnings
+                             Fail if Salesforce reports code coverage warnings
 
 Examples:
 
@@ -28,18 +44,43 @@ Examples:
   force test -namespace=ns Test4
   force test -class=Test1 method1 method2
   force test -v Test1
+  force test -reporter=junit -reportfile=results.xml all
+  force test -coverage=cobertura -coverage=lcov -coveragedir=build all
+  force test -async Test1.method1 Test2.method2
+  force test -suite=Smoke -suite=Regression
+  force test -async -maxfailedtests=5 -skipcodecoverage all
+  force test -min-coverage=85 -min-class-coverage=75 all
+  force test -fail-on-coverage-warnings all
 `,
 }
 
 func init() {
 	cmdTest.Flag.BoolVar(&verboselogging, "v", false, "set verbose logging")
+	cmdTest.Flag.StringVar(&reportFormat, "reporter", "", "write results to a report file (junit, json)")
+	cmdTest.Flag.StringVar(&reportFile, "reportfile", "", "report file name")
+	cmdTest.Flag.Var(&coverageFormats, "coverage", "write line coverage (cobertura, lcov)")
+	cmdTest.Flag.StringVar(&coverageDir, "coveragedir", ".", "directory to write coverage files to")
+	cmdTest.Flag.BoolVar(&asyncTests, "async", false, "run tests asynchronously")
+	cmdTest.Flag.Var(&testSuites, "suite", "test suite to run")
+	cmdTest.Flag.IntVar(&maxFailedTests, "maxfailedtests", -1, "stop after this many test failures")
+	cmdTest.Flag.BoolVar(&skipCodeCoverage, "skipcodecoverage", false, "don't calculate code coverage")
+	cmdTest.Flag.Float64Var(&minCoverage, "min-coverage", 0, "minimum overall coverage percentage")
+	cmdTest.Flag.Float64Var(&minClassCoverage, "min-class-coverage", 0, "minimum coverage percentage of each class")
+	cmdTest.Flag.BoolVar(&failOnCoverageWarnings, "fail-on-coverage-warnings", false, "fail if there are code coverage warnings")
 	cmdTest.Run = runTests
 }
 
 var (
-	namespaceTestFlag = cmdTest.Flag.String("namespace", "", "namespace to run tests in")
-	classFlag         = cmdTest.Flag.String("class", "", "class to run tests from")
-	verboselogging    bool
+	namespaceTestFlag      = cmdTest.Flag.String("namespace", "", "namespace to run tests in")
+	classFlag              = cmdTest.Flag.String("class", "", "class to run tests from")
+	verboselogging         bool
+	coverageFormats        metaName
+	coverageDir            string
+	asyncTests             bool
+	testSuites             metaName
+	maxFailedTests         int
+	skipCodeCoverage       bool
+	failOnCoverageWarnings bool
 )
 
 func RunTests(testRunner TestRunner, tests []string, namespace string) (output TestCoverage, err error) {
@@ -66,6 +107,10 @@ func QualifyMethods(class string, methods []string) []string {
 }
 
 func GenerateResults(output TestCoverage) string {
+	return generateCoverage(output) + generateTestResults(output)
+}
+
+func generateCoverage(output TestCoverage) string {
 	var results []string
 	var percent int
 	results = append(results, "Coverage:")
@@ -83,6 +128,11 @@ func GenerateResults(output TestCoverage) string {
 	}
 	results = append(results, "")
 	results = append(results, "")
+	return strings.Join(results, "\n") + "\n"
+}
+
+func generateTestResults(output TestCoverage) string {
+	var results []string
 	results = append(results, "Results:")
 	results = append(results, "")
 	for index := range output.SMethodNames {
@@ -102,14 +152,34 @@ func GenerateResults(output TestCoverage) string {
 }
 
 func runTests(cmd *Command, args []string) {
-	if len(args) < 1 && *classFlag == "" {
+	async := asyncTests || len(testSuites) > 0 || maxFailedTests >= 0 || skipCodeCoverage
+	if len(args) < 1 && *classFlag == "" && len(testSuites) == 0 {
 		ErrorAndExit("must specify tests to run")
 	}
+	if err := ValidateReportFormat(reportFormat); err != nil {
+		ErrorAndExit(err.Error())
+	}
+	if skipCodeCoverage && (minCoverage > 0 || minClassCoverage > 0) {
+		ErrorAndExit("-skipcodecoverage cannot be combined with -min-coverage or -min-class-coverage")
+	}
+	for _, format := range coverageFormats {
+		if _, found := coverageFiles[strings.ToLower(format)]; !found {
+			ErrorAndExit("Unknown coverage format %q; use cobertura or lcov", format)
+		}
+	}
 	force, _ := ActiveForce()
 	if *classFlag != "" {
 		args = QualifyMethods(*classFlag, args)
 	}
-	output, err := RunTests(force.Partner, args, *namespaceTestFlag)
+	var testRunner TestRunner = force.Partner
+	if async {
+		runner := NewAsyncTestRunner(force)
+		runner.Suites = testSuites
+		runner.MaxFailedTests = maxFailedTests
+		runner.SkipCodeCoverage = skipCodeCoverage
+		testRunner = runner
+	}
+	output, err := RunTests(testRunner, args, *namespaceTestFlag)
 
 	if err != nil {
 		ErrorAndExit(err.Error())
@@ -119,13 +189,104 @@ func runTests(cmd *Command, args []string) {
 		fmt.Println()
 	}
 
-	results := GenerateResults(output)
-	fmt.Print(results)
+	if async {
+		// Test results were printed as each class finished
+		fmt.Print(generateCoverage(output))
+	} else {
+		fmt.Print(GenerateResults(output))
+	}
+
+	report := NewTestReport(output)
+	if reportFormat != "" {
+		if err := report.Write(reportFormat, reportFile); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+
+	if len(coverageFormats) > 0 {
+		if err := writeCoverageFiles(force, output.Name); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
 
 	success := len(output.FMethodNames) == 0
 	// Handle notifications
 	desktop.NotifySuccess("test", success)
-	if !success {
-		ErrorAndExit("Tests Failed")
+	if code := report.ExitCode(); code != 0 {
+		ErrorAndExitWithCode(code, "Tests Failed")
+	}
+	if minCoverage > 0 || minClassCoverage > 0 {
+		gate := CheckCoverage(ClassCoverageFromTestResults(output), minCoverage, minClassCoverage)
+		if !gate.Passed() {
+			ErrorAndExitWithCode(ExitCodeCoverageGate, "%s", gate.String())
+		}
 	}
+	if failOnCoverageWarnings && len(report.CoverageWarnings) > 0 {
+		var messages []string
+		for _, warning := range report.CoverageWarnings {
+			messages = append(messages, warning.Message)
+		}
+		ErrorAndExitWithCode(ExitCodeCoverageWarnings, "Code coverage warnings:\n  %s", strings.Join(messages, "\n  "))
+	}
+}
+
+var coverageFiles = map[string]string{
+	"cobertura": "coverage.xml",
+	"lcov":      "lcov.info",
+}
+
+// Write line coverage of the named classes and triggers in each of the
+// requested coverage formats.
+func writeCoverageFiles(force *Force, names []string) (err error) {
+	if len(names) == 0 {
+		return
+	}
+	coverage, err := force.GetCodeCoverageAggregate(names)
+	if err != nil {
+		return fmt.Errorf("Could not get code coverage: %s", err.Error())
+	}
+	sourceDir, err := relativeSourceDir()
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(coverageDir, 0755); err != nil {
+		return
+	}
+	for _, format := range coverageFormats {
+		format = strings.ToLower(format)
+		fileName := filepath.Join(coverageDir, coverageFiles[format])
+		var f *os.File
+		if f, err = os.Create(fileName); err != nil {
+			return
+		}
+		if format == "lcov" {
+			err = WriteLcov(f, coverage, sourceDir)
+		} else {
+			err = WriteCobertura(f, coverage, sourceDir)
+		}
+		f.Close()
+		if err != nil {
+			return
+		}
+		fmt.Printf("Wrote %s coverage to %s\n", format, fileName)
+	}
+	return
+}
+
+// Returns the metadata source directory relative to the current directory,
+// so that coverage reports can be used on other machines.
+func relativeSourceDir() (dir string, err error) {
+	root, err := config.GetSourceDir()
+	if err != nil {
+		return
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	dir, err = filepath.Rel(wd, root)
+	if err != nil {
+		dir, err = root, nil
+	}
+	return
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"os/user"
 	"path/filepath"
 
 	"github.com/ForceCLI/config"
@@ -27,7 +28,50 @@ func IsSourceDir(dir string) bool {
 // relative to the current directory. GetSourceDir will look for a source
 // directory in the nearest subdirectory. If no such directory exists, it will
 // look at its parents, assuming that it is within a source directory already.
+// In a project with a project file, it returns the default source directory,
+// creating it if necessary.
 func GetSourceDir() (dir string, err error) {
+	if project, projectErr := FindProject(); projectErr == nil {
+		dir = project.DefaultSourceDir()
+		err = os.MkdirAll(dir, 0777)
+		return
+	} else if !os.IsNotExist(projectErr) {
+		err = projectErr
+		return
+	}
+	dir, err = FindSourceDir()
+	if err == nil || !os.IsNotExist(err) {
+		return
+	}
+	base, err := os.Getwd()
+	if err != nil {
+		return
+	}
+
+	// No source directory found, create a src directory and a symlinked "metadata"
+	// directory for backward compatibility and return that.
+	dir = filepath.Join(base, "src")
+	err = os.Mkdir(dir, 0777)
+	symlink := filepath.Join(base, "metadata")
+	os.Symlink(dir, symlink)
+	dir = symlink
+	return
+}
+
+// FindSourceDir looks for the Salesforce source directory like GetSourceDir,
+// but returns an error satisfying os.IsNotExist instead of creating one.
+func FindSourceDir() (dir string, err error) {
+	if project, projectErr := FindProject(); projectErr == nil {
+		dir = project.DefaultSourceDir()
+		if !IsSourceDir(dir) {
+			dir = ""
+			err = os.ErrNotExist
+		}
+		return
+	} else if !os.IsNotExist(projectErr) {
+		err = projectErr
+		return
+	}
 	base, err := os.Getwd()
 	if err != nil {
 		return
@@ -57,12 +101,53 @@ func GetSourceDir() (dir string, err error) {
 		}
 	}
 
-	// No source directory found, create a src directory and a symlinked "metadata"
-	// directory for backward compatibility and return that.
-	dir = filepath.Join(base, "src")
-	err = os.Mkdir(dir, 0777)
-	symlink := filepath.Join(base, "metadata")
-	os.Symlink(dir, symlink)
-	dir = symlink
+	dir = ""
+	err = os.ErrNotExist
+	return
+}
+
+// SourceDirs returns all of the Salesforce source directories: those
+// declared in the project file, default first, or the one found by
+// FindSourceDir.
+func SourceDirs() (dirs []string, err error) {
+	if project, projectErr := FindProject(); projectErr == nil {
+		dirs = project.SourceDirs()
+		return
+	} else if !os.IsNotExist(projectErr) {
+		err = projectErr
+		return
+	}
+	dir, err := FindSourceDir()
+	if err != nil {
+		return
+	}
+	dirs = []string{dir}
+	return
+}
+
+// ProjectDir returns the directory containing the project file or the
+// Salesforce source directory, or the current directory if there is neither.
+func ProjectDir() (dir string, err error) {
+	if project, projectErr := FindProject(); projectErr == nil {
+		dir = project.Dir
+		return
+	}
+	if dir, err = FindSourceDir(); err == nil {
+		dir = filepath.Dir(dir)
+		return
+	}
+	return os.Getwd()
+}
+
+// TemplateDirs returns the directories searched for templates used by
+// force create, most specific first: .force/templates in the project
+// directory, then .force/templates in the user's home directory.
+func TemplateDirs() (dirs []string) {
+	if project, err := ProjectDir(); err == nil {
+		dirs = append(dirs, filepath.Join(project, ".force", "templates"))
+	}
+	if usr, err := user.Current(); err == nil {
+		dirs = append(dirs, filepath.Join(usr.HomeDir, ".force", "templates"))
+	}
 	return
 }
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProjectFileName is the name of the file declaring a project's source
+// directories, e.g.
+//
+//	{
+//	  "packageDirectories": [
+//	    {"path": "core/src", "default": true},
+//	    {"path": "integrations/src"},
+//	    {"path": "unpackaged"}
+//	  ]
+//	}
+const ProjectFileName = "force-project.json"
+
+type PackageDirectory struct {
+	Path    string `json:"path"`
+	Default bool   `json:"default,omitempty"`
+}
+
+type Project struct {
+	// Directory containing the project file
+	Dir                string             `json:"-"`
+	PackageDirectories []PackageDirectory `json:"packageDirectories"`
+}
+
+// FindProject looks for a project file in the current directory and its
+// parents, falling back to the sourceDirs of the project configuration. It
+// returns an error satisfying os.IsNotExist if there is neither.
+func FindProject() (project *Project, err error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for {
+		fileName := filepath.Join(dir, ProjectFileName)
+		if _, statErr := os.Stat(fileName); statErr == nil {
+			return LoadProject(fileName)
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	if pc, pcErr := FindProjectConfig(); pcErr == nil && len(pc.SourceDirs) > 0 {
+		project = &Project{Dir: pc.Dir}
+		for i, path := range pc.SourceDirs {
+			project.PackageDirectories = append(project.PackageDirectories, PackageDirectory{Path: path, Default: i == 0})
+		}
+		return
+	}
+	err = os.ErrNotExist
+	return
+}
+
+// LoadProject reads the project file fileName.
+func LoadProject(fileName string) (project *Project, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	project = &Project{}
+	if err = json.Unmarshal(data, project); err != nil {
+		err = fmt.Errorf("Could not parse %s: %s", fileName, err.Error())
+		return
+	}
+	if len(project.PackageDirectories) == 0 {
+		err = fmt.Errorf("%s does not declare any packageDirectories", fileName)
+		return
+	}
+	project.Dir, err = filepath.Abs(filepath.Dir(fileName))
+	return
+}
+
+// SourceDirs returns the absolute paths of the project's source
+// directories, default first.
+func (p *Project) SourceDirs() (dirs []string) {
+	dirs = append(dirs, p.DefaultSourceDir())
+	for _, pd := range p.PackageDirectories {
+		dir := p.path(pd)
+		if dir != dirs[0] {
+			dirs = append(dirs, dir)
+		}
+	}
+	return
+}
+
+// DefaultSourceDir returns the source directory marked as the default, or
+// the first one. New metadata is written there.
+func (p *Project) DefaultSourceDir() string {
+	for _, pd := range p.PackageDirectories {
+		if pd.Default {
+			return p.path(pd)
+		}
+	}
+	return p.path(p.PackageDirectories[0])
+}
+
+func (p *Project) path(pd PackageDirectory) string {
+	if filepath.IsAbs(pd.Path) {
+		return filepath.Clean(pd.Path)
+	}
+	return filepath.Join(p.Dir, filepath.FromSlash(pd.Path))
+}
+
+// OwningSourceDir returns the source directory that already contains the
+// metadata file name, a path relative to a source directory such as
+// classes/Foo.cls, or the default source directory if none does. Files in
+// bundles and folders are routed with the bundle or folder, and a -meta.xml
+// file with the file it describes.
+func (p *Project) OwningSourceDir(name string) string {
+	name = filepath.Clean(filepath.FromSlash(name))
+	candidates := []string{name}
+	if strings.HasSuffix(name, "-meta.xml") {
+		candidates = append(candidates, strings.TrimSuffix(name, "-meta.xml"))
+	} else {
+		candidates = append(candidates, name+"-meta.xml")
+	}
+	// The member directory, e.g. lwc/myComponent or documents/MyFolder
+	parts := strings.Split(name, string(os.PathSeparator))
+	if len(parts) > 2 {
+		candidates = append(candidates, filepath.Join(parts[0], parts[1]))
+	}
+	for _, candidate := range candidates {
+		for _, dir := range p.SourceDirs() {
+			if _, err := os.Stat(filepath.Join(dir, candidate)); err == nil {
+				return dir
+			}
+		}
+	}
+	return p.DefaultSourceDir()
+}
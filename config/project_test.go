@@ -0,0 +1,71 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/ForceCLI/force/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Project", func() {
+	var (
+		projectDir string
+		project    *Project
+	)
+
+	BeforeEach(func() {
+		projectDir, _ = ioutil.TempDir("", "project-test")
+		projectDir, _ = filepath.EvalSymlinks(projectDir)
+		ioutil.WriteFile(filepath.Join(projectDir, ProjectFileName), []byte(`{
+			"packageDirectories": [
+				{"path": "core"},
+				{"path": "integrations"},
+				{"path": "unpackaged", "default": true}
+			]
+		}`), 0644)
+		os.MkdirAll(filepath.Join(projectDir, "core", "classes"), 0755)
+		ioutil.WriteFile(filepath.Join(projectDir, "core", "classes", "Core.cls"), []byte(""), 0644)
+		os.MkdirAll(filepath.Join(projectDir, "integrations", "lwc", "sync"), 0755)
+		var err error
+		project, err = LoadProject(filepath.Join(projectDir, ProjectFileName))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(projectDir)
+	})
+
+	It("should list the default source directory first", func() {
+		Expect(project.SourceDirs()).To(Equal([]string{
+			filepath.Join(projectDir, "unpackaged"),
+			filepath.Join(projectDir, "core"),
+			filepath.Join(projectDir, "integrations"),
+		}))
+	})
+
+	It("should route files to the source directory that has them", func() {
+		Expect(project.OwningSourceDir("classes/Core.cls")).To(Equal(filepath.Join(projectDir, "core")))
+		Expect(project.OwningSourceDir("classes/Core.cls-meta.xml")).To(Equal(filepath.Join(projectDir, "core")))
+		Expect(project.OwningSourceDir("lwc/sync/sync.js")).To(Equal(filepath.Join(projectDir, "integrations")))
+	})
+
+	It("should route new files to the default source directory", func() {
+		Expect(project.OwningSourceDir("classes/New.cls")).To(Equal(filepath.Join(projectDir, "unpackaged")))
+	})
+
+	It("should be found from a subdirectory", func() {
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		os.Chdir(filepath.Join(projectDir, "core", "classes"))
+		found, err := FindProject()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found.Dir).To(Equal(projectDir))
+		dir, err := GetSourceDir()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dir).To(Equal(filepath.Join(projectDir, "unpackaged")))
+	})
+})
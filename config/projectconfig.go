@@ -0,0 +1,262 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProjectConfigFile is the path of the project configuration file relative
+// to the project directory. It's found by looking in the current directory
+// and its parents.
+var ProjectConfigFile = filepath.Join(".force", "config.json")
+
+// ProjectConfig holds a repository's defaults for the flags that would
+// otherwise have to be given on every call.
+type ProjectConfig struct {
+	// Directory containing .force/config.json
+	Dir              string        `json:"-"`
+	Account          string        `json:"account,omitempty"`
+	ApiVersion       string        `json:"apiVersion,omitempty"`
+	SourceDirs       []string      `json:"sourceDirs,omitempty"`
+	QueryFormat      string        `json:"queryFormat,omitempty"`
+	Normalize        *bool         `json:"normalize,omitempty"`
+	DecomposeObjects *bool         `json:"decomposeObjects,omitempty"`
+	Deploy           *DeployConfig `json:"deploy,omitempty"`
+}
+
+// DeployConfig holds defaults for the deploy options of push and import.
+// Unset options keep the flags' defaults.
+type DeployConfig struct {
+	AllowMissingFiles *bool    `json:"allowMissingFiles,omitempty"`
+	AutoUpdatePackage *bool    `json:"autoUpdatePackage,omitempty"`
+	CheckOnly         *bool    `json:"checkOnly,omitempty"`
+	IgnoreWarnings    *bool    `json:"ignoreWarnings,omitempty"`
+	PurgeOnDelete     *bool    `json:"purgeOnDelete,omitempty"`
+	RollbackOnError   *bool    `json:"rollbackOnError,omitempty"`
+	RunTests          []string `json:"runTests,omitempty"`
+	TestLevel         string   `json:"testLevel,omitempty"`
+}
+
+type settingKind int
+
+const (
+	stringSetting settingKind = iota
+	boolSetting
+	listSetting
+)
+
+// The settings that can be managed with force config, by key.
+var projectSettings = map[string]settingKind{
+	"account":                  stringSetting,
+	"apiVersion":               stringSetting,
+	"sourceDirs":               listSetting,
+	"queryFormat":              stringSetting,
+	"normalize":                boolSetting,
+	"decomposeObjects":         boolSetting,
+	"deploy.allowMissingFiles": boolSetting,
+	"deploy.autoUpdatePackage": boolSetting,
+	"deploy.checkOnly":         boolSetting,
+	"deploy.ignoreWarnings":    boolSetting,
+	"deploy.purgeOnDelete":     boolSetting,
+	"deploy.rollbackOnError":   boolSetting,
+	"deploy.runTests":          listSetting,
+	"deploy.testLevel":         stringSetting,
+}
+
+// ProjectSettingKeys returns the keys of the project settings, sorted.
+func ProjectSettingKeys() (keys []string) {
+	for key := range projectSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// FindProjectConfig looks for .force/config.json in the current directory
+// and its parents, not including the home directory, where .force holds the
+// global settings. It returns an error satisfying os.IsNotExist if there is
+// none.
+func FindProjectConfig() (pc *ProjectConfig, err error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	home := ""
+	if usr, userErr := user.Current(); userErr == nil {
+		home = usr.HomeDir
+	}
+	for {
+		fileName := filepath.Join(dir, ProjectConfigFile)
+		if _, statErr := os.Stat(fileName); statErr == nil && dir != home {
+			return LoadProjectConfig(fileName)
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	err = os.ErrNotExist
+	return
+}
+
+// LoadProjectConfig reads the project configuration file fileName.
+func LoadProjectConfig(fileName string) (pc *ProjectConfig, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	pc = &ProjectConfig{}
+	if err = json.Unmarshal(data, pc); err != nil {
+		err = fmt.Errorf("Could not parse %s: %s", fileName, err.Error())
+		return
+	}
+	pc.Dir, err = filepath.Abs(filepath.Dir(filepath.Dir(fileName)))
+	return
+}
+
+// Save writes the configuration to .force/config.json in its directory.
+func (pc *ProjectConfig) Save() (err error) {
+	fileName := filepath.Join(pc.Dir, ProjectConfigFile)
+	if err = os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(pc, "", "  ")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(fileName, append(data, '\n'), 0644)
+}
+
+// Settings returns the configured settings by key, with lists joined by
+// commas.
+func (pc *ProjectConfig) Settings() (settings map[string]string) {
+	settings = make(map[string]string)
+	for _, key := range ProjectSettingKeys() {
+		if value, ok := pc.Get(key); ok {
+			settings[key] = value
+		}
+	}
+	return
+}
+
+// Get returns the value of the setting key, and whether it's set.
+func (pc *ProjectConfig) Get(key string) (value string, ok bool) {
+	values, err := pc.values()
+	if err != nil {
+		return
+	}
+	parent, name := splitSettingKey(values, key, false)
+	if parent == nil {
+		return
+	}
+	v, ok := parent[name]
+	if !ok {
+		return
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		value = strings.Join(items, ",")
+	default:
+		value = fmt.Sprint(v)
+	}
+	return
+}
+
+// Set the setting key to value. Boolean settings take true or false, and
+// lists take comma-separated values. An empty value unsets the setting.
+func (pc *ProjectConfig) Set(key string, value string) (err error) {
+	kind, known := projectSettings[key]
+	if !known {
+		return fmt.Errorf("Unknown setting %s; valid settings are %s", key, strings.Join(ProjectSettingKeys(), ", "))
+	}
+	values, err := pc.values()
+	if err != nil {
+		return
+	}
+	parent, name := splitSettingKey(values, key, true)
+	if value == "" {
+		delete(parent, name)
+	} else {
+		switch kind {
+		case boolSetting:
+			var b bool
+			if b, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%s must be true or false", key)
+			}
+			parent[name] = b
+		case listSetting:
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			parent[name] = items
+		default:
+			parent[name] = value
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return
+	}
+	updated := ProjectConfig{Dir: pc.Dir}
+	if err = json.Unmarshal(data, &updated); err != nil {
+		return
+	}
+	if deploy, _ := json.Marshal(updated.Deploy); string(deploy) == "{}" {
+		updated.Deploy = nil
+	}
+	*pc = updated
+	return
+}
+
+func (pc *ProjectConfig) values() (values map[string]interface{}, err error) {
+	data, err := json.Marshal(pc)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &values)
+	return
+}
+
+// Returns the map holding the setting key, creating it if asked, and the
+// setting's name within it.
+func splitSettingKey(values map[string]interface{}, key string, create bool) (parent map[string]interface{}, name string) {
+	parts := strings.Split(key, ".")
+	parent = values
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := parent[part].(map[string]interface{})
+		if !ok {
+			if !create {
+				return nil, ""
+			}
+			child = make(map[string]interface{})
+			parent[part] = child
+		}
+		parent = child
+	}
+	name = parts[len(parts)-1]
+	return
+}
+
+// ActiveProjectConfig returns the project configuration, or an empty one if
+// there is none. It returns an error if the configuration can't be read.
+func ActiveProjectConfig() (pc *ProjectConfig, err error) {
+	pc, err = FindProjectConfig()
+	if os.IsNotExist(err) {
+		return &ProjectConfig{}, nil
+	}
+	return
+}
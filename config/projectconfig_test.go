@@ -0,0 +1,94 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/ForceCLI/force/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProjectConfig", func() {
+	var projectDir string
+
+	BeforeEach(func() {
+		projectDir, _ = ioutil.TempDir("", "projectconfig-test")
+		projectDir, _ = filepath.EvalSymlinks(projectDir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(projectDir)
+	})
+
+	It("should set and get settings", func() {
+		pc := &ProjectConfig{Dir: projectDir}
+		Expect(pc.Set("account", "me@example.com")).To(Succeed())
+		Expect(pc.Set("deploy.checkOnly", "true")).To(Succeed())
+		Expect(pc.Set("deploy.runTests", "ATest, BTest")).To(Succeed())
+		Expect(pc.Account).To(Equal("me@example.com"))
+		Expect(*pc.Deploy.CheckOnly).To(BeTrue())
+		Expect(pc.Deploy.RunTests).To(Equal([]string{"ATest", "BTest"}))
+		Expect(pc.Settings()).To(Equal(map[string]string{
+			"account":          "me@example.com",
+			"deploy.checkOnly": "true",
+			"deploy.runTests":  "ATest,BTest",
+		}))
+	})
+
+	It("should reject unknown settings and invalid values", func() {
+		pc := &ProjectConfig{Dir: projectDir}
+		Expect(pc.Set("nonsense", "1")).ToNot(Succeed())
+		Expect(pc.Set("deploy.checkOnly", "maybe")).ToNot(Succeed())
+	})
+
+	It("should unset settings given an empty value", func() {
+		pc := &ProjectConfig{Dir: projectDir}
+		Expect(pc.Set("deploy.testLevel", "RunLocalTests")).To(Succeed())
+		Expect(pc.Set("deploy.testLevel", "")).To(Succeed())
+		Expect(pc.Deploy).To(BeNil())
+		_, ok := pc.Get("deploy.testLevel")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should be saved and found from a subdirectory", func() {
+		pc := &ProjectConfig{Dir: projectDir}
+		Expect(pc.Set("sourceDirs", "core,integrations")).To(Succeed())
+		Expect(pc.Save()).To(Succeed())
+		os.MkdirAll(filepath.Join(projectDir, "core", "classes"), 0755)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		os.Chdir(filepath.Join(projectDir, "core", "classes"))
+		found, err := FindProjectConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found.Dir).To(Equal(projectDir))
+		Expect(found.SourceDirs).To(Equal([]string{"core", "integrations"}))
+
+		project, err := FindProject()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(project.DefaultSourceDir()).To(Equal(filepath.Join(projectDir, "core")))
+	})
+
+	It("should report invalid configuration files", func() {
+		os.MkdirAll(filepath.Join(projectDir, ".force"), 0755)
+		ioutil.WriteFile(filepath.Join(projectDir, ProjectConfigFile), []byte(`{"account": `), 0644)
+
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		os.Chdir(projectDir)
+		_, err := ActiveProjectConfig()
+		Expect(err).To(MatchError(ContainSubstring("Could not parse")))
+	})
+
+	It("should be empty without a configuration file", func() {
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		os.Chdir(projectDir)
+		pc, err := ActiveProjectConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pc.Settings()).To(BeEmpty())
+	})
+})
@@ -9,13 +9,27 @@ const (
 	LF = 10
 )
 
+// Exit codes used when a deploy or test run fails, so that scripts can tell
+// the kind of failure apart.
+const (
+	ExitCodeError             = 1
+	ExitCodeComponentFailures = 3
+	ExitCodeTestFailures      = 4
+	ExitCodeCoverageWarnings  = 5
+	ExitCodeCoverageGate      = 6
+)
+
 func ErrorAndExit(format string, args ...interface{}) {
+	ErrorAndExitWithCode(ExitCodeError, format, args...)
+}
+
+func ErrorAndExitWithCode(code int, format string, args ...interface{}) {
 	if format[0] == LF {
 		fmt.Fprintf(os.Stderr, format[1:]+"\n", args...)
 	} else {
 		fmt.Fprintf(os.Stderr, fmt.Sprintf("ERROR: %s\n", format), args...)
 	}
-	os.Exit(1)
+	os.Exit(code)
 }
 
 func ExitIfError(err error, format string, args ...interface{}) {
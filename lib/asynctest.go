@@ -0,0 +1,303 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Runs tests through the Tooling API's runTestsAsynchronous resource, which
+// doesn't time out on large suites and, unlike the SOAP runTests call,
+// accepts methods from several classes and test suites.
+type AsyncTestRunner struct {
+	Force            *Force
+	Suites           []string
+	MaxFailedTests   int
+	SkipCodeCoverage bool
+	PollInterval     time.Duration
+	Timeout          time.Duration
+}
+
+type AsyncTestItem struct {
+	ClassName   string   `json:"className"`
+	TestMethods []string `json:"testMethods,omitempty"`
+}
+
+type AsyncTestRequest struct {
+	ClassNames       string          `json:"classNames,omitempty"`
+	SuiteNames       string          `json:"suiteNames,omitempty"`
+	Tests            []AsyncTestItem `json:"tests,omitempty"`
+	TestLevel        string          `json:"testLevel,omitempty"`
+	MaxFailedTests   int             `json:"maxFailedTests"`
+	SkipCodeCoverage bool            `json:"skipCodeCoverage"`
+}
+
+func NewAsyncTestRunner(force *Force) *AsyncTestRunner {
+	return &AsyncTestRunner{
+		Force:          force,
+		MaxFailedTests: -1,
+		PollInterval:   5 * time.Second,
+		Timeout:        2 * time.Hour,
+	}
+}
+
+func NewAsyncTestRequest(tests []string, suites []string, maxFailedTests int, skipCodeCoverage bool) (request AsyncTestRequest, err error) {
+	request = AsyncTestRequest{
+		MaxFailedTests:   maxFailedTests,
+		SkipCodeCoverage: skipCodeCoverage,
+		SuiteNames:       strings.Join(suites, ","),
+	}
+	if len(tests) == 1 && strings.EqualFold(tests[0], "all") {
+		if len(suites) > 0 {
+			err = errors.New("Cannot run all tests and test suites together")
+			return
+		}
+		request.TestLevel = "RunLocalTests"
+		return
+	}
+	if len(tests) == 0 && len(suites) == 0 {
+		err = errors.New("No tests specified")
+		return
+	}
+	request.TestLevel = "RunSpecifiedTests"
+
+	hasMethods := false
+	var classes []string
+	methods := make(map[string][]string)
+	for _, test := range tests {
+		class, method := splitClassMethod(test)
+		if _, found := methods[class]; !found {
+			classes = append(classes, class)
+			methods[class] = nil
+		}
+		if method != "" {
+			hasMethods = true
+			methods[class] = append(methods[class], method)
+		}
+	}
+	if !hasMethods {
+		request.ClassNames = strings.Join(classes, ",")
+		return
+	}
+	if len(suites) > 0 {
+		err = errors.New("Test methods cannot be combined with test suites")
+		return
+	}
+	for _, class := range classes {
+		request.Tests = append(request.Tests, AsyncTestItem{ClassName: class, TestMethods: methods[class]})
+	}
+	return
+}
+
+func (runner *AsyncTestRunner) RunTests(tests []string, namespace string) (output TestCoverage, err error) {
+	if namespace != "" {
+		err = errors.New("Namespaces are not supported when running tests asynchronously")
+		return
+	}
+	request, err := NewAsyncTestRequest(tests, runner.Suites, runner.MaxFailedTests, runner.SkipCodeCoverage)
+	if err != nil {
+		return
+	}
+	jobId, err := runner.Force.RunTestsAsynchronous(request)
+	if err != nil {
+		return
+	}
+	fmt.Printf("Test run %s queued\n", jobId)
+	output, testClassIds, err := runner.waitForResults(jobId)
+	if err != nil || runner.SkipCodeCoverage || len(testClassIds) == 0 {
+		return
+	}
+	err = runner.addCoverage(&output, testClassIds)
+	return
+}
+
+func (f *Force) RunTestsAsynchronous(request AsyncTestRequest) (jobId string, err error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+	result, err := f.PostREST("tooling/runTestsAsynchronous", string(body))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal([]byte(result), &jobId); err != nil {
+		err = fmt.Errorf("Unexpected response from runTestsAsynchronous: %s", result)
+	}
+	return
+}
+
+// Whether a queue item or job with the status has finished.
+func isAsyncStatusFinished(status string) bool {
+	switch status {
+	case "Completed", "Failed", "Aborted":
+		return true
+	}
+	return false
+}
+
+// Poll the job's queue items, printing the results of each test class as it
+// completes, until every class has finished. If there are no queue items,
+// e.g. because no tests matched, the status of the job decides when it's
+// done. Gives up after the runner's Timeout.
+func (runner *AsyncTestRunner) waitForResults(jobId string) (output TestCoverage, testClassIds []string, err error) {
+	reported := make(map[string]bool)
+	var deadline time.Time
+	if runner.Timeout > 0 {
+		deadline = time.Now().Add(runner.Timeout)
+	}
+	for {
+		var items ForceQueryResult
+		items, err = runner.Force.Query(fmt.Sprintf("SELECT Id, ApexClassId, ApexClass.Name, Status, ExtendedStatus FROM ApexTestQueueItem WHERE ParentJobId = '%s'", jobId))
+		if err != nil {
+			return
+		}
+		var finished []string
+		done := true
+		for _, item := range items.Records {
+			id, _ := item["Id"].(string)
+			status, _ := item["Status"].(string)
+			if !isAsyncStatusFinished(status) {
+				done = false
+				continue
+			}
+			if reported[id] {
+				continue
+			}
+			reported[id] = true
+			finished = append(finished, id)
+			classId, _ := item["ApexClassId"].(string)
+			testClassIds = append(testClassIds, classId)
+			if status != "Completed" {
+				className := ""
+				if class, ok := item["ApexClass"].(map[string]interface{}); ok {
+					className, _ = class["Name"].(string)
+				}
+				extendedStatus, _ := item["ExtendedStatus"].(string)
+				fmt.Printf("  [%s]  %s %s\n", strings.ToUpper(status), className, extendedStatus)
+			}
+		}
+		if len(finished) > 0 {
+			if err = runner.reportResults(finished, &output); err != nil {
+				return
+			}
+		}
+		if done && len(items.Records) > 0 {
+			return
+		}
+		if len(items.Records) == 0 {
+			var finished bool
+			if finished, err = runner.jobFinished(jobId); err != nil || finished {
+				return
+			}
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			err = fmt.Errorf("Timed out after %s waiting for test run %s", runner.Timeout, jobId)
+			return
+		}
+		time.Sleep(runner.PollInterval)
+	}
+}
+
+// Whether the AsyncApexJob of the test run has finished. A job that failed
+// or was aborted is returned as an error.
+func (runner *AsyncTestRunner) jobFinished(jobId string) (finished bool, err error) {
+	jobs, err := runner.Force.Query(fmt.Sprintf("SELECT Status, ExtendedStatus FROM AsyncApexJob WHERE Id = '%s'", jobId))
+	if err != nil {
+		return
+	}
+	if len(jobs.Records) == 0 {
+		return
+	}
+	status, _ := jobs.Records[0]["Status"].(string)
+	if !isAsyncStatusFinished(status) {
+		return
+	}
+	if status != "Completed" {
+		extendedStatus, _ := jobs.Records[0]["ExtendedStatus"].(string)
+		err = fmt.Errorf("Test run %s %s: %s", jobId, strings.ToLower(status), extendedStatus)
+	}
+	return true, err
+}
+
+func quoteIds(ids []string) string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = fmt.Sprintf("'%s'", id)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (runner *AsyncTestRunner) reportResults(queueItemIds []string, output *TestCoverage) (err error) {
+	results, err := runner.Force.Query(fmt.Sprintf("SELECT ApexClass.Name, MethodName, Outcome, Message, StackTrace, RunTime FROM ApexTestResult WHERE QueueItemId IN (%s) ORDER BY ApexClass.Name, MethodName", quoteIds(queueItemIds)))
+	if err != nil {
+		return
+	}
+	for _, result := range results.Records {
+		className := ""
+		if class, ok := result["ApexClass"].(map[string]interface{}); ok {
+			className, _ = class["Name"].(string)
+		}
+		methodName, _ := result["MethodName"].(string)
+		outcome, _ := result["Outcome"].(string)
+		message, _ := result["Message"].(string)
+		stackTrace, _ := result["StackTrace"].(string)
+		runTime, _ := result["RunTime"].(float64)
+		output.NumberRun++
+		switch outcome {
+		case "Pass":
+			fmt.Printf("  [PASS]  %s::%s\n", className, methodName)
+			output.SClassNames = append(output.SClassNames, className)
+			output.SMethodNames = append(output.SMethodNames, methodName)
+			output.STime = append(output.STime, float32(runTime))
+		case "Skip":
+			output.NumberRun--
+			fmt.Printf("  [SKIP]  %s::%s\n", className, methodName)
+		default:
+			fmt.Printf("  [FAIL]  %s::%s: %s\n    %s\n", className, methodName, message, stackTrace)
+			output.NumberFailures++
+			output.FClassNames = append(output.FClassNames, className)
+			output.FMethodNames = append(output.FMethodNames, methodName)
+			output.FMessage = append(output.FMessage, message)
+			output.FStackTrace = append(output.FStackTrace, stackTrace)
+			output.FTime = append(output.FTime, float32(runTime))
+		}
+	}
+	return
+}
+
+// Fill in coverage of the classes and triggers exercised by the test classes
+// that were run.
+func (runner *AsyncTestRunner) addCoverage(output *TestCoverage, testClassIds []string) (err error) {
+	covered, err := runner.Force.Query(fmt.Sprintf("SELECT ApexClassOrTrigger.Name FROM ApexCodeCoverage WHERE ApexTestClassId IN (%s)", quoteIds(testClassIds)), func(options *QueryOptions) {
+		options.IsTooling = true
+	})
+	if err != nil {
+		return
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, record := range covered.Records {
+		if classOrTrigger, ok := record["ApexClassOrTrigger"].(map[string]interface{}); ok {
+			name, _ := classOrTrigger["Name"].(string)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	coverage, err := runner.Force.GetCodeCoverageAggregate(names)
+	if err != nil {
+		return
+	}
+	for _, c := range coverage {
+		output.Name = append(output.Name, c.Name)
+		output.NumberLocations = append(output.NumberLocations, c.NumLines())
+		output.NumberLocationsNotCovered = append(output.NumberLocationsNotCovered, len(c.UncoveredLines))
+	}
+	return
+}
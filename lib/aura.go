@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A file of a new Lightning (Aura) bundle, with the AuraDefinition type and
+// format it's created as.
+type AuraDefinitionFile struct {
+	FileName string
+	DefType  string
+	Format   string
+	Source   string
+}
+
+// Optional parts of a new aura bundle.
+type AuraBundleParts struct {
+	Controller bool
+	Helper     bool
+	Renderer   bool
+	Style      bool
+	Design     bool
+}
+
+var auraBundleTypes = map[string]AuraDefinitionFile{
+	"application": {FileName: ".app", DefType: "APPLICATION", Format: "XML", Source: "<aura:application>\n\n</aura:application>"},
+	"component":   {FileName: ".cmp", DefType: "COMPONENT", Format: "XML", Source: "<aura:component>\n\n</aura:component>"},
+	"event":       {FileName: ".evt", DefType: "EVENT", Format: "XML", Source: "<aura:event type=\"APPLICATION\" description=\"Event template\">\n\n</aura:event>"},
+	"interface":   {FileName: ".intf", DefType: "INTERFACE", Format: "XML", Source: "<aura:interface description=\"Interface template\">\n\n</aura:interface>"},
+	"tokens":      {FileName: ".tokens", DefType: "TOKENS", Format: "XML", Source: "<aura:tokens>\n\n</aura:tokens>"},
+}
+
+// Returns the files of a new aura bundle of the given type (application,
+// component, event, interface or tokens), main definition first. Files are
+// named following the conventions used when fetching bundles, e.g.
+// MyCmp.cmp, MyCmpController.js and MyCmpStyle.css.
+func NewAuraBundleFiles(bundleType string, name string, parts AuraBundleParts) (files []AuraDefinitionFile, err error) {
+	bundleType = strings.ToLower(bundleType)
+	if bundleType == "app" {
+		bundleType = "application"
+	}
+	main, found := auraBundleTypes[bundleType]
+	if !found {
+		err = fmt.Errorf("Unknown bundle type %q; use application, component, event, interface or tokens", bundleType)
+		return
+	}
+	hasCode := parts.Controller || parts.Helper || parts.Renderer || parts.Style
+	if hasCode && bundleType != "component" && bundleType != "application" {
+		err = fmt.Errorf("Only components and applications can have a controller, helper, renderer or style")
+		return
+	}
+	if parts.Design && bundleType != "component" {
+		err = fmt.Errorf("Only components can have a design")
+		return
+	}
+
+	main.FileName = name + main.FileName
+	files = append(files, main)
+	if parts.Controller {
+		files = append(files, AuraDefinitionFile{FileName: name + "Controller.js", DefType: "CONTROLLER", Format: "JS",
+			Source: "({\n\tmyAction : function(component, event, helper) {\n\n\t}\n})"})
+	}
+	if parts.Helper {
+		files = append(files, AuraDefinitionFile{FileName: name + "Helper.js", DefType: "HELPER", Format: "JS",
+			Source: "({\n\thelperMethod : function() {\n\n\t}\n})"})
+	}
+	if parts.Renderer {
+		files = append(files, AuraDefinitionFile{FileName: name + "Renderer.js", DefType: "RENDERER", Format: "JS",
+			Source: "({\n\n// Your renderer method overrides go here\n\n})"})
+	}
+	if parts.Style {
+		files = append(files, AuraDefinitionFile{FileName: name + "Style.css", DefType: "STYLE", Format: "CSS",
+			Source: ".THIS {\n}"})
+	}
+	if parts.Design {
+		files = append(files, AuraDefinitionFile{FileName: name + ".design", DefType: "DESIGN", Format: "XML",
+			Source: "<design:component>\n\n</design:component>"})
+	}
+	return
+}
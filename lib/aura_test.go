@@ -0,0 +1,36 @@
+package lib_test
+
+import (
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Aura", func() {
+	Describe("NewAuraBundleFiles", func() {
+		It("should create the main definition first", func() {
+			files, err := NewAuraBundleFiles("component", "MyCmp", AuraBundleParts{Controller: true, Style: true, Design: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(HaveLen(4))
+			Expect(files[0].FileName).To(Equal("MyCmp.cmp"))
+			Expect(files[0].DefType).To(Equal("COMPONENT"))
+			Expect(files[1].FileName).To(Equal("MyCmpController.js"))
+			Expect(files[2].FileName).To(Equal("MyCmpStyle.css"))
+			Expect(files[3].DefType).To(Equal("DESIGN"))
+		})
+		It("should support tokens bundles", func() {
+			files, err := NewAuraBundleFiles("tokens", "MyTokens", AuraBundleParts{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files[0].FileName).To(Equal("MyTokens.tokens"))
+		})
+		It("should reject code for events", func() {
+			_, err := NewAuraBundleFiles("event", "MyEvent", AuraBundleParts{Helper: true})
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject unknown types", func() {
+			_, err := NewAuraBundleFiles("widget", "MyWidget", AuraBundleParts{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
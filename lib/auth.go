@@ -33,7 +33,7 @@ func getUserInfo(creds ForceSession) (userinfo UserInfo, err error) {
 	}
 	userinfo.ProfileId = fmt.Sprintf("%s", me["ProfileId"])
 
-	namespace, err := force.getOrgNamespace()
+	namespace, err := force.getOrgNamespace(userinfo.OrgId)
 	if err == nil {
 		userinfo.OrgNamespace = namespace
 	} else {
@@ -43,12 +43,15 @@ func getUserInfo(creds ForceSession) (userinfo UserInfo, err error) {
 	return
 }
 
-func (f *Force) getOrgNamespace() (namespace string, err error) {
+func (f *Force) getOrgNamespace(orgId string) (namespace string, err error) {
 	describe, err := f.Metadata.DescribeMetadata()
 	if err != nil {
 		return
 	}
 	namespace = describe.NamespacePrefix
+	if err := CacheMetadataTypes(orgId, describe); err != nil && Verbose {
+		fmt.Fprintf(os.Stderr, "Could not cache metadata types: %s\n", err.Error())
+	}
 	return
 }
 
@@ -185,6 +188,15 @@ func GetAccountCredentials(accountName string) (creds ForceSession, err error) {
 	if creds.SessionOptions.ApiVersion != "" && creds.SessionOptions.ApiVersion != ApiVersionNumber() {
 		SetApiVersion(creds.SessionOptions.ApiVersion)
 	}
+	// The project's API version takes precedence over the login's
+	pc, err := ActiveProjectConfig()
+	if err != nil {
+		return
+	}
+	if version := pc.ApiVersion; version != "" {
+		SetApiVersion(version)
+		creds.SessionOptions.ApiVersion = version
+	}
 	if creds.ForceEndpoint == EndpointCustom && CustomEndpoint == "" {
 		CustomEndpoint = creds.InstanceUrl
 	}
@@ -206,7 +218,16 @@ func ActiveCredentials(requireCredentials bool) (creds ForceSession, err error)
 	return
 }
 
+// The project's account, if configured, takes precedence over the active
+// login.
 func ActiveLogin() (account string, err error) {
+	pc, err := ActiveProjectConfig()
+	if err != nil {
+		return
+	}
+	if account = pc.Account; account != "" {
+		return
+	}
 	account, err = Config.LoadLocalOrGlobal("current", "account")
 	if err != nil {
 		accounts, _ := Config.List("accounts")
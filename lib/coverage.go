@@ -0,0 +1,293 @@
+package lib
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Line-level code coverage for an Apex class or trigger, as recorded in the
+// org's ApexCodeCoverageAggregate.
+type ApexCoverage struct {
+	Id             string
+	Name           string
+	IsTrigger      bool
+	CoveredLines   []int
+	UncoveredLines []int
+}
+
+// Key prefix of ApexTrigger ids. ApexClassOrTriggerId is polymorphic.
+const apexTriggerKeyPrefix = "01q"
+
+func (c ApexCoverage) NumLines() int {
+	return len(c.CoveredLines) + len(c.UncoveredLines)
+}
+
+// Percentage of lines covered, between 0 and 100. Like the coverage gate's
+// ClassCoverage, a class or trigger without lines is fully covered.
+func (c ApexCoverage) Percent() float64 {
+	if c.NumLines() == 0 {
+		return 100
+	}
+	return float64(len(c.CoveredLines)) / float64(c.NumLines()) * 100
+}
+
+// Returns the path of the class or trigger source relative to the metadata
+// source directory, e.g. classes/MyClass.cls.
+func (c ApexCoverage) SourcePath() string {
+	if c.IsTrigger {
+		return filepath.Join("triggers", c.Name+".trigger")
+	}
+	return filepath.Join("classes", c.Name+".cls")
+}
+
+// Get line coverage for the named classes and triggers, or for all classes
+// and triggers in the org if no names are given.
+func (f *Force) GetCodeCoverageAggregate(names []string) (coverage []ApexCoverage, err error) {
+	soql := "SELECT ApexClassOrTriggerId, ApexClassOrTrigger.Name, Coverage FROM ApexCodeCoverageAggregate"
+	if len(names) > 0 {
+		quoted := make([]string, len(names))
+		for i, name := range names {
+			quoted[i] = fmt.Sprintf("'%s'", strings.Replace(name, "'", `\'`, -1))
+		}
+		soql += fmt.Sprintf(" WHERE ApexClassOrTrigger.Name IN (%s)", strings.Join(quoted, ", "))
+	}
+	result, err := f.Query(soql, func(options *QueryOptions) {
+		options.IsTooling = true
+	})
+	if err != nil {
+		return
+	}
+	for _, record := range result.Records {
+		coverage = append(coverage, apexCoverageFromRecord(record))
+	}
+	sort.Slice(coverage, func(i, j int) bool { return coverage[i].Name < coverage[j].Name })
+	return
+}
+
+func apexCoverageFromRecord(record ForceRecord) (c ApexCoverage) {
+	c.Id, _ = record["ApexClassOrTriggerId"].(string)
+	c.IsTrigger = strings.HasPrefix(c.Id, apexTriggerKeyPrefix)
+	if classOrTrigger, ok := record["ApexClassOrTrigger"].(map[string]interface{}); ok {
+		c.Name, _ = classOrTrigger["Name"].(string)
+	}
+	if lines, ok := record["Coverage"].(map[string]interface{}); ok {
+		c.CoveredLines = lineNumbers(lines["coveredLines"])
+		c.UncoveredLines = lineNumbers(lines["uncoveredLines"])
+	}
+	return
+}
+
+func lineNumbers(value interface{}) (lines []int) {
+	values, _ := value.([]interface{})
+	for _, v := range values {
+		if n, ok := v.(float64); ok {
+			lines = append(lines, int(n))
+		}
+	}
+	sort.Ints(lines)
+	return
+}
+
+// Returns each line number with its hit count (1 if covered, 0 if not), in
+// line order.
+func (c ApexCoverage) lineHits() (lines []int, hits map[int]int) {
+	hits = make(map[int]int)
+	for _, line := range c.CoveredLines {
+		hits[line] = 1
+	}
+	for _, line := range c.UncoveredLines {
+		if _, found := hits[line]; !found {
+			hits[line] = 0
+		}
+	}
+	for line := range hits {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return
+}
+
+// Write coverage in LCOV tracefile format. Source file paths are prefixed
+// with sourceDir.
+func WriteLcov(w io.Writer, coverage []ApexCoverage, sourceDir string) (err error) {
+	for _, c := range coverage {
+		lines, hits := c.lineHits()
+		fmt.Fprintf(w, "TN:\nSF:%s\n", filepath.ToSlash(filepath.Join(sourceDir, c.SourcePath())))
+		for _, line := range lines {
+			fmt.Fprintf(w, "DA:%d,%d\n", line, hits[line])
+		}
+		_, err = fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), len(c.CoveredLines))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity int             `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity int              `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+func lineRate(covered, valid int) string {
+	if valid == 0 {
+		return "1"
+	}
+	return fmt.Sprintf("%.4f", float64(covered)/float64(valid))
+}
+
+// Write coverage as Cobertura XML. Classes and triggers are reported as two
+// packages; file names are relative to sourceDir, which is listed as the
+// report's source.
+func WriteCobertura(w io.Writer, coverage []ApexCoverage, sourceDir string) (err error) {
+	report := coberturaCoverage{
+		BranchRate: "0",
+		Version:    Version,
+		Timestamp:  time.Now().Unix(),
+		Sources:    []string{filepath.ToSlash(sourceDir)},
+	}
+	packages := map[bool]*coberturaPackage{
+		false: &coberturaPackage{Name: "classes", BranchRate: "0"},
+		true:  &coberturaPackage{Name: "triggers", BranchRate: "0"},
+	}
+	packageLines := map[bool][2]int{}
+	for _, c := range coverage {
+		lines, hits := c.lineHits()
+		class := coberturaClass{
+			Name:       c.Name,
+			Filename:   filepath.ToSlash(c.SourcePath()),
+			LineRate:   lineRate(len(c.CoveredLines), len(lines)),
+			BranchRate: "0",
+		}
+		for _, line := range lines {
+			class.Lines = append(class.Lines, coberturaLine{Number: line, Hits: hits[line]})
+		}
+		pkg := packages[c.IsTrigger]
+		pkg.Classes = append(pkg.Classes, class)
+		counts := packageLines[c.IsTrigger]
+		counts[0] += len(c.CoveredLines)
+		counts[1] += len(lines)
+		packageLines[c.IsTrigger] = counts
+		report.LinesCovered += len(c.CoveredLines)
+		report.LinesValid += len(lines)
+	}
+	for _, isTrigger := range []bool{false, true} {
+		pkg := packages[isTrigger]
+		if len(pkg.Classes) == 0 {
+			continue
+		}
+		counts := packageLines[isTrigger]
+		pkg.LineRate = lineRate(counts[0], counts[1])
+		report.Packages = append(report.Packages, *pkg)
+	}
+	report.LineRate = lineRate(report.LinesCovered, report.LinesValid)
+
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return
+	}
+	_, err = w.Write(append(out, '\n'))
+	return
+}
+
+// Get the source of an Apex class or trigger from the org.
+func (f *Force) GetApexBody(name string, isTrigger bool) (body string, err error) {
+	sobject := "ApexClass"
+	if isTrigger {
+		sobject = "ApexTrigger"
+	}
+	result, err := f.Query(fmt.Sprintf("SELECT Body FROM %s WHERE Name = '%s'", sobject, strings.Replace(name, "'", `\'`, -1)), func(options *QueryOptions) {
+		options.IsTooling = true
+	})
+	if err != nil {
+		return
+	}
+	if len(result.Records) == 0 {
+		err = fmt.Errorf("%s %s not found", sobject, name)
+		return
+	}
+	body, _ = result.Records[0]["Body"].(string)
+	return
+}
+
+const (
+	coveredColor   = "\x1b[32m"
+	uncoveredColor = "\x1b[31;1m"
+	resetColor     = "\x1b[0m"
+)
+
+// Write the source of a class or trigger with a gutter marking each line as
+// covered (+) or uncovered (-), followed by a summary. If uncoveredOnly is
+// set, only uncovered lines are written.
+func WriteAnnotatedCoverage(w io.Writer, source string, coverage ApexCoverage, uncoveredOnly bool, color bool) (err error) {
+	_, hits := coverage.lineHits()
+	lines := strings.Split(strings.Replace(source, "\r\n", "\n", -1), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for index, text := range lines {
+		number := index + 1
+		hit, executable := hits[number]
+		if uncoveredOnly && (!executable || hit > 0) {
+			continue
+		}
+		marker, start, end := " ", "", ""
+		if executable {
+			marker, start = "+", coveredColor
+			if hit == 0 {
+				marker, start = "-", uncoveredColor
+			}
+			end = resetColor
+		}
+		if !color {
+			start, end = "", ""
+		}
+		if _, err = fmt.Fprintf(w, "%s%5d %s| %s%s\n", start, number, marker, text, end); err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprintf(w, "\n%s: %.2f%% covered (%d of %d lines), %d uncovered\n",
+		coverage.Name, coverage.Percent(), len(coverage.CoveredLines), coverage.NumLines(), len(coverage.UncoveredLines))
+	return
+}
@@ -0,0 +1,68 @@
+package lib_test
+
+import (
+	"bytes"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Coverage", func() {
+	var coverage []ApexCoverage
+
+	BeforeEach(func() {
+		coverage = []ApexCoverage{
+			{Name: "MyClass", CoveredLines: []int{2, 3, 5}, UncoveredLines: []int{4}},
+			{Name: "MyTrigger", IsTrigger: true, CoveredLines: []int{1}},
+		}
+	})
+
+	Describe("Percent", func() {
+		It("should return the percentage of lines covered", func() {
+			Expect(coverage[0].Percent()).To(Equal(75.0))
+		})
+		It("should return 100 for classes without lines", func() {
+			Expect(ApexCoverage{Name: "Empty"}.Percent()).To(Equal(100.0))
+		})
+	})
+
+	Describe("WriteLcov", func() {
+		It("should write a record per source file", func() {
+			var out bytes.Buffer
+			Expect(WriteLcov(&out, coverage, "src")).To(Succeed())
+			Expect(out.String()).To(Equal("TN:\nSF:src/classes/MyClass.cls\nDA:2,1\nDA:3,1\nDA:4,0\nDA:5,1\nLF:4\nLH:3\nend_of_record\n" +
+				"TN:\nSF:src/triggers/MyTrigger.trigger\nDA:1,1\nLF:1\nLH:1\nend_of_record\n"))
+		})
+	})
+
+	Describe("WriteCobertura", func() {
+		It("should write classes and triggers as packages", func() {
+			var out bytes.Buffer
+			Expect(WriteCobertura(&out, coverage, "src")).To(Succeed())
+			Expect(out.String()).To(ContainSubstring(`lines-covered="4" lines-valid="5"`))
+			Expect(out.String()).To(ContainSubstring(`<source>src</source>`))
+			Expect(out.String()).To(ContainSubstring(`<class name="MyClass" filename="classes/MyClass.cls" line-rate="0.7500"`))
+			Expect(out.String()).To(ContainSubstring(`<line number="4" hits="0"></line>`))
+			Expect(out.String()).To(ContainSubstring(`<package name="triggers" line-rate="1.0000"`))
+		})
+	})
+
+	Describe("WriteAnnotatedCoverage", func() {
+		source := "public class MyClass {\n  a();\n  b();\n  c();\n  d();\n}\n"
+
+		It("should mark covered and uncovered lines", func() {
+			var out bytes.Buffer
+			Expect(WriteAnnotatedCoverage(&out, source, coverage[0], false, false)).To(Succeed())
+			Expect(out.String()).To(HavePrefix("    1  | public class MyClass {\n    2 +|   a();\n"))
+			Expect(out.String()).To(ContainSubstring("    4 -|   c();\n"))
+			Expect(out.String()).To(HaveSuffix("MyClass: 75.00% covered (3 of 4 lines), 1 uncovered\n"))
+		})
+		It("should only show uncovered lines", func() {
+			var out bytes.Buffer
+			Expect(WriteAnnotatedCoverage(&out, source, coverage[0], true, false)).To(Succeed())
+			Expect(out.String()).To(HavePrefix("    4 -|   c();\n\n"))
+		})
+	})
+})
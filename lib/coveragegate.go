@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Number of lines covered in a class or trigger, from either a test run or a
+// deploy that ran tests.
+type ClassCoverage struct {
+	Name                   string
+	NumLocations           int
+	NumLocationsNotCovered int
+}
+
+func (c ClassCoverage) Percent() float64 {
+	if c.NumLocations == 0 {
+		return 100
+	}
+	return float64(c.NumLocations-c.NumLocationsNotCovered) / float64(c.NumLocations) * 100
+}
+
+// The outcome of checking coverage against the required minimums.
+type CoverageGateResult struct {
+	OrgPercent       float64
+	MinCoverage      float64
+	MinClassCoverage float64
+	// Classes below MinClassCoverage, most uncovered lines first
+	FailedClasses []ClassCoverage
+}
+
+func ClassCoverageFromTestResults(output TestCoverage) (coverage []ClassCoverage) {
+	for index := range output.NumberLocations {
+		coverage = append(coverage, ClassCoverage{
+			Name:                   output.Name[index],
+			NumLocations:           output.NumberLocations[index],
+			NumLocationsNotCovered: output.NumberLocationsNotCovered[index],
+		})
+	}
+	return
+}
+
+func ClassCoverageFromDeploy(result RunTestResult) (coverage []ClassCoverage) {
+	for _, c := range result.CodeCoverage {
+		coverage = append(coverage, ClassCoverage{
+			Name:                   c.Name,
+			NumLocations:           c.NumLocations,
+			NumLocationsNotCovered: c.NumLocationsNotCovered,
+		})
+	}
+	return
+}
+
+// Check coverage against the org-wide and per-class minimums, given as
+// percentages. A minimum of 0 is not enforced.
+func CheckCoverage(coverage []ClassCoverage, minCoverage float64, minClassCoverage float64) (result CoverageGateResult) {
+	result.MinCoverage = minCoverage
+	result.MinClassCoverage = minClassCoverage
+	locations, notCovered := 0, 0
+	for _, c := range coverage {
+		locations += c.NumLocations
+		notCovered += c.NumLocationsNotCovered
+		if minClassCoverage > 0 && c.Percent() < minClassCoverage {
+			result.FailedClasses = append(result.FailedClasses, c)
+		}
+	}
+	result.OrgPercent = ClassCoverage{NumLocations: locations, NumLocationsNotCovered: notCovered}.Percent()
+	sort.SliceStable(result.FailedClasses, func(i, j int) bool {
+		a, b := result.FailedClasses[i], result.FailedClasses[j]
+		if a.NumLocationsNotCovered != b.NumLocationsNotCovered {
+			return a.NumLocationsNotCovered > b.NumLocationsNotCovered
+		}
+		return a.Name < b.Name
+	})
+	return
+}
+
+func (result CoverageGateResult) OrgFailed() bool {
+	return result.MinCoverage > 0 && result.OrgPercent < result.MinCoverage
+}
+
+func (result CoverageGateResult) Passed() bool {
+	return !result.OrgFailed() && len(result.FailedClasses) == 0
+}
+
+// Describe why the coverage gate failed.
+func (result CoverageGateResult) String() string {
+	var lines []string
+	if result.OrgFailed() {
+		lines = append(lines, fmt.Sprintf("Coverage of %.2f%% is below the required %.2f%%", result.OrgPercent, result.MinCoverage))
+	}
+	if len(result.FailedClasses) > 0 {
+		lines = append(lines, fmt.Sprintf("Classes below the required %.2f%% coverage:", result.MinClassCoverage))
+		for _, c := range result.FailedClasses {
+			lines = append(lines, fmt.Sprintf("%6.2f%%  %4d uncovered  %s", c.Percent(), c.NumLocationsNotCovered, c.Name))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
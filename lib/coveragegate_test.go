@@ -0,0 +1,46 @@
+package lib_test
+
+import (
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CoverageGate", func() {
+	var coverage []ClassCoverage
+
+	BeforeEach(func() {
+		coverage = []ClassCoverage{
+			{Name: "Covered", NumLocations: 100, NumLocationsNotCovered: 0},
+			{Name: "HalfCovered", NumLocations: 10, NumLocationsNotCovered: 5},
+			{Name: "Uncovered", NumLocations: 20, NumLocationsNotCovered: 20},
+		}
+	})
+
+	Describe("CheckCoverage", func() {
+		It("should calculate coverage across all classes", func() {
+			result := CheckCoverage(coverage, 80, 0)
+			Expect(result.OrgPercent).To(BeNumerically("~", 80.77, 0.01))
+			Expect(result.Passed()).To(BeTrue())
+		})
+		It("should fail if overall coverage is too low", func() {
+			result := CheckCoverage(coverage, 85, 0)
+			Expect(result.OrgFailed()).To(BeTrue())
+			Expect(result.Passed()).To(BeFalse())
+		})
+		It("should list classes below the minimum by uncovered lines", func() {
+			result := CheckCoverage(coverage, 0, 75)
+			Expect(result.Passed()).To(BeFalse())
+			Expect(result.FailedClasses).To(HaveLen(2))
+			Expect(result.FailedClasses[0].Name).To(Equal("Uncovered"))
+			Expect(result.FailedClasses[1].Name).To(Equal("HalfCovered"))
+		})
+		It("should use deploy coverage results", func() {
+			var testResult RunTestResult
+			testResult.CodeCoverage = []CodeCoverageResult{{Name: "MyClass", NumLocations: 4, NumLocationsNotCovered: 1}}
+			result := CheckCoverage(ClassCoverageFromDeploy(testResult), 0, 80)
+			Expect(result.FailedClasses[0].Percent()).To(Equal(75.0))
+		})
+	})
+})
@@ -1,10 +1,13 @@
 package lib
 
 import (
+	"archive/zip"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -15,9 +18,15 @@ import (
 // Creates a package that includes everything in the passed in string slice
 // and then deploys the package to salesforce
 func PushByPaths(fpaths []string, byName bool, namePaths map[string]string, opts *ForceDeployOptions) {
+	if force, err := ActiveForce(); err == nil {
+		force.LoadMetadataTypes()
+	}
 	pb := NewPushBuilder()
 	var badPaths []string
 	for _, fpath := range fpaths {
+		if pb.Ignore.Ignored(fpath) {
+			continue
+		}
 
 		fi, err := os.Stat(fpath)
 		if err != nil {
@@ -51,24 +60,130 @@ func PushByPaths(fpaths []string, byName bool, namePaths map[string]string, opts
 	}
 
 	if len(badPaths) == 0 {
+		force, _ := ActiveForce()
+		query := pb.Query()
+		CheckDeployConflicts(force, query, opts)
+		files := pb.ForceMetadataFiles()
+		if opts.Snapshot != "" {
+			if err := force.WriteRollbackSnapshot(files, query, opts.Snapshot); err != nil {
+				ErrorAndExit("Could not write rollback snapshot: %s", err.Error())
+			}
+		}
 		fmt.Println("Deploying now...")
 		t0 := time.Now()
-		deployFiles(pb.ForceMetadataFiles(), byName, namePaths, opts)
+		deployFiles(files, byName, namePaths, opts)
 		t1 := time.Now()
 		fmt.Printf("The deployment took %v to run.\n", t1.Sub(t0))
+		RecordDeployedMembers(force, query, opts)
 	} else {
 		ErrorAndExit("Could not add the following files:\n {%v}", strings.Join(badPaths, "\n"))
 	}
 }
 
+// Exit without deploying if any of the members in the query were changed in
+// the org since they were last fetched, unless the deploy only checks or
+// ignores conflicts.
+func CheckDeployConflicts(force *Force, query ForceMetadataQuery, opts *ForceDeployOptions) {
+	if opts.CheckOnly || opts.IgnoreConflicts {
+		return
+	}
+	checkConflicts(force, query)
+}
+
+// Record the state of the deployed members in the org, so that later
+// deploys can tell whether they were changed there since.
+func RecordDeployedMembers(force *Force, query ForceMetadataQuery, opts *ForceDeployOptions) {
+	if opts.CheckOnly {
+		return
+	}
+	if err := force.RecordMembers(query); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not record deployed members: %s\n", err.Error())
+	}
+}
+
+// Returns the members listed in a package.xml.
+func PackageXmlQuery(data []byte) (query ForceMetadataQuery, err error) {
+	var pkg Package
+	if err = xml.Unmarshal(data, &pkg); err != nil {
+		return
+	}
+	for _, t := range pkg.Types {
+		query = append(query, ForceMetadataQueryElement{Name: []string{t.Name}, Members: t.Members})
+	}
+	return
+}
+
+// Returns the members listed in the package.xml of a package zip.
+func zipPackageQuery(path string) (query ForceMetadataQuery, err error) {
+	zipped, err := zip.OpenReader(path)
+	if err != nil {
+		return
+	}
+	defer zipped.Close()
+	for _, file := range zipped.File {
+		if filepath.Base(file.Name) != "package.xml" {
+			continue
+		}
+		r, openErr := file.Open()
+		if openErr != nil {
+			return nil, openErr
+		}
+		data, readErr := ioutil.ReadAll(r)
+		r.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		return PackageXmlQuery(data)
+	}
+	return nil, fmt.Errorf("%s has no package.xml", path)
+}
+
+func checkConflicts(force *Force, query ForceMetadataQuery) {
+	conflicts, err := force.FetchConflicts(query)
+	if err != nil {
+		ErrorAndExit("Could not check for conflicts: %s", err.Error())
+	}
+	if len(conflicts) == 0 {
+		return
+	}
+	var changes []string
+	for _, conflict := range conflicts {
+		changes = append(changes, "  "+conflict.String())
+	}
+	ErrorAndExit("The following were changed in the org since they were last fetched:\n%s\nFetch them again, or deploy with -force to overwrite them.", strings.Join(changes, "\n"))
+}
+
 func deployFiles(files ForceMetadataFiles, byName bool, namePaths map[string]string, opts *ForceDeployOptions) {
 	force, _ := ActiveForce()
 	result, err := force.Metadata.Deploy(files, *opts)
 	err = processDeployResults(result, byName, namePaths, err)
+	finishDeploy(result, namePaths, opts, err)
+	return
+}
+
+// Write the report requested in the deploy options, if any, and exit with a
+// code describing the failure if the deploy failed or didn't meet the
+// required coverage.
+func finishDeploy(result ForceCheckDeploymentStatusResult, namePaths map[string]string, opts *ForceDeployOptions, err error) {
+	report := NewDeployReport(result, namePaths)
+	if opts.ReportFormat != "" {
+		if reportErr := report.Write(opts.ReportFormat, opts.ReportFile); reportErr != nil {
+			fmt.Fprintln(os.Stderr, reportErr.Error())
+		}
+	}
 	if err != nil {
-		ErrorAndExit(err.Error())
+		code := report.ExitCode()
+		if code == 0 {
+			code = ExitCodeError
+		}
+		ErrorAndExitWithCode(code, err.Error())
+	}
+	if opts.MinCoverage > 0 || opts.MinClassCoverage > 0 {
+		gate := CheckCoverage(ClassCoverageFromDeploy(result.Details.RunTestResult), opts.MinCoverage, opts.MinClassCoverage)
+		if !gate.Passed() {
+			ErrorAndExitWithCode(ExitCodeCoverageGate, "%s", gate.String())
+		}
 	}
-	return
 }
 
 // Process and display the result of the push operation
@@ -155,14 +270,17 @@ func processDeployResults(result ForceCheckDeploymentStatusResult, byName bool,
 func DeployPackage(resourcepaths []string, opts *ForceDeployOptions) {
 	force, _ := ActiveForce()
 	for _, name := range resourcepaths {
-		zipfile, err := ioutil.ReadFile(name)
-		result, err := force.Metadata.DeployZipFile(force.Metadata.MakeDeploySoap(*opts), zipfile)
-		byName := false
-		namePaths := make(map[string]string)
-		err = processDeployResults(result, byName, namePaths, err)
+		query, err := zipPackageQuery(name)
 		if err != nil {
 			ErrorAndExit(err.Error())
 		}
+		CheckDeployConflicts(force, query, opts)
+		result, err := force.Metadata.DeployZipPath(force.Metadata.MakeDeploySoap(*opts), name)
+		byName := false
+		namePaths := make(map[string]string)
+		err = processDeployResults(result, byName, namePaths, err)
+		finishDeploy(result, namePaths, opts, err)
+		RecordDeployedMembers(force, query, opts)
 	}
 	return
 }
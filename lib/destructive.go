@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Returns the files of a deploy that deletes the members in the query: an
+// empty package.xml, and the members in destructiveChangesPre.xml if pre,
+// so that they're deleted before the rest of the deploy, otherwise in
+// destructiveChangesPost.xml.
+func DestructiveDeployFiles(query ForceMetadataQuery, pre bool) (files ForceMetadataFiles) {
+	destructive := NewFetchBuilder()
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			for _, member := range element.Members {
+				destructive.AddMetaToPackage(typeName, member)
+			}
+		}
+	}
+	manifest := "destructiveChangesPost.xml"
+	if pre {
+		manifest = "destructiveChangesPre.xml"
+	}
+	files = ForceMetadataFiles{
+		"package.xml": NewFetchBuilder().PackageXml(),
+		manifest:      destructive.DestructiveChangesXml(),
+	}
+	return
+}
+
+// Returns the members in the query that don't exist in the org.
+func (fm *ForceMetadata) MissingMembers(query ForceMetadataQuery) (missing []MetadataMember, err error) {
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			properties, listErr := fm.listTypeMemberProperties(typeName, element.Members)
+			if listErr != nil {
+				return nil, listErr
+			}
+			// Member names are case-insensitive
+			existing := make(map[string]bool)
+			for _, p := range properties {
+				existing[strings.ToLower(p.FullName)] = true
+			}
+			for _, member := range element.Members {
+				if !existing[strings.ToLower(member)] {
+					missing = append(missing, MetadataMember{Type: typeName, Name: member})
+				}
+			}
+		}
+	}
+	return
+}
+
+// Deploy a destructive change deleting the members in the query.
+func DeleteMembers(query ForceMetadataQuery, pre bool, opts *ForceDeployOptions) {
+	fmt.Println("Deleting now...")
+	t0 := time.Now()
+	deployFiles(DestructiveDeployFiles(query, pre), true, make(map[string]string), opts)
+	fmt.Printf("The deployment took %v to run.\n", time.Now().Sub(t0))
+}
@@ -0,0 +1,56 @@
+package lib_test
+
+import (
+	"encoding/xml"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DestructiveDeployFiles", func() {
+	query := ForceMetadataQuery{
+		{Name: []string{"ApexClass"}, Members: []string{"Old", "Old_Test"}},
+	}
+
+	It("should list the members in the post-destructive manifest with an empty package", func() {
+		files := DestructiveDeployFiles(query, false)
+		Expect(files).To(HaveLen(2))
+
+		var pkg Package
+		Expect(xml.Unmarshal(files["package.xml"], &pkg)).To(Succeed())
+		Expect(pkg.Types).To(BeEmpty())
+
+		var destructive Package
+		Expect(xml.Unmarshal(files["destructiveChangesPost.xml"], &destructive)).To(Succeed())
+		Expect(destructive.Types).To(Equal([]MetaType{{Name: "ApexClass", Members: []string{"Old", "Old_Test"}}}))
+		Expect(destructive.Version).To(BeEmpty())
+	})
+
+	It("should list the members in the pre-destructive manifest with pre", func() {
+		files := DestructiveDeployFiles(query, true)
+		Expect(files).To(HaveKey("destructiveChangesPre.xml"))
+		Expect(files).ToNot(HaveKey("destructiveChangesPost.xml"))
+	})
+})
+
+var _ = Describe("MissingMembers", func() {
+	var org *fakeOrg
+
+	BeforeEach(func() {
+		org = newFakeOrg()
+		org.members["ApexClass"] = []MDFileProperties{{FullName: "MyClass", Type: "ApexClass"}}
+	})
+
+	AfterEach(func() {
+		org.Close()
+	})
+
+	It("should match member names case-insensitively", func() {
+		query := ForceMetadataQuery{{Name: []string{"ApexClass"}, Members: []string{"myclass", "Other"}}}
+		missing, err := org.force().Metadata.MissingMembers(query)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(missing).To(Equal([]MetadataMember{{Type: "ApexClass", Name: "Other"}}))
+	})
+})
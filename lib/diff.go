@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A line of a diff: ' ' for a line in both, '-' for a line only in the
+// original and '+' for a line only in the new version.
+type DiffLine struct {
+	Kind byte
+	Text string
+}
+
+// Beyond this many edits between two blocks of lines, finding the shortest
+// edit script isn't worth the time: the blocks are shown as removed and
+// added in full.
+const maxDiffEdits = 2000
+
+// Returns the shortest edit script turning a into b, using the linear space
+// variant of Myers' algorithm.
+func DiffLines(a, b []string) (lines []DiffLine) {
+	// Common prefixes and suffixes don't need to go through the algorithm
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		lines = append(lines, DiffLine{' ', line})
+	}
+	lines = append(lines, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, DiffLine{' ', line})
+	}
+	return
+}
+
+// Diffs a and b, which have no common prefix or suffix, by splitting them
+// where the forward and backward searches for the shortest edit script
+// meet and diffing each half.
+func myersDiff(a, b []string) []DiffLine {
+	if len(a) == 0 || len(b) == 0 {
+		return replaceLines(a, b)
+	}
+	x, y, found := middleSnake(a, b)
+	if !found || (x == 0 && y == 0) || (x == len(a) && y == len(b)) {
+		return replaceLines(a, b)
+	}
+	return append(DiffLines(a[:x], b[:y]), DiffLines(a[x:], b[y:])...)
+}
+
+func replaceLines(a, b []string) (lines []DiffLine) {
+	for _, line := range a {
+		lines = append(lines, DiffLine{'-', line})
+	}
+	for _, line := range b {
+		lines = append(lines, DiffLine{'+', line})
+	}
+	return
+}
+
+// Returns a point on a shortest edit script of a and b, found by searching
+// from both ends at once until the paths overlap, or false if there are
+// more than maxDiffEdits edits.
+func middleSnake(a, b []string) (x, y int, found bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	if maxD > maxDiffEdits {
+		maxD = maxDiffEdits
+	}
+	offset := maxD + 1
+	// forward[k] and backward[k] hold the furthest x reached on diagonal k
+	// from the start and, with reversed coordinates, from the end
+	forward := make([]int, 2*maxD+3)
+	backward := make([]int, 2*maxD+3)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// Diagonals that have run off the edges are skipped
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var fx int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				fx = forward[offset+k+1]
+			} else {
+				fx = forward[offset+k-1] + 1
+			}
+			fy := fx - k
+			for fx < n && fy < m && a[fx] == b[fy] {
+				fx++
+				fy++
+			}
+			forward[offset+k] = fx
+			switch {
+			case fx > n:
+				fEnd += 2
+			case fy > m:
+				fStart += 2
+			case odd:
+				i := offset + delta - k
+				if i >= 0 && i < len(backward) && backward[i] != -1 && fx >= n-backward[i] {
+					return fx, fy, true
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var bx int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				bx = backward[offset+k+1]
+			} else {
+				bx = backward[offset+k-1] + 1
+			}
+			by := bx - k
+			for bx < n && by < m && a[n-bx-1] == b[m-by-1] {
+				bx++
+				by++
+			}
+			backward[offset+k] = bx
+			switch {
+			case bx > n:
+				bEnd += 2
+			case by > m:
+				bStart += 2
+			case !odd:
+				i := offset + delta - k
+				if i >= 0 && i < len(forward) && forward[i] != -1 {
+					fx := forward[i]
+					if fx >= n-bx {
+						return fx, fx - (i - offset), true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Returns a unified diff of from and to with the given number of lines of
+// context, or an empty string if they're the same.
+func UnifiedDiff(fromName, toName string, from, to string, context int) string {
+	lines := DiffLines(splitLines(from), splitLines(to))
+	var changes []int
+	for i, line := range lines {
+		if line.Kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for start := 0; start < len(changes); {
+		// Extend the hunk while the next change is within its context
+		end := start
+		for end+1 < len(changes) && changes[end+1]-changes[end] <= 2*context {
+			end++
+		}
+		first := changes[start] - context
+		if first < 0 {
+			first = 0
+		}
+		last := changes[end] + context
+		if last >= len(lines) {
+			last = len(lines) - 1
+		}
+
+		fromLine, toLine := 1, 1
+		for _, line := range lines[:first] {
+			if line.Kind != '+' {
+				fromLine++
+			}
+			if line.Kind != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, line := range lines[first : last+1] {
+			if line.Kind != '+' {
+				fromCount++
+			}
+			if line.Kind != '-' {
+				toCount++
+			}
+		}
+		if fromCount == 0 {
+			fromLine--
+		}
+		if toCount == 0 {
+			toLine--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+		for _, line := range lines[first : last+1] {
+			out.WriteByte(line.Kind)
+			out.WriteString(line.Text)
+			out.WriteByte('\n')
+		}
+		start = end + 1
+	}
+	return out.String()
+}
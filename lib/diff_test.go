@@ -0,0 +1,159 @@
+package lib_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diff", func() {
+	Describe("DiffLines", func() {
+		It("should find the shortest edit script", func() {
+			a := strings.Split("a b c a b b a", " ")
+			b := strings.Split("c b a b a c", " ")
+			lines := DiffLines(a, b)
+			var from, to []string
+			changes := 0
+			for _, line := range lines {
+				if line.Kind != '+' {
+					from = append(from, line.Text)
+				}
+				if line.Kind != '-' {
+					to = append(to, line.Text)
+				}
+				if line.Kind != ' ' {
+					changes++
+				}
+			}
+			Expect(from).To(Equal(a))
+			Expect(to).To(Equal(b))
+			Expect(changes).To(Equal(5))
+		})
+
+		It("should find the shortest edit script of random inputs", func() {
+			random := rand.New(rand.NewSource(1))
+			lines := func() (lines []string) {
+				for i := random.Intn(30); i > 0; i-- {
+					lines = append(lines, string(rune('a'+random.Intn(4))))
+				}
+				return
+			}
+			// The length of the longest common subsequence gives the number
+			// of edits of the shortest edit script
+			lcs := func(a, b []string) int {
+				lengths := make([][]int, len(a)+1)
+				for i := range lengths {
+					lengths[i] = make([]int, len(b)+1)
+				}
+				for i := len(a) - 1; i >= 0; i-- {
+					for j := len(b) - 1; j >= 0; j-- {
+						if a[i] == b[j] {
+							lengths[i][j] = lengths[i+1][j+1] + 1
+						} else if lengths[i+1][j] > lengths[i][j+1] {
+							lengths[i][j] = lengths[i+1][j]
+						} else {
+							lengths[i][j] = lengths[i][j+1]
+						}
+					}
+				}
+				return lengths[0][0]
+			}
+			for i := 0; i < 500; i++ {
+				a, b := lines(), lines()
+				var from, to []string
+				changes := 0
+				for _, line := range DiffLines(a, b) {
+					if line.Kind != '+' {
+						from = append(from, line.Text)
+					}
+					if line.Kind != '-' {
+						to = append(to, line.Text)
+					}
+					if line.Kind != ' ' {
+						changes++
+					}
+				}
+				Expect(from).To(Equal(a))
+				Expect(to).To(Equal(b))
+				Expect(changes).To(Equal(len(a) + len(b) - 2*lcs(a, b)))
+			}
+		})
+
+		It("should diff large files with scattered changes", func() {
+			var a, b []string
+			for i := 0; i < 8000; i++ {
+				a = append(a, fmt.Sprintf("line %d", i))
+				if i%80 == 0 {
+					b = append(b, fmt.Sprintf("changed %d", i))
+				} else {
+					b = append(b, fmt.Sprintf("line %d", i))
+				}
+			}
+			changes := 0
+			for _, line := range DiffLines(a, b) {
+				if line.Kind != ' ' {
+					changes++
+				}
+			}
+			Expect(changes).To(Equal(200))
+		})
+
+		It("should replace large files that have little in common in full", func() {
+			var a, b []string
+			for i := 0; i < 8000; i++ {
+				a = append(a, fmt.Sprintf("a%d", i))
+				b = append(b, fmt.Sprintf("b%d", i))
+			}
+			a[4000], b[4000] = "common", "common"
+			lines := DiffLines(a, b)
+			Expect(lines).To(HaveLen(16000))
+			Expect(lines[0]).To(Equal(DiffLine{'-', "a0"}))
+			Expect(lines[8000]).To(Equal(DiffLine{'+', "b0"}))
+		})
+
+		It("should handle empty inputs", func() {
+			Expect(DiffLines(nil, nil)).To(BeEmpty())
+			Expect(DiffLines(nil, []string{"a"})).To(Equal([]DiffLine{{'+', "a"}}))
+			Expect(DiffLines([]string{"a"}, nil)).To(Equal([]DiffLine{{'-', "a"}}))
+		})
+	})
+
+	Describe("UnifiedDiff", func() {
+		It("should return nothing for identical text", func() {
+			Expect(UnifiedDiff("a", "b", "x\ny\n", "x\ny\n", 3)).To(Equal(""))
+		})
+
+		It("should show changes with context", func() {
+			from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+			to := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n"
+			Expect(UnifiedDiff("org/f", "local/f", from, to, 2)).To(Equal(`--- org/f
++++ local/f
+@@ -3,5 +3,5 @@
+ 3
+ 4
+-5
++five
+ 6
+ 7
+@@ -9,2 +9,3 @@
+ 9
+ 10
++11
+`))
+		})
+
+		It("should diff against an empty file", func() {
+			Expect(UnifiedDiff("/dev/null", "local/f", "", "a\nb\n", 3)).To(Equal(`--- /dev/null
++++ local/f
+@@ -0,0 +1,2 @@
++a
++b
+`))
+		})
+	})
+})
@@ -0,0 +1,501 @@
+package lib
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/ForceCLI/force/config"
+)
+
+// FetchStateFile is the path of the file recording when each member was
+// last modified in the org as of the last fetch, relative to the project
+// directory.
+var FetchStateFile = filepath.Join(".force", "state.json")
+
+// The last modification of a member in the org as of the last fetch or
+// push.
+type MemberState struct {
+	LastModifiedDate   time.Time `json:"lastModifiedDate"`
+	LastModifiedByName string    `json:"lastModifiedByName,omitempty"`
+}
+
+// FetchState holds the state of the fetched members of each org, by org id
+// and then by "Type:FullName", and the time of the last successful sync of
+// each org, by org id and then by what was synced, e.g. "export".
+type FetchState struct {
+	FileName string                            `json:"-"`
+	Orgs     map[string]map[string]MemberState `json:"orgs"`
+	LastSync map[string]map[string]time.Time   `json:"lastSync,omitempty"`
+}
+
+// A member that was changed in the org after it was last fetched.
+type MemberConflict struct {
+	Type               string
+	FullName           string
+	LastModifiedDate   time.Time
+	LastModifiedByName string
+}
+
+func (c MemberConflict) String() string {
+	return fmt.Sprintf("%s %s was changed by %s at %s", c.Type, c.FullName, c.LastModifiedByName, c.LastModifiedDate.Local().Format(time.RFC1123))
+}
+
+// Load the fetch state of the current project. A missing state file is an
+// empty state.
+func LoadProjectFetchState() (state *FetchState, err error) {
+	dir, err := ProjectDir()
+	if err != nil {
+		return
+	}
+	return LoadFetchState(filepath.Join(dir, FetchStateFile))
+}
+
+func LoadFetchState(fileName string) (state *FetchState, err error) {
+	state = &FetchState{FileName: fileName, Orgs: make(map[string]map[string]MemberState)}
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, state); err != nil {
+		return
+	}
+	if state.Orgs == nil {
+		state.Orgs = make(map[string]map[string]MemberState)
+	}
+	return
+}
+
+// Save the state, replacing the file in one step so that it's never left
+// half-written.
+func (s *FetchState) Save() (err error) {
+	if err = os.MkdirAll(filepath.Dir(s.FileName), 0755); err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.FileName), filepath.Base(s.FileName)+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.FileName)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return
+}
+
+// How long to wait for another process updating the state file, and how
+// old a lock must be to be taken as left behind by a process that died.
+var (
+	fetchStateLockTimeout = 30 * time.Second
+	fetchStateLockStale   = 2 * time.Minute
+)
+
+// Load the state file, apply update to it and save it, holding a lock file
+// so that concurrent fetches don't lose each other's changes.
+func UpdateFetchState(fileName string, update func(state *FetchState)) (err error) {
+	unlock, err := lockFile(fileName, fetchStateLockTimeout, fetchStateLockStale)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	state, err := LoadFetchState(fileName)
+	if err != nil {
+		return
+	}
+	update(state)
+	return state.Save()
+}
+
+func updateProjectFetchState(update func(state *FetchState)) (err error) {
+	dir, err := ProjectDir()
+	if err != nil {
+		return
+	}
+	return UpdateFetchState(filepath.Join(dir, FetchStateFile), update)
+}
+
+// Take a lock on fileName by creating fileName.lock, waiting up to timeout
+// for another holder to release it. Locks older than stale are broken.
+func lockFile(fileName string, timeout, stale time.Duration) (unlock func(), err error) {
+	lockName := fileName + ".lock"
+	if err = os.MkdirAll(filepath.Dir(lockName), 0755); err != nil {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		f, openErr := os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if openErr == nil {
+			f.Close()
+			return func() { os.Remove(lockName) }, nil
+		}
+		if !os.IsExist(openErr) {
+			return nil, openErr
+		}
+		if info, statErr := os.Stat(lockName); statErr == nil && time.Since(info.ModTime()) > stale {
+			os.Remove(lockName)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Timed out waiting for the lock %s", lockName)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func memberStateKey(p MDFileProperties) string {
+	return p.Type + ":" + p.FullName
+}
+
+// Record the last modification of each member in the org.
+func (s *FetchState) Record(orgId string, properties []MDFileProperties) {
+	members, found := s.Orgs[orgId]
+	if !found {
+		members = make(map[string]MemberState)
+		s.Orgs[orgId] = members
+	}
+	for _, p := range properties {
+		// The package.xml is listed as a Package with no date
+		if p.Type == "" || p.Type == "Package" || p.LastModifedDate.IsZero() {
+			continue
+		}
+		members[memberStateKey(p)] = MemberState{
+			LastModifiedDate:   p.LastModifedDate,
+			LastModifiedByName: p.LastModifiedByName,
+		}
+	}
+}
+
+// Returns the members that were modified in the org after their recorded
+// modification. Members that were never recorded aren't conflicts.
+func (s *FetchState) Conflicts(orgId string, properties []MDFileProperties) (conflicts []MemberConflict) {
+	members := s.Orgs[orgId]
+	for _, p := range properties {
+		recorded, found := members[memberStateKey(p)]
+		if !found || !p.LastModifedDate.After(recorded.LastModifiedDate) {
+			continue
+		}
+		conflicts = append(conflicts, MemberConflict{
+			Type:               p.Type,
+			FullName:           p.FullName,
+			LastModifiedDate:   p.LastModifedDate,
+			LastModifiedByName: p.LastModifiedByName,
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Type != conflicts[j].Type {
+			return conflicts[i].Type < conflicts[j].Type
+		}
+		return conflicts[i].FullName < conflicts[j].FullName
+	})
+	return
+}
+
+// Returns the time of the last successful sync of scope from the org.
+func (s *FetchState) LastSyncTime(orgId, scope string) (t time.Time, found bool) {
+	t, found = s.LastSync[orgId][scope]
+	return
+}
+
+func (s *FetchState) SetLastSync(orgId, scope string, t time.Time) {
+	if s.LastSync == nil {
+		s.LastSync = make(map[string]map[string]time.Time)
+	}
+	if s.LastSync[orgId] == nil {
+		s.LastSync[orgId] = make(map[string]time.Time)
+	}
+	s.LastSync[orgId][scope] = t
+}
+
+// Returns the org id of the active session, or "" if it isn't known.
+func (f *Force) OrgId() string {
+	if f.Credentials == nil || f.Credentials.UserInfo == nil {
+		return ""
+	}
+	return f.Credentials.UserInfo.OrgId
+}
+
+// List the file properties of the members in the query. Members in folders
+// are listed by folder.
+func (fm *ForceMetadata) ListMemberProperties(query ForceMetadataQuery) (properties []MDFileProperties, err error) {
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			typeProperties, listErr := fm.listTypeMemberProperties(typeName, element.Members)
+			if listErr != nil {
+				return nil, listErr
+			}
+			properties = append(properties, typeProperties...)
+		}
+	}
+	return
+}
+
+// Returns the listMetadata type of the folders of a type in folders, e.g.
+// ReportFolder.
+func folderTypeName(typeName string) string {
+	if typeName == "EmailTemplate" {
+		return "EmailFolder"
+	}
+	return typeName + "Folder"
+}
+
+func isInFolderType(typeName string) bool {
+	if t, found := FindMetadataType(loadedMetadataTypes(), typeName); found {
+		return t.InFolder
+	}
+	switch typeName {
+	case "Dashboard", "Document", "EmailTemplate", "Report":
+		return true
+	}
+	return false
+}
+
+// List the file properties of the named members of a type, or of all of
+// them with "*". The members of types in folders are listed by folder, and
+// the folders themselves as their folder type. Member names are
+// case-insensitive.
+func (fm *ForceMetadata) listTypeMemberProperties(typeName string, members []string) (properties []MDFileProperties, err error) {
+	inFolder := isInFolderType(typeName)
+	wanted := make(map[string]bool)
+	listQueries := make(map[string]bool)
+	for _, member := range members {
+		wanted[strings.ToLower(member)] = true
+		switch i := strings.LastIndex(member, "/"); {
+		case i > 0:
+			listQueries[typeName+":"+member[:i]] = true
+		case inFolder && member != "*":
+			listQueries[folderTypeName(typeName)] = true
+		case !inFolder:
+			listQueries[typeName] = true
+		}
+	}
+	for listQuery := range listQueries {
+		results, listErr := fm.listMetadataProperties(listQuery)
+		if listErr != nil {
+			return nil, listErr
+		}
+		for _, p := range results {
+			if wanted[strings.ToLower(p.FullName)] || wanted["*"] {
+				properties = append(properties, p)
+			}
+		}
+	}
+	return
+}
+
+// List the file properties of the members of a type, given as "Type" or
+// "Type:Folder".
+func (fm *ForceMetadata) listMetadataProperties(listQuery string) (properties []MDFileProperties, err error) {
+	body, err := fm.ListMetadata(listQuery)
+	if err != nil {
+		return
+	}
+	var res struct {
+		Results []MDFileProperties `xml:"Body>listMetadataResponse>result"`
+	}
+	if err = xml.Unmarshal(body, &res); err != nil {
+		return
+	}
+	properties = res.Results
+	return
+}
+
+// Returns a query retrieving only the members in the query that were
+// modified after since. Types that can't be listed are kept whole. Changed
+// members of child types, such as fields, are retrieved with their parents
+// when the parent type is in the query, so that the parent's file is
+// complete.
+func (fm *ForceMetadata) ChangedMembersQuery(query ForceMetadataQuery, since time.Time) (changed ForceMetadataQuery) {
+	parentTypes := make(map[string]string)
+	for _, t := range loadedMetadataTypes() {
+		for _, child := range t.ChildXmlNames {
+			parentTypes[child] = t.Name
+		}
+	}
+	var typeNames []string
+	queried := make(map[string]bool)
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			typeNames = append(typeNames, typeName)
+			queried[typeName] = true
+		}
+	}
+
+	changedMembers := make(map[string][]string)
+	addMember := func(typeName, member string) {
+		for _, m := range changedMembers[typeName] {
+			if m == member {
+				return
+			}
+		}
+		changedMembers[typeName] = append(changedMembers[typeName], member)
+	}
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			properties, err := fm.listTypeMemberProperties(typeName, element.Members)
+			if err != nil {
+				if Verbose {
+					fmt.Fprintf(os.Stderr, "Could not list %s, retrieving all: %s\n", typeName, err.Error())
+				}
+				for _, member := range element.Members {
+					addMember(typeName, member)
+				}
+				continue
+			}
+			for _, p := range properties {
+				if !p.LastModifedDate.After(since) {
+					continue
+				}
+				parent, isChild := parentTypes[typeName]
+				if i := strings.Index(p.FullName, "."); isChild && queried[parent] && i > 0 {
+					addMember(parent, p.FullName[:i])
+				} else {
+					addMember(typeName, p.FullName)
+				}
+			}
+		}
+	}
+	for _, typeName := range typeNames {
+		if members := changedMembers[typeName]; len(members) > 0 {
+			sort.Strings(members)
+			changed = append(changed, ForceMetadataQueryElement{Name: []string{typeName}, Members: members})
+			delete(changedMembers, typeName)
+		}
+	}
+	return
+}
+
+// Parse the time given to -since: an RFC 3339 timestamp, or a date and
+// optional time in local time.
+func ParseSince(value string) (t time.Time, err error) {
+	if t, err = time.Parse(time.RFC3339, value); err == nil {
+		return
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("Invalid time %q; use a timestamp such as 2006-01-02T15:04:05Z, a date such as 2006-01-02, or last", value)
+	return
+}
+
+// Record the members of the last retrieve in the project's fetch state.
+func (f *Force) RecordRetrievedMembers() (err error) {
+	return f.recordMembers(f.Metadata.RetrievedFileProperties)
+}
+
+func (f *Force) recordMembers(properties []MDFileProperties) (err error) {
+	orgId := f.OrgId()
+	if orgId == "" || len(properties) == 0 {
+		return
+	}
+	return updateProjectFetchState(func(state *FetchState) {
+		state.Record(orgId, properties)
+	})
+}
+
+// Returns the members in the query that were changed in the org since they
+// were last fetched or pushed.
+func (f *Force) FetchConflicts(query ForceMetadataQuery) (conflicts []MemberConflict, err error) {
+	orgId := f.OrgId()
+	if orgId == "" {
+		return
+	}
+	state, err := LoadProjectFetchState()
+	if err != nil || len(state.Orgs[orgId]) == 0 {
+		return
+	}
+	properties, err := f.Metadata.ListMemberProperties(query)
+	if err != nil {
+		return
+	}
+	return state.Conflicts(orgId, properties), nil
+}
+
+// Record the current state of the members in the query, e.g. after pushing
+// them.
+func (f *Force) RecordMembers(query ForceMetadataQuery) (err error) {
+	properties, err := f.Metadata.ListMemberProperties(query)
+	if err != nil {
+		return
+	}
+	return f.recordMembers(properties)
+}
+
+// Resolve the value of -since. "last" is the time of the last successful
+// sync of scope from the org, or the zero time if there hasn't been one.
+func (f *Force) SinceTime(value, scope string) (t time.Time, err error) {
+	if value != "last" {
+		return ParseSince(value)
+	}
+	state, err := LoadProjectFetchState()
+	if err != nil {
+		return
+	}
+	t, _ = state.LastSyncTime(f.OrgId(), scope)
+	return
+}
+
+// How much earlier than the local time a sync is recorded as starting when
+// the org's time isn't known, to allow for the local clock being ahead.
+var syncClockMargin = 10 * time.Minute
+
+// Returns the time to record as the start of a sync beginning now. Members'
+// modification dates are in the org's clock, so it's the org's time, or the
+// local time less a margin if that isn't available. Without an org id no
+// sync is recorded, so the org isn't asked.
+func (f *Force) SyncStartTime() time.Time {
+	if f.OrgId() == "" {
+		return time.Time{}
+	}
+	if t, err := f.ServerTime(); err == nil {
+		return t
+	}
+	return time.Now().Add(-syncClockMargin)
+}
+
+// Returns the org's current time, to the second, from the Date header of a
+// REST response.
+func (f *Force) ServerTime() (t time.Time, err error) {
+	req, err := httpRequest("GET", fmt.Sprintf("%s/services/data/", f.Credentials.InstanceUrl), nil)
+	if err != nil {
+		return
+	}
+	res, err := doRequest(req)
+	if err != nil {
+		return
+	}
+	res.Body.Close()
+	return http.ParseTime(res.Header.Get("Date"))
+}
+
+// Remember t as the time of the last successful sync of scope from the org.
+func (f *Force) RecordSync(scope string, t time.Time) (err error) {
+	orgId := f.OrgId()
+	if orgId == "" {
+		return
+	}
+	return updateProjectFetchState(func(state *FetchState) {
+		state.SetLastSync(orgId, scope, t)
+	})
+}
@@ -0,0 +1,146 @@
+package lib_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FetchState", func() {
+	var (
+		tempDir string
+		state   *FetchState
+		fetched time.Time
+	)
+
+	BeforeEach(func() {
+		tempDir, _ = ioutil.TempDir("", "fetchstate-test")
+		state, _ = LoadFetchState(filepath.Join(tempDir, ".force", "state.json"))
+		fetched = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		state.Record("00D1", []MDFileProperties{
+			{Type: "ApexClass", FullName: "Foo", LastModifedDate: fetched, LastModifiedByName: "Alice"},
+			{Type: "ApexClass", FullName: "Bar", LastModifedDate: fetched, LastModifiedByName: "Alice"},
+			{Type: "Package", FullName: "package.xml"},
+		})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	It("should report members changed since they were recorded", func() {
+		changed := fetched.Add(time.Hour)
+		conflicts := state.Conflicts("00D1", []MDFileProperties{
+			{Type: "ApexClass", FullName: "Foo", LastModifedDate: changed, LastModifiedByName: "Bob"},
+			{Type: "ApexClass", FullName: "Bar", LastModifedDate: fetched, LastModifiedByName: "Alice"},
+			{Type: "ApexClass", FullName: "New", LastModifedDate: changed, LastModifiedByName: "Bob"},
+		})
+		Expect(conflicts).To(Equal([]MemberConflict{
+			{Type: "ApexClass", FullName: "Foo", LastModifiedDate: changed, LastModifiedByName: "Bob"},
+		}))
+	})
+
+	It("should keep state separate for each org", func() {
+		conflicts := state.Conflicts("00D2", []MDFileProperties{
+			{Type: "ApexClass", FullName: "Foo", LastModifedDate: fetched.Add(time.Hour)},
+		})
+		Expect(conflicts).To(BeEmpty())
+	})
+
+	It("should save and load the state", func() {
+		Expect(state.Save()).To(Succeed())
+		loaded, err := LoadFetchState(state.FileName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded.Orgs["00D1"]).To(HaveLen(2))
+		Expect(loaded.Orgs["00D1"]["ApexClass:Foo"].LastModifiedByName).To(Equal("Alice"))
+		Expect(loaded.Orgs["00D1"]["ApexClass:Foo"].LastModifiedDate.Equal(fetched)).To(BeTrue())
+	})
+
+	It("should remember the last sync of each org", func() {
+		state.SetLastSync("00D1", "export", fetched)
+		Expect(state.Save()).To(Succeed())
+		loaded, _ := LoadFetchState(state.FileName)
+		last, found := loaded.LastSyncTime("00D1", "export")
+		Expect(found).To(BeTrue())
+		Expect(last.Equal(fetched)).To(BeTrue())
+		_, found = loaded.LastSyncTime("00D2", "export")
+		Expect(found).To(BeFalse())
+	})
+	It("should not lose concurrent updates", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer GinkgoRecover()
+				Expect(UpdateFetchState(state.FileName, func(s *FetchState) {
+					s.Record("00D1", []MDFileProperties{{Type: "ApexClass", FullName: fmt.Sprintf("C%d", i), LastModifedDate: fetched}})
+				})).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+		loaded, _ := LoadFetchState(state.FileName)
+		Expect(loaded.Orgs["00D1"]).To(HaveLen(10))
+		leftover, _ := filepath.Glob(filepath.Join(tempDir, ".force", "state.json.*"))
+		Expect(leftover).To(BeEmpty())
+	})
+})
+
+var _ = Describe("SyncStartTime", func() {
+	It("should use the org's time", func() {
+		orgTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", orgTime.Format(http.TimeFormat))
+		}))
+		defer server.Close()
+		force := NewForce(&ForceSession{InstanceUrl: server.URL, UserInfo: &UserInfo{OrgId: "00D1"}})
+		Expect(force.SyncStartTime().Equal(orgTime)).To(BeTrue())
+	})
+
+	It("should allow for clock differences without the org's time", func() {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		force := NewForce(&ForceSession{InstanceUrl: server.URL, UserInfo: &UserInfo{OrgId: "00D1"}})
+		Expect(force.SyncStartTime()).To(BeTemporally("<", time.Now().Add(-time.Minute)))
+	})
+
+	It("should not ask the org when no sync will be recorded", func() {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		}))
+		defer server.Close()
+		force := NewForce(&ForceSession{InstanceUrl: server.URL})
+		force.SyncStartTime()
+		Expect(requests).To(Equal(0))
+	})
+})
+
+var _ = Describe("ParseSince", func() {
+	It("should parse timestamps", func() {
+		t, err := ParseSince("2020-01-02T03:04:05Z")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))).To(BeTrue())
+	})
+
+	It("should parse dates in local time", func() {
+		t, err := ParseSince("2020-01-02")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local))).To(BeTrue())
+	})
+
+	It("should reject other values", func() {
+		_, err := ParseSince("yesterday")
+		Expect(err).To(HaveOccurred())
+	})
+})
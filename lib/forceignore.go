@@ -0,0 +1,196 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	. "github.com/ForceCLI/force/config"
+)
+
+// Verbose enables detailed output from library operations, such as reporting
+// files excluded by .forceignore.
+var Verbose bool
+
+// Paths to exclude from deploys and retrieves, read from a .forceignore
+// file using .gitignore syntax. Patterns are relative to the directory
+// containing the file.
+type ForceIgnore struct {
+	Root  string
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Load the .forceignore file in the project directory. If there is none,
+// nothing is ignored.
+func LoadProjectForceIgnore() (ignore *ForceIgnore, err error) {
+	dir, err := ProjectDir()
+	if err != nil {
+		return
+	}
+	return LoadForceIgnore(filepath.Join(dir, ".forceignore"))
+}
+
+func LoadForceIgnore(fileName string) (ignore *ForceIgnore, err error) {
+	root, err := filepath.Abs(filepath.Dir(fileName))
+	if err != nil {
+		return
+	}
+	ignore = &ForceIgnore{Root: root}
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return ignore, nil
+	} else if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			ignore.rules = append(ignore.rules, rule)
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+func NewForceIgnore(root string, patterns []string) (ignore *ForceIgnore) {
+	ignore = &ForceIgnore{Root: root}
+	for _, line := range patterns {
+		if rule, ok := parseIgnoreRule(line); ok {
+			ignore.rules = append(ignore.rules, rule)
+		}
+	}
+	return
+}
+
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var expr strings.Builder
+	if anchored {
+		expr.WriteString("^")
+	} else {
+		expr.WriteString("(^|/)")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case strings.HasPrefix(line[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(line[i:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := line[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(line):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(line[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	pattern, err := regexp.Compile(expr.String())
+	if err != nil {
+		return
+	}
+	rule.pattern = pattern
+	ok = true
+	return
+}
+
+// Returns whether the path, relative to the project directory, matches the
+// ignore rules. Like git, files in an ignored directory are ignored even if a
+// later rule would include them.
+func (ignore *ForceIgnore) Match(path string, isDir bool) bool {
+	if ignore == nil || len(ignore.rules) == 0 {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		prefixIsDir := isDir || i < len(parts)-1
+		ignored := false
+		for _, rule := range ignore.rules {
+			if rule.dirOnly && !prefixIsDir {
+				continue
+			}
+			if rule.pattern.MatchString(prefix) {
+				ignored = !rule.negate
+			}
+		}
+		if ignored {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the file or directory at path is ignored, reporting it
+// in verbose mode.
+func (ignore *ForceIgnore) Ignored(path string) bool {
+	if ignore == nil || len(ignore.rules) == 0 {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(ignore.Root, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	isDir := false
+	if info, err := os.Stat(abs); err == nil {
+		isDir = info.IsDir()
+	}
+	if !ignore.Match(rel, isDir) {
+		return false
+	}
+	if Verbose {
+		fmt.Fprintf(os.Stderr, "Ignoring %s\n", path)
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package lib_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ForceIgnore", func() {
+	Describe("Match", func() {
+		It("should match file names at any depth", func() {
+			ignore := NewForceIgnore("/project", []string{"# comment", "", "*.bak", "jsconfig.json"})
+			Expect(ignore.Match("src/classes/Foo.cls.bak", false)).To(BeTrue())
+			Expect(ignore.Match("src/lwc/jsconfig.json", false)).To(BeTrue())
+			Expect(ignore.Match("src/classes/Foo.cls", false)).To(BeFalse())
+		})
+
+		It("should anchor patterns containing a slash", func() {
+			ignore := NewForceIgnore("/project", []string{"/src/profiles", "src/classes/Old*.cls"})
+			Expect(ignore.Match("src/profiles/Admin.profile", false)).To(BeTrue())
+			Expect(ignore.Match("other/src/profiles/Admin.profile", false)).To(BeFalse())
+			Expect(ignore.Match("src/classes/OldController.cls", false)).To(BeTrue())
+			Expect(ignore.Match("src/classes/sub/OldController.cls", false)).To(BeFalse())
+		})
+
+		It("should only match directories with a trailing slash", func() {
+			ignore := NewForceIgnore("/project", []string{"__tests__/"})
+			Expect(ignore.Match("src/lwc/cmp/__tests__/cmp.test.js", false)).To(BeTrue())
+			Expect(ignore.Match("src/lwc/cmp/__tests__", false)).To(BeFalse())
+			Expect(ignore.Match("src/lwc/cmp/__tests__", true)).To(BeTrue())
+		})
+
+		It("should support double asterisks", func() {
+			ignore := NewForceIgnore("/project", []string{"src/**/*.txt", "**/reports"})
+			Expect(ignore.Match("src/notes.txt", false)).To(BeTrue())
+			Expect(ignore.Match("src/a/b/notes.txt", false)).To(BeTrue())
+			Expect(ignore.Match("src/reports/r.report", false)).To(BeTrue())
+		})
+
+		It("should re-include negated files", func() {
+			ignore := NewForceIgnore("/project", []string{"src/classes/*", "!src/classes/Keep.cls"})
+			Expect(ignore.Match("src/classes/Drop.cls", false)).To(BeTrue())
+			Expect(ignore.Match("src/classes/Keep.cls", false)).To(BeFalse())
+		})
+
+		It("should not re-include files in an ignored directory", func() {
+			ignore := NewForceIgnore("/project", []string{"src/classes/", "!src/classes/Keep.cls"})
+			Expect(ignore.Match("src/classes/Keep.cls", false)).To(BeTrue())
+		})
+	})
+
+	Describe("LoadForceIgnore", func() {
+		var projectDir string
+
+		BeforeEach(func() {
+			projectDir, _ = ioutil.TempDir("", "forceignore-test")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(projectDir)
+		})
+
+		It("should ignore nothing without a .forceignore file", func() {
+			ignore, err := LoadForceIgnore(filepath.Join(projectDir, ".forceignore"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ignore.Ignored(filepath.Join(projectDir, "src", "classes", "Foo.cls"))).To(BeFalse())
+		})
+
+		It("should match paths relative to the project directory", func() {
+			ioutil.WriteFile(filepath.Join(projectDir, ".forceignore"), []byte("src/classes/Foo.cls\n"), 0644)
+			ignore, err := LoadForceIgnore(filepath.Join(projectDir, ".forceignore"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ignore.Ignored(filepath.Join(projectDir, "src", "classes", "Foo.cls"))).To(BeTrue())
+			Expect(ignore.Ignored(filepath.Join(projectDir, "src", "classes", "Bar.cls"))).To(BeFalse())
+			Expect(ignore.Ignored("/elsewhere/src/classes/Foo.cls")).To(BeFalse())
+		})
+	})
+})
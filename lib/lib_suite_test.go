@@ -1,6 +1,21 @@
 package lib_test
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+
+	. "github.com/ForceCLI/force/lib"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -11,3 +26,133 @@ func TestLib(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Lib Suite")
 }
+
+// A fake org answering the listMetadata calls, queries and sobject listing
+// used to list members, and retrieves.
+type fakeOrg struct {
+	server *httptest.Server
+	// Members by listMetadata query, e.g. "ApexClass" or "Report:Sales"
+	members map[string][]MDFileProperties
+	// Records by the object queried
+	records  map[string][]ForceRecord
+	sobjects []ForceSobject
+	// Returns the files of a retrieve, or an error failing it
+	retrieve func(query ForceMetadataQuery) (ForceMetadataFiles, error)
+
+	mutex sync.Mutex
+	// The queries retrieved, in order
+	retrieved []ForceMetadataQuery
+	results   []fakeRetrieveResult
+}
+
+type fakeRetrieveResult struct {
+	files ForceMetadataFiles
+	query ForceMetadataQuery
+	err   error
+}
+
+var listMetadataQuery = regexp.MustCompile(`<type>([^<]*)</type>(?:<folder>([^<]*)</folder>)?`)
+var queriedObject = regexp.MustCompile(`(?i)\bFROM\s+(\w+)`)
+
+func newFakeOrg() *fakeOrg {
+	org := &fakeOrg{members: make(map[string][]MDFileProperties), records: make(map[string][]ForceRecord)}
+	org.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("SOAPAction") == "retrieve" || r.Header.Get("SOAPAction") == "checkStatus" || r.Header.Get("SOAPAction") == "checkRetrieveStatus":
+			org.serveRetrieve(w, r)
+		case strings.Contains(r.URL.Path, "/services/Soap/m/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			var results []byte
+			for _, match := range listMetadataQuery.FindAllStringSubmatch(string(body), -1) {
+				query := match[1]
+				if match[2] != "" {
+					query += ":" + match[2]
+				}
+				for _, p := range org.members[query] {
+					result, _ := xml.Marshal(struct {
+						XMLName xml.Name `xml:"result"`
+						MDFileProperties
+					}{MDFileProperties: p})
+					results = append(results, result...)
+				}
+			}
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><listMetadataResponse>`))
+			w.Write(results)
+			w.Write([]byte(`</listMetadataResponse></soapenv:Body></soapenv:Envelope>`))
+		case strings.HasSuffix(r.URL.Path, "/sobjects"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"sobjects": org.sobjects})
+		case strings.HasSuffix(r.URL.Path, "/query"):
+			records := []ForceRecord{}
+			if match := queriedObject.FindStringSubmatch(r.URL.Query().Get("q")); match != nil {
+				records = append(records, org.records[match[1]]...)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"done": true, "totalSize": len(records), "records": records})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return org
+}
+
+var soapId = regexp.MustCompile(`<id>(\d+)</id>`)
+
+func (org *fakeOrg) serveRetrieve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	org.mutex.Lock()
+	defer org.mutex.Unlock()
+	var response string
+	switch r.Header.Get("SOAPAction") {
+	case "retrieve":
+		var request struct {
+			Types []MetaType `xml:"Body>retrieve>retrieveRequest>unpackaged>types"`
+		}
+		xml.Unmarshal(body, &request)
+		var query ForceMetadataQuery
+		for _, t := range request.Types {
+			query = append(query, ForceMetadataQueryElement{Name: []string{t.Name}, Members: t.Members})
+		}
+		org.retrieved = append(org.retrieved, query)
+		files, err := org.retrieve(query)
+		org.results = append(org.results, fakeRetrieveResult{files: files, query: query, err: err})
+		response = fmt.Sprintf(`<retrieveResponse><result><id>%d</id></result></retrieveResponse>`, len(org.results)-1)
+	case "checkStatus":
+		var id int
+		fmt.Sscan(soapId.FindStringSubmatch(string(body))[1], &id)
+		if err := org.results[id].err; err != nil {
+			response = fmt.Sprintf(`<checkStatusResponse><result><done>true</done><state>Error</state><message>%s</message></result></checkStatusResponse>`, err.Error())
+		} else {
+			response = `<checkStatusResponse><result><done>true</done><state>Completed</state></result></checkStatusResponse>`
+		}
+	case "checkRetrieveStatus":
+		var id int
+		fmt.Sscan(soapId.FindStringSubmatch(string(body))[1], &id)
+		result := org.results[id]
+		pb := NewFetchBuilder()
+		for _, element := range result.query {
+			for _, member := range element.Members {
+				pb.AddMetaToPackage(element.Name[0], member)
+			}
+		}
+		zipData := new(bytes.Buffer)
+		zipWriter := zip.NewWriter(zipData)
+		files := ForceMetadataFiles{"package.xml": pb.PackageXml()}
+		for name, data := range result.files {
+			files[name] = data
+		}
+		for name, data := range files {
+			f, _ := zipWriter.Create("unpackaged/" + name)
+			f.Write(data)
+		}
+		zipWriter.Close()
+		response = fmt.Sprintf(`<checkRetrieveStatusResponse><result><zipFile>%s</zipFile></result></checkRetrieveStatusResponse>`, base64.StdEncoding.EncodeToString(zipData.Bytes()))
+	}
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>%s</soapenv:Body></soapenv:Envelope>`, response)
+}
+
+func (org *fakeOrg) force() *Force {
+	return NewForce(&ForceSession{InstanceUrl: org.server.URL})
+}
+
+func (org *fakeOrg) Close() {
+	org.server.Close()
+}
@@ -0,0 +1,35 @@
+package lib
+
+// Manageable states of members installed from a managed package.
+var managedStates = map[string]bool{
+	"installed":          true,
+	"installedEditable":  true,
+	"deprecated":         true,
+	"deprecatedEditable": true,
+}
+
+// Returns whether the member was installed from a managed package.
+func IsManagedMember(p MDFileProperties) bool {
+	return managedStates[p.ManageableState]
+}
+
+// List every member of a type. Types in folders are listed folder by
+// folder, and their folders are included as members.
+func (fm *ForceMetadata) ListAllMembers(typeName string) (properties []MDFileProperties, err error) {
+	if !isInFolderType(typeName) {
+		return fm.listMetadataProperties(typeName)
+	}
+	folders, err := fm.listMetadataProperties(folderTypeName(typeName))
+	if err != nil {
+		return
+	}
+	properties = append(properties, folders...)
+	for _, folder := range folders {
+		members, listErr := fm.listMetadataProperties(typeName + ":" + folder.FullName)
+		if listErr != nil {
+			return nil, listErr
+		}
+		properties = append(properties, members...)
+	}
+	return
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -16,6 +17,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	. "github.com/ForceCLI/force/error"
@@ -95,15 +97,16 @@ type ForceConnectedApp struct {
 }
 
 type ComponentFailure struct {
-	Changed     bool   `xml:"changed"`
-	Created     bool   `xml:"created"`
-	Deleted     bool   `xml:"deleted"`
-	FileName    string `xml:"fileName"`
-	FullName    string `xml:"fullName"`
-	LineNumber  int    `xml:"lineNumber"`
-	Problem     string `xml:"problem"`
-	ProblemType string `xml:"problemType"`
-	Success     bool   `xml:"success"`
+	Changed       bool   `xml:"changed"`
+	ComponentType string `xml:"componentType"`
+	Created       bool   `xml:"created"`
+	Deleted       bool   `xml:"deleted"`
+	FileName      string `xml:"fileName"`
+	FullName      string `xml:"fullName"`
+	LineNumber    int    `xml:"lineNumber"`
+	Problem       string `xml:"problem"`
+	ProblemType   string `xml:"problemType"`
+	Success       bool   `xml:"success"`
 }
 
 type ComponentSuccess struct {
@@ -135,6 +138,13 @@ type CodeCoverageWarning struct {
 	Message string `xml:"message"`
 }
 
+type CodeCoverageResult struct {
+	Name                   string `xml:"name"`
+	Type                   string `xml:"type"`
+	NumLocations           int    `xml:"numLocations"`
+	NumLocationsNotCovered int    `xml:"numLocationsNotCovered"`
+}
+
 type RunTestResult struct {
 	NumberOfFailures     int                   `xml:"numFailures"`
 	NumberOfTestsRun     int                   `xml:"numTestsRun"`
@@ -142,6 +152,7 @@ type RunTestResult struct {
 	TestFailures         []TestFailure         `xml:"failures"`
 	TestSuccesses        []TestSuccess         `xml:"successes"`
 	CodeCoverageWarnings []CodeCoverageWarning `xml:"codeCoverageWarnings"`
+	CodeCoverage         []CodeCoverageResult  `xml:"codeCoverage"`
 }
 
 type ComponentDetails struct {
@@ -192,6 +203,15 @@ type ForceMetadataFiles map[string][]byte
 type ForceMetadata struct {
 	ApiVersion string
 	Force      *Force
+	// Properties of the files of the last retrieve
+	RetrievedFileProperties []MDFileProperties
+	// Maximum estimated number of files retrieved at once, and the number
+	// of retrieves run at once; see DefaultRetrieveChunkSize and
+	// DefaultRetrieveConcurrency.
+	RetrieveChunkSize   int
+	RetrieveConcurrency int
+	// Guards the session while chunks are retrieved concurrently
+	sessionMutex sync.RWMutex
 }
 
 type ForceDeployOptions struct {
@@ -206,6 +226,22 @@ type ForceDeployOptions struct {
 	TestLevel         string   `xml:"testLevel,omitempty"`
 	RunTests          []string `xml:"runTests"`
 	SinglePackage     bool     `xml:"singlePackage"`
+
+	// Not sent to Salesforce; controls how the deploy result is reported.
+	ReportFormat string `xml:"-"`
+	ReportFile   string `xml:"-"`
+
+	// Not sent to Salesforce; minimum coverage percentages enforced after
+	// tests run.
+	MinCoverage      float64 `xml:"-"`
+	MinClassCoverage float64 `xml:"-"`
+
+	// Not sent to Salesforce; deploy even if members changed in the org
+	// since they were fetched.
+	IgnoreConflicts bool `xml:"-"`
+	// Not sent to Salesforce; directory to write a rollback package to
+	// before deploying.
+	Snapshot string `xml:"-"`
 }
 
 /* These structs define which options are available and which are
@@ -726,37 +762,69 @@ func (fm *ForceMetadata) CheckDeployStatus(id string) (results ForceCheckDeploym
 }
 
 func (fm *ForceMetadata) CheckRetrieveStatus(id string) (files ForceMetadataFiles, problems []string, err error) {
-	body, err := fm.soapExecute("checkRetrieveStatus", fmt.Sprintf("<id>%s</id>", id))
+	files, problems, fm.RetrievedFileProperties, err = fm.checkRetrieveStatus(id)
+	return
+}
+
+func (fm *ForceMetadata) checkRetrieveStatus(id string) (files ForceMetadataFiles, problems []string, properties []MDFileProperties, err error) {
+	files = make(ForceMetadataFiles)
+	problems, properties, err = fm.extractRetrieveStatus(id, func(name string, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		files[name] = data
+		return err
+	})
+	return
+}
+
+// Check the status of a retrieve, passing each file of the retrieved zip to
+// extract as it's unzipped. The zip is decoded to a temporary file as it's
+// received, so neither it nor its files are held in memory.
+func (fm *ForceMetadata) extractRetrieveStatus(id string, extract func(name string, r io.Reader) error) (problems []string, properties []MDFileProperties, err error) {
+	zipFile, err := ioutil.TempFile("", "force-retrieve-*.zip")
+	if err != nil {
+		return
+	}
+	defer os.Remove(zipFile.Name())
+	defer zipFile.Close()
+	body, err := fm.soapExecuteToFile("checkRetrieveStatus", fmt.Sprintf("<id>%s</id>", id), zipFile)
 	if err != nil {
 		fmt.Printf("Hrm... will probably try again\n")
 		return
 	}
 	var status struct {
-		ZipFile  string   `xml:"Body>checkRetrieveStatusResponse>result>zipFile"`
-		Problems []string `xml:"Body>checkRetrieveStatusResponse>result>messages>problem"`
+		Problems       []string           `xml:"Body>checkRetrieveStatusResponse>result>messages>problem"`
+		FileProperties []MDFileProperties `xml:"Body>checkRetrieveStatusResponse>result>fileProperties"`
 	}
 	if err = xml.Unmarshal(body, &status); err != nil {
 		return
 	}
-	data, err := base64.StdEncoding.DecodeString(status.ZipFile)
+	properties = status.FileProperties
+	problems = status.Problems
+
+	size, err := zipFile.Seek(0, io.SeekEnd)
 	if err != nil {
 		return
 	}
-	problems = status.Problems
-
-	zipfiles, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if preserveZip == true {
-		ioutil.WriteFile("inbound.zip", data, 0644)
+		if inbound, createErr := os.Create("inbound.zip"); createErr == nil {
+			io.Copy(inbound, io.NewSectionReader(zipFile, 0, size))
+			inbound.Close()
+		}
 	}
+	zipfiles, err := zip.NewReader(zipFile, size)
 	if err != nil {
 		return
 	}
-	files = make(map[string][]byte)
 	for _, file := range zipfiles.File {
-		fd, _ := file.Open()
-		defer fd.Close()
-		data, _ := ioutil.ReadAll(fd)
-		files[file.Name] = data
+		var fd io.ReadCloser
+		if fd, err = file.Open(); err != nil {
+			return
+		}
+		err = extract(file.Name, fd)
+		fd.Close()
+		if err != nil {
+			return
+		}
 	}
 	return
 }
@@ -1201,17 +1269,82 @@ func (fm *ForceMetadata) MakeDeploySoap(options ForceDeployOptions) (soap string
 
 func (fm *ForceMetadata) MakeZip(files ForceMetadataFiles) (zipdata []byte, err error) {
 	zipfile := new(bytes.Buffer)
-	zipper := zip.NewWriter(zipfile)
+	if err = writeZip(zipfile, files); err != nil {
+		return
+	}
+	zipdata = zipfile.Bytes()
+	return
+}
+
+// Write the files to a zip in the temporary directory, returning its name.
+// The caller removes it.
+func (fm *ForceMetadata) MakeZipFile(files ForceMetadataFiles) (name string, err error) {
+	zipfile, err := ioutil.TempFile("", "force-deploy-*.zip")
+	if err != nil {
+		return
+	}
+	defer zipfile.Close()
+	name = zipfile.Name()
+	if err = writeZip(zipfile, files); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return
+}
+
+// Write the files at the paths, by their names in the package, and the
+// files to a zip in the temporary directory, returning its name. The files
+// at the paths are copied into the zip one at a time rather than read into
+// memory. The caller removes it.
+func (fm *ForceMetadata) MakeZipFileFromPaths(paths map[string]string, files ForceMetadataFiles) (name string, err error) {
+	zipfile, err := ioutil.TempFile("", "force-deploy-*.zip")
+	if err != nil {
+		return
+	}
+	defer zipfile.Close()
+	name = zipfile.Name()
+	if err = writeZipPaths(zipfile, paths, files); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return
+}
+
+func writeZip(w io.Writer, files ForceMetadataFiles) (err error) {
+	return writeZipPaths(w, nil, files)
+}
+
+func writeZipPaths(w io.Writer, paths map[string]string, files ForceMetadataFiles) (err error) {
+	zipper := zip.NewWriter(w)
+	for name, path := range paths {
+		wr, err := zipper.Create(fmt.Sprintf("unpackaged/%s", filepath.ToSlash(name)))
+		if err != nil {
+			return err
+		}
+		if err = copyFile(wr, path); err != nil {
+			return err
+		}
+	}
 	for name, data := range files {
 		name = filepath.ToSlash(name)
 		wr, err := zipper.Create(fmt.Sprintf("unpackaged/%s", name))
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if _, err = wr.Write(data); err != nil {
+			return err
 		}
-		wr.Write(data)
 	}
-	zipper.Close()
-	zipdata = zipfile.Bytes()
+	return zipper.Close()
+}
+
+func copyFile(w io.Writer, path string) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
 	return
 }
 
@@ -1236,18 +1369,45 @@ func (fm *ForceMetadata) DeployWithTempFile(soap string, filename string) {
 }
 
 func (fm *ForceMetadata) Deploy(files ForceMetadataFiles, options ForceDeployOptions) (results ForceCheckDeploymentStatusResult, err error) {
+	return fm.DeployPaths(nil, files, options)
+}
+
+// Deploy the files at the paths, by their names in the package, together
+// with the files, building the zip from disk so that the contents of the
+// files at the paths aren't held in memory.
+func (fm *ForceMetadata) DeployPaths(paths map[string]string, files ForceMetadataFiles, options ForceDeployOptions) (results ForceCheckDeploymentStatusResult, err error) {
 	soap := fm.MakeDeploySoap(options)
 
-	zipfile, err := fm.MakeZip(files)
+	zipfile, err := fm.MakeZipFileFromPaths(paths, files)
+	if err != nil {
+		return
+	}
+	defer os.Remove(zipfile)
 
-	results, err = fm.DeployZipFile(soap, zipfile)
+	results, err = fm.DeployZipPath(soap, zipfile)
 	return
 }
 
 func (fm *ForceMetadata) DeployZipFile(soap string, zipfile []byte) (results ForceCheckDeploymentStatusResult, err error) {
-	//ioutil.WriteFile("package.zip", zipfile, 0644)
-	encoded := base64.StdEncoding.EncodeToString(zipfile)
-	body, err := fm.soapExecute("deploy", fmt.Sprintf(soap, encoded))
+	return fm.deployZip(soap, bytes.NewReader(zipfile), int64(len(zipfile)))
+}
+
+// Deploy the zip file at path, streaming it from disk.
+func (fm *ForceMetadata) DeployZipPath(soap string, path string) (results ForceCheckDeploymentStatusResult, err error) {
+	zipfile, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer zipfile.Close()
+	info, err := zipfile.Stat()
+	if err != nil {
+		return
+	}
+	return fm.deployZip(soap, zipfile, info.Size())
+}
+
+func (fm *ForceMetadata) deployZip(soap string, zipfile io.ReadSeeker, size int64) (results ForceCheckDeploymentStatusResult, err error) {
+	body, err := fm.soapExecuteZip("deploy", soap, zipfile, size)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
@@ -1291,62 +1451,60 @@ func (fm *ForceMetadata) DeployRecentValidation(validationId string) (results Fo
 	}
 }
 
+// Retrieve the members listed in a package.xml file, with the wildcards
+// expanded for the members they don't cover.
 func (fm *ForceMetadata) RetrieveByPackageXml(package_xml string) (files ForceMetadataFiles, problems []string, err error) {
-	// Need to crack open the xml file and pull out the <types> array
 	data, err := ioutil.ReadFile(package_xml)
-
 	if err != nil {
 		ErrorAndExit(err.Error())
 	}
-	soap := `
-		<retrieveRequest>
-			<apiVersion>%s</apiVersion>
-			<unpackaged>
-				%s
-			</unpackaged>
-		</retrieveRequest>
-	`
-
-	type types struct {
-		Name    string   `xml:"name"`
-		Members []string `xml:"members"`
+	var pkg Package
+	if err = xml.Unmarshal(data, &pkg); err != nil {
+		return
 	}
-
-	var pxml struct {
-		Results []types `xml:"types"`
+	var query ForceMetadataQuery
+	for _, t := range pkg.Types {
+		query = append(query, ForceMetadataQueryElement{Name: []string{t.Name}, Members: t.Members})
 	}
-
-	xml.Unmarshal(data, &pxml)
-
-	xml_types := ""
-	for _, p_xml := range pxml.Results {
-		xml, err := xml.MarshalIndent(p_xml, " ", "    ")
-		if err != nil {
-			ErrorAndExit(err.Error())
+	if fm.Force != nil {
+		if query, err = fm.Force.ExpandWildcards(query); err != nil {
+			return
 		}
-		xml_types += fmt.Sprintf("%s\n", xml)
 	}
+	return fm.Retrieve(query)
+}
 
-	body, err := fm.soapExecute("retrieve", fmt.Sprintf(soap, apiVersionNumber, xml_types))
-	if err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
-		return
-	}
-	var status struct {
-		Id string `xml:"Body>retrieveResponse>result>id"`
+// Retrieve the members in the query. Large queries are split into chunks
+// that are retrieved concurrently; see RetrieveChunkSize.
+func (fm *ForceMetadata) Retrieve(query ForceMetadataQuery) (files ForceMetadataFiles, problems []string, err error) {
+	chunks := ChunkQuery(query, fm.retrieveChunkSize())
+	if len(chunks) > 1 {
+		return fm.retrieveChunks(chunks)
 	}
-	if err = xml.Unmarshal(body, &status); err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
-		return
+	files, problems, fm.RetrievedFileProperties, err = fm.retrieveQuery(query)
+	return
+}
+
+// Retrieve the members in the query into dir, writing each file as it's
+// unzipped rather than holding the retrieved files in memory. Files whose
+// path skip returns true for aren't written.
+func (fm *ForceMetadata) RetrieveToDir(query ForceMetadataQuery, dir string, skip func(path string) bool) (problems []string, err error) {
+	sink := newDirSink(dir, skip)
+	chunks := ChunkQuery(query, fm.retrieveChunkSize())
+	if len(chunks) > 1 {
+		return fm.retrieveChunksTo(chunks, sink)
 	}
+	problems, fm.RetrievedFileProperties, err = fm.retrieveQueryTo(query, sink)
+	return
+}
 
-	if err = fm.CheckStatus(status.Id); err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
+func (fm *ForceMetadata) retrieveQuery(query ForceMetadataQuery) (files ForceMetadataFiles, problems []string, properties []MDFileProperties, err error) {
+	id, err := fm.startRetrieve(query)
+	if err != nil {
 		return
 	}
-	raw_files, problems, err := fm.CheckRetrieveStatus(status.Id)
+	raw_files, problems, properties, err := fm.checkRetrieveStatus(id)
 	if err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
 		return
 	}
 	files = make(ForceMetadataFiles)
@@ -1354,12 +1512,24 @@ func (fm *ForceMetadata) RetrieveByPackageXml(package_xml string) (files ForceMe
 		name := strings.Replace(raw_name, "unpackaged/", "", -1)
 		files[name] = data
 	}
-
 	return
 }
 
-func (fm *ForceMetadata) Retrieve(query ForceMetadataQuery) (files ForceMetadataFiles, problems []string, err error) {
+// Retrieve the members in the query, passing each file to the sink as it's
+// unzipped.
+func (fm *ForceMetadata) retrieveQueryTo(query ForceMetadataQuery, sink retrieveSink) (problems []string, properties []MDFileProperties, err error) {
+	id, err := fm.startRetrieve(query)
+	if err != nil {
+		return
+	}
+	return fm.extractRetrieveStatus(id, func(name string, r io.Reader) error {
+		return sink.add(strings.Replace(name, "unpackaged/", "", -1), r)
+	})
+}
 
+// Start retrieving the members in the query and wait for it to finish,
+// returning the retrieve's id.
+func (fm *ForceMetadata) startRetrieve(query ForceMetadataQuery) (id string, err error) {
 	soap := `
 		<retrieveRequest>
 			<apiVersion>%s</apiVersion>
@@ -1399,15 +1569,7 @@ func (fm *ForceMetadata) Retrieve(query ForceMetadataQuery) (files ForceMetadata
 	if err = fm.CheckStatus(status.Id); err != nil {
 		return
 	}
-	raw_files, problems, err := fm.CheckRetrieveStatus(status.Id)
-	if err != nil {
-		return
-	}
-	files = make(ForceMetadataFiles)
-	for raw_name, data := range raw_files {
-		name := strings.Replace(raw_name, "unpackaged/", "", -1)
-		files[name] = data
-	}
+	id = status.Id
 	return
 }
 
@@ -1477,12 +1639,76 @@ func (fm *ForceMetadata) ListConnectedApps() (apps ForceConnectedApps, err error
 }
 
 func (fm *ForceMetadata) soapExecute(action, query string) (response []byte, err error) {
-	url := fmt.Sprintf("%s/services/Soap/m/%s", fm.Force.Credentials.InstanceUrl, fm.ApiVersion)
-	soap := NewSoap(url, "http://soap.sforce.com/2006/04/metadata", fm.Force.Credentials.AccessToken)
+	soap := fm.soap()
 	response, err = soap.Execute(action, query)
 	if err == SessionExpiredError {
-		fm.Force.RefreshSessionOrExit()
+		fm.refreshSession(soap)
 		return fm.soapExecute(action, query)
 	}
 	return
 }
+
+func (fm *ForceMetadata) soap() *Soap {
+	fm.sessionMutex.RLock()
+	defer fm.sessionMutex.RUnlock()
+	url := fmt.Sprintf("%s/services/Soap/m/%s", fm.Force.Credentials.InstanceUrl, fm.ApiVersion)
+	return NewSoap(url, "http://soap.sforce.com/2006/04/metadata", fm.Force.Credentials.AccessToken)
+}
+
+// Refresh the session after a request made with expired failed. When
+// concurrent requests fail together, only the first one refreshes it.
+func (fm *ForceMetadata) refreshSession(expired *Soap) {
+	fm.sessionMutex.Lock()
+	defer fm.sessionMutex.Unlock()
+	if fm.Force.Credentials.AccessToken == expired.AccessToken {
+		fm.Force.RefreshSessionOrExit()
+	}
+}
+
+// Execute the action, decoding the zipFile of the response into zipFile.
+func (fm *ForceMetadata) soapExecuteToFile(action, query string, zipFile io.Writer) (response []byte, err error) {
+	soap := fm.soap()
+	response, err = soap.ExecuteStream(action, strings.NewReader(query), int64(len(query)), zipFile)
+	if err == SessionExpiredError {
+		fm.refreshSession(soap)
+		return fm.soapExecuteToFile(action, query, zipFile)
+	}
+	return
+}
+
+// Execute the action with the zip streamed into the request, base64
+// encoded, in place of the %s in query.
+func (fm *ForceMetadata) soapExecuteZip(action, query string, zipfile io.ReadSeeker, size int64) (response []byte, err error) {
+	parts := strings.SplitN(query, "%s", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("no place for the zip file in the request")
+	}
+	if _, err = zipfile.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	encoded := base64Reader(zipfile)
+	defer encoded.Close()
+	body := io.MultiReader(strings.NewReader(parts[0]), encoded, strings.NewReader(parts[1]))
+	bodySize := int64(len(parts[0])+len(parts[1])) + int64(base64.StdEncoding.EncodedLen(int(size)))
+	soap := fm.soap()
+	response, err = soap.ExecuteStream(action, body, bodySize, nil)
+	if err == SessionExpiredError {
+		fm.refreshSession(soap)
+		return fm.soapExecuteZip(action, query, zipfile, size)
+	}
+	return
+}
+
+// Returns a reader of r encoded as base64, encoded as it's read.
+func base64Reader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		encoder := base64.NewEncoder(base64.StdEncoding, pw)
+		_, err := io.Copy(encoder, r)
+		if err == nil {
+			err = encoder.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
@@ -0,0 +1,46 @@
+package lib_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metadata", func() {
+	Describe("MakeZipFileFromPaths", func() {
+		It("should zip the files at the paths and the files", func() {
+			tempDir, _ := ioutil.TempDir("", "force-zip")
+			defer os.RemoveAll(tempDir)
+			classPath := filepath.Join(tempDir, "Book.cls")
+			Expect(ioutil.WriteFile(classPath, []byte("public class Book {}"), 0644)).To(Succeed())
+
+			fm := ForceMetadata{}
+			name, err := fm.MakeZipFileFromPaths(
+				map[string]string{"classes/Book.cls": classPath},
+				ForceMetadataFiles{"package.xml": []byte("<Package/>")})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(name)
+
+			zipped, err := zip.OpenReader(name)
+			Expect(err).ToNot(HaveOccurred())
+			defer zipped.Close()
+			contents := make(map[string]string)
+			for _, file := range zipped.File {
+				r, _ := file.Open()
+				data, _ := ioutil.ReadAll(r)
+				r.Close()
+				contents[file.Name] = string(data)
+			}
+			Expect(contents).To(Equal(map[string]string{
+				"unpackaged/classes/Book.cls": "public class Book {}",
+				"unpackaged/package.xml":      "<Package/>",
+			}))
+		})
+	})
+})
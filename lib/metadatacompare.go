@@ -0,0 +1,298 @@
+package lib
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type MetadataMember struct {
+	Type string
+	Name string
+}
+
+// The differences between two retrievals of the same package, by member.
+// Added members are only in the source, and removed members only in the
+// target, including the children of modified objects, such as fields, that
+// only the target has. Standard objects and fields are never removed.
+type MetadataComparison struct {
+	Added    []MetadataMember
+	Removed  []MetadataMember
+	Modified []MetadataMember
+	// Files of each member in the source and target
+	memberFiles map[MetadataMember][]string
+	// Objects whose children are compared as members of their own
+	partialObjects map[string]bool
+}
+
+func (c MetadataComparison) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Modified) == 0
+}
+
+// Compare the files retrieved from the target org with those retrieved from
+// the source org, grouping the differences by the members of the retrieved
+// package.xml. When the package lists children of an object, such as
+// CustomField Book__c.Title__c, rather than the CustomObject, they are
+// compared individually.
+func CompareMetadataMembers(target, source ForceMetadataFiles) (comparison MetadataComparison) {
+	var pkg Package
+	xml.Unmarshal(source["package.xml"], &pkg)
+	var query ForceMetadataQuery
+	for _, t := range pkg.Types {
+		query = append(query, ForceMetadataQueryElement{Name: []string{t.Name}, Members: t.Members})
+	}
+	return compareMetadataMembers(target, source, query)
+}
+
+// Compare the files at the granularity of the members of the query.
+func compareMetadataMembers(target, source ForceMetadataFiles, query ForceMetadataQuery) (comparison MetadataComparison) {
+	comparison.partialObjects = queryPartialObjects(query)
+	target = splitPartialObjects(target, comparison.partialObjects)
+	source = splitPartialObjects(source, comparison.partialObjects)
+	comparison.memberFiles = make(map[MetadataMember][]string)
+	inSource := make(map[MetadataMember]bool)
+	inTarget := make(map[MetadataMember]bool)
+	addFiles := func(files ForceMetadataFiles, present map[MetadataMember]bool) {
+		for name := range files {
+			if name == "package.xml" {
+				continue
+			}
+			member := memberForFile(name)
+			present[member] = true
+			if !containsFile(comparison.memberFiles[member], name) {
+				comparison.memberFiles[member] = append(comparison.memberFiles[member], name)
+			}
+		}
+	}
+	addFiles(source, inSource)
+	addFiles(target, inTarget)
+
+	diff := CompareMetadataFiles(target, source)
+	changed := make(map[MetadataMember]bool)
+	for _, names := range [][]string{diff.Added, diff.Removed, diff.Modified} {
+		for _, name := range names {
+			changed[memberForFile(name)] = true
+		}
+	}
+	for member := range changed {
+		switch {
+		case !inTarget[member]:
+			comparison.Added = append(comparison.Added, member)
+		case !inSource[member]:
+			if !isStandardMember(member) {
+				comparison.Removed = append(comparison.Removed, member)
+			}
+		default:
+			comparison.Modified = append(comparison.Modified, member)
+			if member.Type == "CustomObject" {
+				name := "objects/" + member.Name + ".object"
+				comparison.Removed = append(comparison.Removed, removedObjectChildren(member.Name, target[name], source[name])...)
+			}
+		}
+	}
+	sortMembers(comparison.Added)
+	sortMembers(comparison.Removed)
+	sortMembers(comparison.Modified)
+	return
+}
+
+// Returns the children of the object, such as CustomFields, in its target
+// file that aren't in its source file, except standard fields.
+func removedObjectChildren(object string, target, source []byte) (removed []MetadataMember) {
+	children := func(data []byte) (members map[MetadataMember]bool, err error) {
+		files, err := DecomposeObjectFiles(ForceMetadataFiles{"objects/" + object + ".object": data})
+		if err != nil {
+			return
+		}
+		members = make(map[MetadataMember]bool)
+		for name := range files {
+			if _, metaName, member, _ := decomposedObjectMember(name); metaName != "CustomObject" {
+				members[MetadataMember{Type: metaName, Name: member}] = true
+			}
+		}
+		return
+	}
+	targetChildren, err := children(target)
+	if err != nil {
+		return
+	}
+	sourceChildren, err := children(source)
+	if err != nil {
+		return
+	}
+	for member := range targetChildren {
+		if !sourceChildren[member] && !isStandardMember(member) {
+			removed = append(removed, member)
+		}
+	}
+	return
+}
+
+// Whether the member is a standard object or field, which can't be deleted.
+func isStandardMember(member MetadataMember) bool {
+	switch member.Type {
+	case "CustomObject":
+		return !strings.Contains(member.Name, "__")
+	case "CustomField":
+		parts := strings.SplitN(member.Name, ".", 2)
+		return len(parts) == 2 && !strings.Contains(parts[1], "__")
+	}
+	return false
+}
+
+func memberForFile(name string) MetadataMember {
+	typeName, member := MetadataMemberForFile(name)
+	return MetadataMember{Type: typeName, Name: member}
+}
+
+// Returns the objects whose children, e.g. CustomFields, the query lists
+// without listing the CustomObject itself.
+func queryPartialObjects(query ForceMetadataQuery) (objects map[string]bool) {
+	objects = make(map[string]bool)
+	whole := make(map[string]bool)
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			if typeName == "CustomObject" {
+				for _, member := range element.Members {
+					whole[member] = true
+				}
+				continue
+			}
+			if _, isChild := findObjectChildTypeByName(typeName); !isChild {
+				continue
+			}
+			for _, member := range element.Members {
+				if parts := strings.SplitN(member, ".", 2); len(parts) == 2 {
+					objects[parts[0]] = true
+				}
+			}
+		}
+	}
+	if whole["*"] {
+		return make(map[string]bool)
+	}
+	for object := range whole {
+		delete(objects, object)
+	}
+	return
+}
+
+// Split the files of the objects into a file per child, as in the
+// decomposed layout, so that each child is a member of its own.
+func splitPartialObjects(files ForceMetadataFiles, objects map[string]bool) (split ForceMetadataFiles) {
+	if len(objects) == 0 {
+		return files
+	}
+	split = make(ForceMetadataFiles)
+	for name, data := range files {
+		object := strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(name), "objects/"), ".object")
+		if !objects[object] || filepath.ToSlash(name) != "objects/"+object+".object" {
+			split[name] = data
+			continue
+		}
+		children, err := DecomposeObjectFiles(ForceMetadataFiles{"objects/" + object + ".object": data})
+		if err != nil {
+			split[name] = data
+			continue
+		}
+		for childName, childData := range children {
+			// Only the children are in the package
+			if _, metaName, _, _ := decomposedObjectMember(childName); metaName != "CustomObject" {
+				split[childName] = childData
+			}
+		}
+	}
+	return
+}
+
+// Returns only the differences in the members of the query, and in the
+// children of the objects in it.
+func (c MetadataComparison) only(query ForceMetadataQuery) MetadataComparison {
+	inQuery := func(member MetadataMember) bool {
+		object := ""
+		if _, isChild := findObjectChildTypeByName(member.Type); isChild {
+			object = strings.SplitN(member.Name, ".", 2)[0]
+		}
+		for _, element := range query {
+			for _, typeName := range element.Name {
+				name := member.Name
+				if object != "" && typeName == "CustomObject" {
+					name = object
+				} else if typeName != member.Type {
+					continue
+				}
+				for _, m := range element.Members {
+					if m == "*" || m == name {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+	filter := func(members []MetadataMember) (filtered []MetadataMember) {
+		for _, member := range members {
+			if inQuery(member) {
+				filtered = append(filtered, member)
+			}
+		}
+		return
+	}
+	c.Added = filter(c.Added)
+	c.Removed = filter(c.Removed)
+	c.Modified = filter(c.Modified)
+	return c
+}
+
+func containsFile(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortMembers(members []MetadataMember) {
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Type != members[j].Type {
+			return members[i].Type < members[j].Type
+		}
+		return members[i].Name < members[j].Name
+	})
+}
+
+// Returns a package that would bring the target in line with the source:
+// the source files of the added and modified members with a package.xml
+// listing them, and a destructiveChanges.xml listing the removed members.
+// The children of objects compared individually are combined into object
+// files holding only the changed children.
+func (c MetadataComparison) DeployFiles(source ForceMetadataFiles) (files ForceMetadataFiles) {
+	source = splitPartialObjects(source, c.partialObjects)
+	files = make(ForceMetadataFiles)
+	pb := NewFetchBuilder()
+	for _, members := range [][]MetadataMember{c.Added, c.Modified} {
+		for _, member := range members {
+			pb.AddMetaToPackage(member.Type, member.Name)
+			for _, name := range c.memberFiles[member] {
+				if data, found := source[name]; found {
+					files[filepath.FromSlash(name)] = data
+				}
+			}
+		}
+	}
+	if len(c.partialObjects) > 0 {
+		// The children were split from files that parsed
+		files, _ = RecomposeObjectFiles(files)
+	}
+	files["package.xml"] = pb.PackageXml()
+	if len(c.Removed) > 0 {
+		destructive := NewFetchBuilder()
+		for _, member := range c.Removed {
+			destructive.AddMetaToPackage(member.Type, member.Name)
+		}
+		files["destructiveChanges.xml"] = destructive.DestructiveChangesXml()
+	}
+	return
+}
@@ -0,0 +1,187 @@
+package lib_test
+
+import (
+	"encoding/xml"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetadataComparison", func() {
+	var (
+		source ForceMetadataFiles
+		target ForceMetadataFiles
+	)
+
+	BeforeEach(func() {
+		source = ForceMetadataFiles{
+			"package.xml":                  []byte("<Package/>"),
+			"classes/Same.cls":             []byte("public class Same {}"),
+			"classes/New.cls":              []byte("public class New {}"),
+			"classes/New.cls-meta.xml":     []byte("<ApexClass/>"),
+			"classes/Changed.cls":          []byte("public class Changed { }"),
+			"classes/Changed.cls-meta.xml": []byte("<ApexClass/>"),
+			"lwc/cmp/cmp.js":               []byte("export default class Cmp {}"),
+			"lwc/cmp/cmp.html":             []byte("<template></template>"),
+		}
+		target = ForceMetadataFiles{
+			"package.xml":                  []byte("<Package/>"),
+			"classes/Same.cls":             []byte("public class Same {}"),
+			"classes/Changed.cls":          []byte("public class Changed {}"),
+			"classes/Changed.cls-meta.xml": []byte("<ApexClass/>"),
+			"classes/Old.cls":              []byte("public class Old {}"),
+			"lwc/cmp/cmp.js":               []byte("export default class Cmp {}"),
+		}
+	})
+
+	It("should group differences by member", func() {
+		comparison := CompareMetadataMembers(target, source)
+		Expect(comparison.Added).To(Equal([]MetadataMember{{Type: "ApexClass", Name: "New"}}))
+		Expect(comparison.Removed).To(Equal([]MetadataMember{{Type: "ApexClass", Name: "Old"}}))
+		Expect(comparison.Modified).To(Equal([]MetadataMember{
+			{Type: "ApexClass", Name: "Changed"},
+			{Type: "LightningComponentBundle", Name: "cmp"},
+		}))
+	})
+
+	It("should build a package bringing the target in line with the source", func() {
+		files := CompareMetadataMembers(target, source).DeployFiles(source)
+		Expect(files).To(HaveKey("classes/New.cls"))
+		Expect(files).To(HaveKey("classes/New.cls-meta.xml"))
+		Expect(files).To(HaveKey("classes/Changed.cls"))
+		Expect(files).To(HaveKey("classes/Changed.cls-meta.xml"))
+		Expect(files).To(HaveKey("lwc/cmp/cmp.js"))
+		Expect(files).To(HaveKey("lwc/cmp/cmp.html"))
+		Expect(files).ToNot(HaveKey("classes/Same.cls"))
+
+		var destructive Package
+		Expect(xml.Unmarshal(files["destructiveChanges.xml"], &destructive)).To(Succeed())
+		Expect(destructive.Version).To(BeEmpty())
+		Expect(destructive.Types).To(Equal([]MetaType{{Name: "ApexClass", Members: []string{"Old"}}}))
+	})
+
+	It("should compare the fields listed in the package individually", func() {
+		packageXml := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Package xmlns="http://soap.sforce.com/2006/04/metadata">
+    <types>
+        <members>Book__c.Title__c</members>
+        <members>Book__c.New__c</members>
+        <members>Book__c.Old__c</members>
+        <name>CustomField</name>
+    </types>
+    <version>50.0</version>
+</Package>
+`)
+		source := ForceMetadataFiles{
+			"package.xml": packageXml,
+			"objects/Book__c.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>New__c</fullName>
+        <type>Text</type>
+    </fields>
+    <fields>
+        <fullName>Title__c</fullName>
+        <type>Text</type>
+    </fields>
+</CustomObject>
+`),
+		}
+		target := ForceMetadataFiles{
+			"package.xml": packageXml,
+			"objects/Book__c.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>Old__c</fullName>
+        <type>Text</type>
+    </fields>
+    <fields>
+        <fullName>Title__c</fullName>
+        <type>Text</type>
+    </fields>
+</CustomObject>
+`),
+		}
+		comparison := CompareMetadataMembers(target, source)
+		Expect(comparison.Added).To(Equal([]MetadataMember{{Type: "CustomField", Name: "Book__c.New__c"}}))
+		Expect(comparison.Removed).To(Equal([]MetadataMember{{Type: "CustomField", Name: "Book__c.Old__c"}}))
+		Expect(comparison.Modified).To(BeEmpty())
+
+		files := comparison.DeployFiles(source)
+		Expect(string(files["objects/Book__c.object"])).To(ContainSubstring("New__c"))
+		Expect(string(files["objects/Book__c.object"])).ToNot(ContainSubstring("Title__c"))
+		var pkg, destructive Package
+		Expect(xml.Unmarshal(files["package.xml"], &pkg)).To(Succeed())
+		Expect(pkg.Types).To(Equal([]MetaType{{Name: "CustomField", Members: []string{"Book__c.New__c"}}}))
+		Expect(xml.Unmarshal(files["destructiveChanges.xml"], &destructive)).To(Succeed())
+		Expect(destructive.Types).To(Equal([]MetaType{{Name: "CustomField", Members: []string{"Book__c.Old__c"}}}))
+	})
+
+	It("should delete the children of modified objects that only the target has", func() {
+		packageXml := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Package xmlns="http://soap.sforce.com/2006/04/metadata">
+    <types>
+        <members>*</members>
+        <name>CustomObject</name>
+    </types>
+    <version>50.0</version>
+</Package>
+`)
+		source := ForceMetadataFiles{
+			"package.xml": packageXml,
+			"objects/Book__c.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>Title__c</fullName>
+        <type>Text</type>
+    </fields>
+    <label>Book</label>
+</CustomObject>
+`),
+		}
+		target := ForceMetadataFiles{
+			"package.xml": packageXml,
+			"objects/Account.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <enableHistory>false</enableHistory>
+</CustomObject>
+`),
+			"objects/Book__c.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>Name</fullName>
+        <type>Text</type>
+    </fields>
+    <fields>
+        <fullName>Old__c</fullName>
+        <type>Text</type>
+    </fields>
+    <fields>
+        <fullName>Title__c</fullName>
+        <type>Text</type>
+    </fields>
+    <label>Book</label>
+    <listViews>
+        <fullName>All</fullName>
+    </listViews>
+</CustomObject>
+`),
+		}
+		comparison := CompareMetadataMembers(target, source)
+		Expect(comparison.Modified).To(Equal([]MetadataMember{{Type: "CustomObject", Name: "Book__c"}}))
+		Expect(comparison.Removed).To(Equal([]MetadataMember{
+			{Type: "CustomField", Name: "Book__c.Old__c"},
+			{Type: "ListView", Name: "Book__c.All"},
+		}))
+
+		files := comparison.DeployFiles(source)
+		var destructive Package
+		Expect(xml.Unmarshal(files["destructiveChanges.xml"], &destructive)).To(Succeed())
+		Expect(destructive.Types).To(Equal([]MetaType{
+			{Name: "CustomField", Members: []string{"Book__c.Old__c"}},
+			{Name: "ListView", Members: []string{"Book__c.All"}},
+		}))
+	})
+})
@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The differences between two sets of metadata files, by file name. Added
+// files are only in the new set, and removed files only in the original.
+type MetadataDiff struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+func (d MetadataDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Compare the original files, e.g. those retrieved from an org, with the new
+// files. XML files are compared after normalization, and other text files
+// ignoring line endings. The package.xml is not compared.
+func CompareMetadataFiles(original, updated ForceMetadataFiles) (diff MetadataDiff) {
+	for name, data := range updated {
+		if name == "package.xml" {
+			continue
+		}
+		if originalData, found := original[name]; !found {
+			diff.Added = append(diff.Added, name)
+		} else if !bytes.Equal(NormalizeMetadataFile(name, originalData), NormalizeMetadataFile(name, data)) {
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for name := range original {
+		if _, found := updated[name]; !found && name != "package.xml" {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+	return
+}
+
+// Returns whether the file's contents should be compared as bytes rather
+// than lines.
+func IsBinaryMetadata(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+func isXmlMetadata(name string, data []byte) bool {
+	return strings.HasSuffix(name, ".xml") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("<?xml"))
+}
+
+// Returns the file's contents in a canonical form for comparison. Files
+// that can't be parsed as XML are compared as text.
+func NormalizeMetadataFile(name string, data []byte) []byte {
+	if IsBinaryMetadata(data) {
+		return data
+	}
+	if isXmlMetadata(name, data) {
+		if normalized, err := NormalizeXml(data); err == nil {
+			return normalized
+		}
+	}
+	return bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+}
+
+// Returns a unified diff of the named file in the original and updated
+// files, with names prefixed by fromPrefix and toPrefix.
+func MetadataFileDiff(name string, original, updated ForceMetadataFiles, fromPrefix, toPrefix string) string {
+	originalData, inOriginal := original[name]
+	updatedData, inUpdated := updated[name]
+	fromName, toName := fromPrefix+name, toPrefix+name
+	if !inOriginal {
+		fromName = "/dev/null"
+	}
+	if !inUpdated {
+		toName = "/dev/null"
+	}
+	if IsBinaryMetadata(originalData) || IsBinaryMetadata(updatedData) {
+		return "Binary files " + fromName + " and " + toName + " differ\n"
+	}
+	var from, to string
+	if inOriginal {
+		from = string(NormalizeMetadataFile(name, originalData))
+	}
+	if inUpdated {
+		to = string(NormalizeMetadataFile(name, updatedData))
+	}
+	return UnifiedDiff(fromName, toName, from, to, 3)
+}
@@ -0,0 +1,79 @@
+package lib_test
+
+import (
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetadataDiff", func() {
+	Describe("NormalizeXml", func() {
+		It("should normalize whitespace, group elements by name and sort keyed elements", func() {
+			normalized, err := NormalizeXml([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata"><label>Book</label>
+  <fields><fullName>B__c</fullName></fields>
+	<deploymentStatus>Deployed</deploymentStatus>
+  <fields><fullName>A__c</fullName><description>Tom &amp; Jerry</description></fields>
+  <enableHistory/>
+</CustomObject>`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(normalized)).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <deploymentStatus>Deployed</deploymentStatus>
+    <enableHistory/>
+    <fields>
+        <description>Tom &amp; Jerry</description>
+        <fullName>A__c</fullName>
+    </fields>
+    <fields>
+        <fullName>B__c</fullName>
+    </fields>
+    <label>Book</label>
+</CustomObject>
+`))
+		})
+
+		It("should not report reordered permissions as modified", func() {
+			org := ForceMetadataFiles{
+				"profiles/Admin.profile": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Profile>
+    <fieldPermissions><field>Book__c.A__c</field><readable>true</readable></fieldPermissions>
+    <objectPermissions><object>Book__c</object></objectPermissions>
+    <fieldPermissions><field>Book__c.B__c</field><readable>true</readable></fieldPermissions>
+</Profile>`),
+			}
+			local := ForceMetadataFiles{
+				"profiles/Admin.profile": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Profile>
+    <fieldPermissions><field>Book__c.B__c</field><readable>true</readable></fieldPermissions>
+    <fieldPermissions><field>Book__c.A__c</field><readable>true</readable></fieldPermissions>
+    <objectPermissions><object>Book__c</object></objectPermissions>
+</Profile>`),
+			}
+			Expect(CompareMetadataFiles(org, local).Modified).To(BeEmpty())
+		})
+	})
+
+	Describe("CompareMetadataFiles", func() {
+		It("should classify added, removed and modified files", func() {
+			org := ForceMetadataFiles{
+				"package.xml":               []byte("<Package/>"),
+				"classes/Same.cls":          []byte("public class Same {}\r\n"),
+				"classes/Changed.cls":       []byte("public class Changed {}"),
+				"classes/Removed.cls":       []byte("public class Removed {}"),
+				"classes/Same.cls-meta.xml": []byte("<ApexClass><status>Active</status><apiVersion>40.0</apiVersion></ApexClass>"),
+			}
+			local := ForceMetadataFiles{
+				"classes/Same.cls":          []byte("public class Same {}\n"),
+				"classes/Changed.cls":       []byte("public class Changed { }"),
+				"classes/Added.cls":         []byte("public class Added {}"),
+				"classes/Same.cls-meta.xml": []byte("<ApexClass>\n  <apiVersion>40.0</apiVersion>\n  <status>Active</status>\n</ApexClass>\n"),
+			}
+			diff := CompareMetadataFiles(org, local)
+			Expect(diff.Added).To(Equal([]string{"classes/Added.cls"}))
+			Expect(diff.Removed).To(Equal([]string{"classes/Removed.cls"}))
+			Expect(diff.Modified).To(Equal([]string{"classes/Changed.cls"}))
+		})
+	})
+})
@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	. "github.com/ForceCLI/force/config"
+)
+
+// A metadata type and its layout in a source directory, as reported by
+// describeMetadata.
+type MetadataType struct {
+	Name          string   `json:"xmlName"`
+	DirectoryName string   `json:"directoryName"`
+	Suffix        string   `json:"suffix,omitempty"`
+	InFolder      bool     `json:"inFolder,omitempty"`
+	MetaFile      bool     `json:"metaFile,omitempty"`
+	ChildXmlNames []string `json:"childXmlNames,omitempty"`
+}
+
+// Types whose members are folders deployed as a whole.
+var bundleTypes = map[string]bool{
+	"AuraDefinitionBundle":     true,
+	"LightningComponentBundle": true,
+}
+
+// The metadata types of the active API version. Until they're loaded, the
+// static metapaths are used to map paths to types. They're read by
+// concurrent retrieves, so they're only used through loadedMetadataTypes
+// and SetMetadataTypes.
+var (
+	metadataTypes      []MetadataType
+	metadataTypesMutex sync.RWMutex
+)
+
+func loadedMetadataTypes() []MetadataType {
+	metadataTypesMutex.RLock()
+	defer metadataTypesMutex.RUnlock()
+	return metadataTypes
+}
+
+func (t MetadataType) IsBundle() bool {
+	return bundleTypes[t.Name]
+}
+
+func (t MetadataType) metapath() (mp metapath) {
+	mp = metapath{path: t.DirectoryName, name: t.Name, hasFolder: t.InFolder}
+	if t.Suffix != "" {
+		mp.extension = "." + t.Suffix
+	}
+	if t.IsBundle() {
+		mp.hasFolder = true
+		mp.onlyFolder = true
+	}
+	return
+}
+
+// Returns the path-to-type mappings from the loaded metadata types, falling
+// back to the static list when working offline.
+func knownMetapaths() []metapath {
+	types := loadedMetadataTypes()
+	if len(types) == 0 {
+		return metapaths
+	}
+	var mps []metapath
+	for _, t := range types {
+		if t.DirectoryName != "" {
+			mps = append(mps, t.metapath())
+		}
+	}
+	return mps
+}
+
+func NewMetadataTypes(describe MetadataDescribeResult) (types []MetadataType) {
+	for _, o := range describe.MetadataObjects {
+		types = append(types, MetadataType{
+			Name:          o.XmlName,
+			DirectoryName: o.DirectoryName,
+			Suffix:        o.Suffix,
+			InFolder:      o.InFolder,
+			MetaFile:      o.MetaFile,
+			ChildXmlNames: o.ChildXmlNames,
+		})
+	}
+	return
+}
+
+// Use types to map paths to metadata types.
+func SetMetadataTypes(types []MetadataType) {
+	metadataTypesMutex.Lock()
+	defer metadataTypesMutex.Unlock()
+	metadataTypes = types
+}
+
+// Returns the metadata types of the org for the current API version, from
+// the cache if available, otherwise from describeMetadata. The types are
+// also used from then on to map paths to metadata types.
+func (f *Force) MetadataTypes() (types []MetadataType, err error) {
+	if types = loadedMetadataTypes(); len(types) > 0 {
+		return
+	}
+	if orgId := f.OrgId(); orgId != "" {
+		if cached, loadErr := Config.Load("metadataTypes", metadataTypesCacheKey(orgId)); loadErr == nil {
+			if json.Unmarshal([]byte(cached), &types) == nil && len(types) > 0 {
+				SetMetadataTypes(types)
+				return
+			}
+		}
+	}
+	describe, err := f.Metadata.DescribeMetadata()
+	if err != nil {
+		return
+	}
+	if err = CacheMetadataTypes(f.OrgId(), describe); err != nil {
+		return
+	}
+	types = loadedMetadataTypes()
+	return
+}
+
+// Orgs have different types depending on their features, so the types are
+// cached by org and API version.
+func metadataTypesCacheKey(orgId string) string {
+	return orgId + "-" + apiVersionNumber
+}
+
+// Use the metadata types from describe and save them to the cache for the
+// org and the current API version, if the org is known.
+func CacheMetadataTypes(orgId string, describe MetadataDescribeResult) (err error) {
+	types := NewMetadataTypes(describe)
+	if len(types) == 0 {
+		return fmt.Errorf("No metadata types found")
+	}
+	SetMetadataTypes(types)
+	if orgId == "" {
+		return
+	}
+	body, err := json.Marshal(types)
+	if err != nil {
+		return
+	}
+	return Config.Save("metadataTypes", metadataTypesCacheKey(orgId), string(body))
+}
+
+// Load the metadata types, falling back to the static list of types if they
+// can't be retrieved.
+func (f *Force) LoadMetadataTypes() {
+	if _, err := f.MetadataTypes(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not get metadata types (%s); using built-in list\n", err.Error())
+	}
+}
+
+func FindMetadataType(types []MetadataType, name string) (t MetadataType, found bool) {
+	for _, t = range types {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return MetadataType{}, false
+}
+
+// Returns the type stored in the named directory, e.g. ApexClass for classes.
+func FindMetadataTypeByDirectory(types []MetadataType, directory string) (t MetadataType, found bool) {
+	for _, t = range types {
+		if t.DirectoryName == directory {
+			return t, true
+		}
+	}
+	return MetadataType{}, false
+}
@@ -0,0 +1,80 @@
+package lib_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetadataTypes", func() {
+	var (
+		pb      PackageBuilder
+		tempDir string
+	)
+
+	BeforeEach(func() {
+		pb = NewPushBuilder()
+		tempDir, _ = ioutil.TempDir("", "metadatatypes-test")
+		SetMetadataTypes(NewMetadataTypes(MetadataDescribeResult{
+			MetadataObjects: []DescribeMetadataObject{
+				{XmlName: "ApexClass", DirectoryName: "classes", Suffix: "cls", MetaFile: true},
+				{XmlName: "Report", DirectoryName: "reports", Suffix: "report", InFolder: true},
+				{XmlName: "NewType", DirectoryName: "newTypes", Suffix: "newType"},
+			},
+		}))
+	})
+
+	AfterEach(func() {
+		SetMetadataTypes(nil)
+		os.RemoveAll(tempDir)
+	})
+
+	It("should map directories to types not in the static list", func() {
+		os.MkdirAll(tempDir+"/src/newTypes", 0755)
+		ioutil.WriteFile(tempDir+"/src/newTypes/Foo.newType", []byte("<NewType/>"), 0644)
+		_, err := pb.AddFile(tempDir + "/src/newTypes/Foo.newType")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pb.Metadata).To(HaveKey("NewType"))
+		Expect(pb.Files).To(HaveKey("newTypes/Foo.newType"))
+	})
+
+	It("should map foldered types", func() {
+		os.MkdirAll(tempDir+"/src/reports/MyFolder", 0755)
+		ioutil.WriteFile(tempDir+"/src/reports/MyFolder/MyReport.report", []byte("<Report/>"), 0644)
+		pb.AddFile(tempDir + "/src/reports/MyFolder/MyReport.report")
+		Expect(pb.Metadata["Report"].Members).To(Equal([]string{"MyFolder/MyReport"}))
+		Expect(pb.Files).To(HaveKey("reports/MyFolder/MyReport.report"))
+	})
+
+	It("should allow the types to be replaced while chunking retrieves", func() {
+		types := NewMetadataTypes(MetadataDescribeResult{
+			MetadataObjects: []DescribeMetadataObject{{XmlName: "ApexClass", DirectoryName: "classes", Suffix: "cls", MetaFile: true}},
+		})
+		query := ForceMetadataQuery{{Name: []string{"ApexClass"}, Members: []string{"A", "B", "C"}}}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				SetMetadataTypes(types)
+				ChunkQuery(query, 2)
+			}()
+		}
+		wg.Wait()
+		Expect(ChunkQuery(query, 2)).To(HaveLen(3))
+	})
+
+	It("should find types by directory", func() {
+		types := NewMetadataTypes(MetadataDescribeResult{
+			MetadataObjects: []DescribeMetadataObject{{XmlName: "ApexClass", DirectoryName: "classes"}},
+		})
+		t, found := FindMetadataTypeByDirectory(types, "classes")
+		Expect(found).To(BeTrue())
+		Expect(t.Name).To(Equal("ApexClass"))
+	})
+})
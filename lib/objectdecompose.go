@@ -0,0 +1,296 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A type of the children of custom objects that decomposed objects store
+// in files of their own, in a directory named after the element, e.g.
+// objects/Book__c/fields/Title__c.field.
+type objectChildType struct {
+	Element  string
+	TypeName string
+	Suffix   string
+}
+
+var objectChildTypes = []objectChildType{
+	{Element: "businessProcesses", TypeName: "BusinessProcess", Suffix: "businessProcess"},
+	{Element: "compactLayouts", TypeName: "CompactLayout", Suffix: "compactLayout"},
+	{Element: "fieldSets", TypeName: "FieldSet", Suffix: "fieldSet"},
+	{Element: "fields", TypeName: "CustomField", Suffix: "field"},
+	{Element: "indexes", TypeName: "Index", Suffix: "index"},
+	{Element: "listViews", TypeName: "ListView", Suffix: "listView"},
+	{Element: "recordTypes", TypeName: "RecordType", Suffix: "recordType"},
+	{Element: "sharingReasons", TypeName: "SharingReason", Suffix: "sharingReason"},
+	{Element: "validationRules", TypeName: "ValidationRule", Suffix: "validationRule"},
+	{Element: "webLinks", TypeName: "WebLink", Suffix: "webLink"},
+}
+
+func findObjectChildType(element string) (t objectChildType, found bool) {
+	for _, t = range objectChildTypes {
+		if t.Element == element {
+			return t, true
+		}
+	}
+	return objectChildType{}, false
+}
+
+func findObjectChildTypeByName(typeName string) (t objectChildType, found bool) {
+	for _, t = range objectChildTypes {
+		if t.TypeName == typeName {
+			return t, true
+		}
+	}
+	return objectChildType{}, false
+}
+
+// Returns the object and the metadata member of a file of a decomposed
+// object, given its path ending in objects/<object>/<object>.object or
+// objects/<object>/<element>/<name>.<suffix>.
+func decomposedObjectMember(path string) (object string, metaName string, member string, ok bool) {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	n := len(parts)
+	if n >= 3 && parts[n-3] == "objects" && parts[n-1] == parts[n-2]+".object" {
+		return parts[n-2], "CustomObject", parts[n-2], true
+	}
+	if n >= 4 && parts[n-4] == "objects" {
+		if t, found := findObjectChildType(parts[n-2]); found && strings.HasSuffix(parts[n-1], "."+t.Suffix) {
+			object = parts[n-3]
+			return object, t.TypeName, object + "." + strings.TrimSuffix(parts[n-1], "."+t.Suffix), true
+		}
+	}
+	return "", "", "", false
+}
+
+// Whether a directory holds a decomposed object.
+func IsDecomposedObjectDir(dir string) bool {
+	if filepath.Base(filepath.Dir(dir)) != "objects" {
+		return false
+	}
+	object := filepath.Base(dir)
+	if _, err := os.Stat(filepath.Join(dir, object+".object")); err == nil {
+		return true
+	}
+	for _, t := range objectChildTypes {
+		if info, err := os.Stat(filepath.Join(dir, t.Element)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// Split each objects/<object>.object file into a file for the object's own
+// elements, objects/<object>/<object>.object, and a file for each of its
+// children, e.g. objects/<object>/fields/<field>.field. The object's own
+// file is left out if it has no elements of its own, as when only some of
+// its fields were retrieved.
+func DecomposeObjectFiles(files ForceMetadataFiles) (decomposed ForceMetadataFiles, err error) {
+	decomposed = make(ForceMetadataFiles)
+	for name, data := range files {
+		parts := strings.Split(filepath.ToSlash(name), "/")
+		if len(parts) != 2 || parts[0] != "objects" || !strings.HasSuffix(parts[1], ".object") {
+			decomposed[name] = data
+			continue
+		}
+		object := strings.TrimSuffix(parts[1], ".object")
+		root, parseErr := parseXmlTree(data)
+		if parseErr != nil {
+			return nil, fmt.Errorf("Could not decompose %s: %s", name, parseErr.Error())
+		}
+		var own []*xmlNode
+		for _, child := range root.children {
+			t, isChildType := findObjectChildType(child.name)
+			fullName := xmlChildText(child, "fullName")
+			if !isChildType || fullName == "" {
+				own = append(own, child)
+				continue
+			}
+			child.name = t.TypeName
+			child.attrs = root.attrs
+			decomposed[fmt.Sprintf("objects/%s/%s/%s.%s", object, t.Element, fullName, t.Suffix)] = xmlDocument(child)
+		}
+		if len(own) > 0 {
+			root.children = own
+			decomposed[fmt.Sprintf("objects/%s/%s.object", object, object)] = xmlDocument(root)
+		}
+	}
+	return
+}
+
+// Returns the local files of the children of decomposed objects retrieved
+// whole, i.e. whose own file is among the files, that aren't among the
+// files, such as fields deleted from the org since they were fetched. root
+// returns the source directory of a file given its name.
+func StaleObjectChildFiles(files ForceMetadataFiles, root func(name string) string) (stale []string) {
+	for name := range files {
+		object, metaName, _, ok := decomposedObjectMember(name)
+		if !ok || metaName != "CustomObject" {
+			continue
+		}
+		dir := filepath.Join(root(name), "objects", object)
+		for _, t := range objectChildTypes {
+			matches, _ := filepath.Glob(filepath.Join(dir, t.Element, "*."+t.Suffix))
+			for _, match := range matches {
+				childName := fmt.Sprintf("objects/%s/%s/%s", object, t.Element, filepath.Base(match))
+				if _, found := files[childName]; !found {
+					stale = append(stale, match)
+				}
+			}
+		}
+	}
+	sort.Strings(stale)
+	return
+}
+
+// Split the files at the paths, by their names in the package, into those
+// deployed as they are and the objects recomposed from the files of
+// decomposed objects, reading only the latter.
+func RecomposeObjectPaths(paths map[string]string) (rest map[string]string, objects ForceMetadataFiles, err error) {
+	rest = make(map[string]string)
+	decomposed := make(ForceMetadataFiles)
+	for name, path := range paths {
+		if _, _, _, ok := decomposedObjectMember(name); !ok {
+			rest[name] = path
+			continue
+		}
+		if decomposed[name], err = ioutil.ReadFile(path); err != nil {
+			return
+		}
+	}
+	objects, err = RecomposeObjectFiles(decomposed)
+	return
+}
+
+// Combine the files of decomposed objects into objects/<object>.object
+// files holding the object's own elements, if its file is among the files,
+// and the children among the files.
+func RecomposeObjectFiles(files ForceMetadataFiles) (recomposed ForceMetadataFiles, err error) {
+	recomposed = make(ForceMetadataFiles)
+	objectFiles := make(map[string][]string)
+	for name, data := range files {
+		if object, _, _, ok := decomposedObjectMember(name); ok {
+			objectFiles[object] = append(objectFiles[object], name)
+			continue
+		}
+		recomposed[name] = data
+	}
+	for object, names := range objectFiles {
+		root := &xmlNode{
+			name:  "CustomObject",
+			attrs: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "http://soap.sforce.com/2006/04/metadata"}},
+		}
+		var children []*xmlNode
+		sort.Strings(names)
+		for _, name := range names {
+			node, parseErr := parseXmlTree(files[name])
+			if parseErr != nil {
+				return nil, fmt.Errorf("Could not recompose %s: %s", name, parseErr.Error())
+			}
+			if _, metaName, _, _ := decomposedObjectMember(name); metaName == "CustomObject" {
+				root.attrs = node.attrs
+				children = append(node.children, children...)
+				continue
+			}
+			element := filepath.Base(filepath.Dir(name))
+			node.name = element
+			node.attrs = nil
+			children = append(children, node)
+		}
+		// The elements of objects are in alphabetical order
+		sort.SliceStable(children, func(i, j int) bool {
+			return children[i].name < children[j].name
+		})
+		root.children = children
+		recomposed[filepath.Join("objects", object+".object")] = xmlDocument(root)
+	}
+	return
+}
+
+func xmlDocument(root *xmlNode) []byte {
+	var out bytes.Buffer
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	writeXmlNode(&out, root, 0)
+	return out.Bytes()
+}
+
+// Add a file of a decomposed object to the package. Adding the object's
+// own file adds the whole object, including all of its children. Adding a
+// child alone adds just that member, e.g. a CustomField.
+func (pb *PackageBuilder) addDecomposedObjectFile(fpath string, object string, metaName string, member string) (err error) {
+	objectDir := filepath.Dir(fpath)
+	if metaName != "CustomObject" {
+		objectDir = filepath.Dir(objectDir)
+		if !pb.hasMember("CustomObject", object) {
+			pb.AddMetaToPackage(metaName, member)
+		}
+		if pb.IsPush {
+			err = pb.addDecomposedObjectFileToWorkingDir(objectDir, fpath)
+		}
+		return
+	}
+
+	pb.AddMetaToPackage("CustomObject", object)
+	pb.removeObjectChildMembers(object)
+	if !pb.IsPush {
+		return
+	}
+	return filepath.Walk(objectDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !f.Mode().IsRegular() || pb.Ignore.Ignored(path) {
+			return nil
+		}
+		if _, _, _, ok := decomposedObjectMember(path); !ok {
+			return nil
+		}
+		return pb.addDecomposedObjectFileToWorkingDir(objectDir, path)
+	})
+}
+
+func (pb *PackageBuilder) addDecomposedObjectFileToWorkingDir(objectDir string, fpath string) (err error) {
+	rel, err := filepath.Rel(filepath.Dir(filepath.Dir(objectDir)), fpath)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return
+	}
+	pb.Files[rel] = data
+	return
+}
+
+func (pb *PackageBuilder) hasMember(metaName string, member string) bool {
+	return pb.contains(pb.Metadata[metaName].Members, member)
+}
+
+// Remove the members of the children of an object, which are included
+// with it.
+func (pb *PackageBuilder) removeObjectChildMembers(object string) {
+	for _, t := range objectChildTypes {
+		mt, found := pb.Metadata[t.TypeName]
+		if !found {
+			continue
+		}
+		var members []string
+		for _, member := range mt.Members {
+			if !strings.HasPrefix(member, object+".") {
+				members = append(members, member)
+			}
+		}
+		if len(members) == 0 {
+			delete(pb.Metadata, t.TypeName)
+			continue
+		}
+		mt.Members = members
+		pb.Metadata[t.TypeName] = mt
+	}
+}
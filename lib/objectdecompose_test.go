@@ -0,0 +1,186 @@
+package lib_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const bookObject = `<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <deploymentStatus>Deployed</deploymentStatus>
+    <fields>
+        <fullName>Author__c</fullName>
+        <type>Text</type>
+    </fields>
+    <fields>
+        <fullName>Title__c</fullName>
+        <type>Text</type>
+    </fields>
+    <label>Book</label>
+    <listViews>
+        <fullName>All</fullName>
+        <filterScope>Everything</filterScope>
+    </listViews>
+    <sharingModel>ReadWrite</sharingModel>
+</CustomObject>
+`
+
+var _ = Describe("ObjectDecompose", func() {
+	Describe("DecomposeObjectFiles", func() {
+		It("should split objects into a file per child", func() {
+			files, err := DecomposeObjectFiles(ForceMetadataFiles{
+				"objects/Book__c.object": []byte(bookObject),
+				"classes/Book.cls":       []byte("public class Book {}"),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(HaveLen(5))
+			Expect(string(files["classes/Book.cls"])).To(Equal("public class Book {}"))
+			Expect(string(files["objects/Book__c/Book__c.object"])).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <deploymentStatus>Deployed</deploymentStatus>
+    <label>Book</label>
+    <sharingModel>ReadWrite</sharingModel>
+</CustomObject>
+`))
+			Expect(string(files["objects/Book__c/fields/Title__c.field"])).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomField xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fullName>Title__c</fullName>
+    <type>Text</type>
+</CustomField>
+`))
+			Expect(files).To(HaveKey("objects/Book__c/fields/Author__c.field"))
+			Expect(files).To(HaveKey("objects/Book__c/listViews/All.listView"))
+		})
+
+		It("should leave out the object's own file when only children were retrieved", func() {
+			files, err := DecomposeObjectFiles(ForceMetadataFiles{
+				"objects/Book__c.object": []byte(`<CustomObject><fields><fullName>Title__c</fullName></fields></CustomObject>`),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+			Expect(files).To(HaveKey("objects/Book__c/fields/Title__c.field"))
+		})
+	})
+
+	Describe("RecomposeObjectFiles", func() {
+		It("should restore decomposed objects", func() {
+			decomposed, err := DecomposeObjectFiles(ForceMetadataFiles{"objects/Book__c.object": []byte(bookObject)})
+			Expect(err).ToNot(HaveOccurred())
+			files, err := RecomposeObjectFiles(decomposed)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+			Expect(string(files["objects/Book__c.object"])).To(Equal(bookObject))
+		})
+
+		It("should recompose only the children given", func() {
+			decomposed, err := DecomposeObjectFiles(ForceMetadataFiles{"objects/Book__c.object": []byte(bookObject)})
+			Expect(err).ToNot(HaveOccurred())
+			files, err := RecomposeObjectFiles(ForceMetadataFiles{
+				"objects/Book__c/fields/Title__c.field": decomposed["objects/Book__c/fields/Title__c.field"],
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(files["objects/Book__c.object"])).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>Title__c</fullName>
+        <type>Text</type>
+    </fields>
+</CustomObject>
+`))
+		})
+	})
+
+	Describe("StaleObjectChildFiles", func() {
+		It("should find the local children of whole objects that weren't retrieved", func() {
+			tempDir, _ := ioutil.TempDir("", "force-decompose")
+			defer os.RemoveAll(tempDir)
+			for _, name := range []string{
+				"objects/Book__c/fields/Title__c.field",
+				"objects/Book__c/fields/Deleted__c.field",
+				"objects/Book__c/listViews/Old.listView",
+				"objects/Shelf__c/fields/Deleted__c.field",
+			} {
+				path := filepath.Join(tempDir, filepath.FromSlash(name))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				Expect(ioutil.WriteFile(path, nil, 0644)).To(Succeed())
+			}
+			decomposed, err := DecomposeObjectFiles(ForceMetadataFiles{"objects/Book__c.object": []byte(bookObject)})
+			Expect(err).ToNot(HaveOccurred())
+			// Only a field of Shelf__c was retrieved, not the whole object
+			decomposed["objects/Shelf__c/fields/Width__c.field"] = []byte("<CustomField/>")
+			stale := StaleObjectChildFiles(decomposed, func(string) string { return tempDir })
+			Expect(stale).To(Equal([]string{
+				filepath.Join(tempDir, "objects", "Book__c", "fields", "Deleted__c.field"),
+				filepath.Join(tempDir, "objects", "Book__c", "listViews", "Old.listView"),
+			}))
+		})
+	})
+
+	Describe("RecomposeObjectPaths", func() {
+		It("should read only the files of decomposed objects", func() {
+			tempDir, _ := ioutil.TempDir("", "force-decompose")
+			defer os.RemoveAll(tempDir)
+			decomposed, err := DecomposeObjectFiles(ForceMetadataFiles{"objects/Book__c.object": []byte(bookObject)})
+			Expect(err).ToNot(HaveOccurred())
+			decomposed["classes/Book.cls"] = []byte("public class Book {}")
+			paths := make(map[string]string)
+			for name, data := range decomposed {
+				path := filepath.Join(tempDir, filepath.FromSlash(name))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				Expect(ioutil.WriteFile(path, data, 0644)).To(Succeed())
+				paths[name] = path
+			}
+			rest, objects, err := RecomposeObjectPaths(paths)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rest).To(Equal(map[string]string{"classes/Book.cls": paths["classes/Book.cls"]}))
+			Expect(objects).To(HaveLen(1))
+			Expect(string(objects["objects/Book__c.object"])).To(Equal(bookObject))
+		})
+	})
+
+	Describe("PackageBuilder", func() {
+		var srcDir string
+
+		BeforeEach(func() {
+			tempDir, _ := ioutil.TempDir("", "force-decompose")
+			srcDir = filepath.Join(tempDir, "src")
+			decomposed, err := DecomposeObjectFiles(ForceMetadataFiles{"objects/Book__c.object": []byte(bookObject)})
+			Expect(err).ToNot(HaveOccurred())
+			for name, data := range decomposed {
+				path := filepath.Join(srcDir, filepath.FromSlash(name))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				Expect(ioutil.WriteFile(path, data, 0644)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(filepath.Dir(srcDir))
+		})
+
+		It("should push a field alone as a CustomField", func() {
+			pb := NewPushBuilder()
+			_, err := pb.AddFile(filepath.Join(srcDir, "objects", "Book__c", "fields", "Title__c.field"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pb.Query()).To(Equal(ForceMetadataQuery{{Name: []string{"CustomField"}, Members: []string{"Book__c.Title__c"}}}))
+			files := pb.ForceMetadataFiles()
+			Expect(files).To(HaveLen(2))
+			Expect(string(files["objects/Book__c.object"])).To(ContainSubstring("<fullName>Title__c</fullName>"))
+			Expect(string(files["objects/Book__c.object"])).ToNot(ContainSubstring("Author__c"))
+		})
+
+		It("should push an object's directory as the whole object", func() {
+			pb := NewPushBuilder()
+			_, _, err := pb.AddDirectory(filepath.Join(srcDir, "objects", "Book__c"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pb.Query()).To(Equal(ForceMetadataQuery{{Name: []string{"CustomObject"}, Members: []string{"Book__c"}}}))
+			files := pb.ForceMetadataFiles()
+			Expect(string(files["objects/Book__c.object"])).To(Equal(bookObject))
+		})
+	})
+})
@@ -2,10 +2,12 @@ package lib
 
 import (
 	"encoding/xml"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	. "github.com/ForceCLI/force/error"
@@ -15,7 +17,7 @@ import (
 type Package struct {
 	Xmlns   string     `xml:"xmlns,attr"`
 	Types   []MetaType `xml:"types"`
-	Version string     `xml:"version"`
+	Version string     `xml:"version,omitempty"`
 }
 
 type MetaType struct {
@@ -38,6 +40,8 @@ type metapath struct {
 	extension  string
 }
 
+// Static mapping of source directories to metadata types, used when the
+// types can't be retrieved with describeMetadata.
 var metapaths = []metapath{
 	metapath{path: "actionLinkGroupTemplates", name: "ActionLinkGroupTemplate"},
 	metapath{path: "analyticSnapshots", name: "AnalyticSnapshot"},
@@ -86,8 +90,8 @@ var metapaths = []metapath{
 	metapath{path: "layouts", name: "Layout"},
 	metapath{path: "LeadConvertSettings", name: "LeadConvertSettings"},
 	metapath{path: "letterhead", name: "Letterhead"},
+	metapath{path: "lwc", name: "LightningComponentBundle", hasFolder: true, onlyFolder: true},
 	metapath{path: "matchingRules", name: "MatchingRules"},
-	metapath{path: "matchingRules", name: "MatchingRule"},
 	metapath{path: "namedCredentials", name: "NamedCredential"},
 	metapath{path: "networks", name: "Network"},
 	metapath{path: "objects", name: "CustomObject"},
@@ -97,9 +101,6 @@ var metapaths = []metapath{
 	metapath{path: "permissionsets", name: "PermissionSet"},
 	metapath{path: "postTemplates", name: "PostTemplate"},
 	metapath{path: "profiles", name: "Profile", extension: ".profile"},
-	metapath{path: "postTemplates", name: "PostTemplate"},
-	metapath{path: "postTemplates", name: "PostTemplate"},
-	metapath{path: "profiles", name: "Profile"},
 	metapath{path: "profileSessionSettings", name: "ProfileSessionSetting"},
 	metapath{path: "queues", name: "Queue"},
 	metapath{path: "quickActions", name: "QuickAction"},
@@ -127,12 +128,19 @@ type PackageBuilder struct {
 	IsPush   bool
 	Metadata map[string]MetaType
 	Files    ForceMetadataFiles
+	// Files matching .forceignore are left out of the package
+	Ignore *ForceIgnore
 }
 
 func NewPushBuilder() PackageBuilder {
 	pb := PackageBuilder{IsPush: true}
 	pb.Metadata = make(map[string]MetaType)
 	pb.Files = make(ForceMetadataFiles)
+	ignore, err := LoadProjectForceIgnore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read .forceignore: %s\n", err.Error())
+	}
+	pb.Ignore = ignore
 
 	return pb
 }
@@ -145,13 +153,35 @@ func NewFetchBuilder() PackageBuilder {
 	return pb
 }
 
-// Build and return package.xml
-func (pb PackageBuilder) PackageXml() []byte {
-	p := createPackage()
+// Returns a query retrieving the members added to the builder.
+func (pb PackageBuilder) Query() (query ForceMetadataQuery) {
+	var names []string
+	for name := range pb.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		query = append(query, ForceMetadataQueryElement{Name: []string{name}, Members: pb.Metadata[name].Members})
+	}
+	return
+}
 
+// Returns the types added to the builder sorted by name, with their
+// members sorted, so that the generated manifests are stable.
+func (pb PackageBuilder) sortedTypes() (types []MetaType) {
 	for _, metaType := range pb.Metadata {
-		p.Types = append(p.Types, metaType)
+		members := append([]string(nil), metaType.Members...)
+		sort.Strings(members)
+		types = append(types, MetaType{Name: metaType.Name, Members: members})
 	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return
+}
+
+// Build and return package.xml
+func (pb PackageBuilder) PackageXml() []byte {
+	p := createPackage()
+	p.Types = pb.sortedTypes()
 
 	byteXml, _ := xml.MarshalIndent(p, "", "    ")
 	byteXml = append([]byte(xml.Header), byteXml...)
@@ -161,8 +191,24 @@ func (pb PackageBuilder) PackageXml() []byte {
 	return byteXml
 }
 
-// Returns the full ForceMetadataFiles container
+// Build and return destructiveChanges.xml, which lists the members to
+// delete like package.xml but has no version.
+func (pb PackageBuilder) DestructiveChangesXml() []byte {
+	p := createPackage()
+	p.Version = ""
+	p.Types = pb.sortedTypes()
+	byteXml, _ := xml.MarshalIndent(p, "", "    ")
+	return append([]byte(xml.Header), byteXml...)
+}
+
+// Returns the full ForceMetadataFiles container, with the files of
+// decomposed objects recomposed
 func (pb *PackageBuilder) ForceMetadataFiles() ForceMetadataFiles {
+	files, err := RecomposeObjectFiles(pb.Files)
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	pb.Files = files
 	pb.Files["package.xml"] = pb.PackageXml()
 	return pb.Files
 }
@@ -192,6 +238,11 @@ func (pb *PackageBuilder) AddFile(fpath string) (fname string, err error) {
 		return
 	}
 
+	if object, metaName, member, ok := decomposedObjectMember(fpath); ok {
+		err = pb.addDecomposedObjectFile(fpath, object, metaName, member)
+		return member, err
+	}
+
 	isDestructiveChanges, err := regexp.MatchString("destructiveChanges(Pre|Post)?"+regexp.QuoteMeta(".")+"xml", fpath)
 	if err != nil {
 		return
@@ -227,6 +278,13 @@ func (pb *PackageBuilder) AddDirectory(fpath string) (namePaths map[string]strin
 
 	for _, f := range files {
 		dirOrFilePath := fpath + "/" + f.Name()
+		// The package.xml is generated from the files added
+		if f.Name() == "package.xml" {
+			continue
+		}
+		if isIgnoredBundleEntry(fpath, f) || pb.Ignore.Ignored(dirOrFilePath) {
+			continue
+		}
 		if f.IsDir() {
 			dirNamePaths, dirBadPath, err := pb.AddDirectory(dirOrFilePath)
 			if err != nil {
@@ -236,6 +294,7 @@ func (pb *PackageBuilder) AddDirectory(fpath string) (namePaths map[string]strin
 					namePaths[dirContentName] = dirContentPath
 				}
 			}
+			continue
 		}
 
 		name, err := pb.AddFile(dirOrFilePath)
@@ -249,11 +308,21 @@ func (pb *PackageBuilder) AddDirectory(fpath string) (namePaths map[string]strin
 	return
 }
 
+// Lightning web component Jest tests and the tooling configuration files
+// (jsconfig.json, .eslintrc.json) in the lwc folder aren't part of any
+// bundle and can't be deployed.
+func isIgnoredBundleEntry(dir string, f os.FileInfo) bool {
+	if f.IsDir() {
+		return f.Name() == "__tests__"
+	}
+	return filepath.Base(dir) == "lwc"
+}
+
 // Adds the file to a temp directory for deploy
 func (pb *PackageBuilder) addFileToWorkingDir(metaName string, fpath string) (err error) {
 	// Get relative dir from source
 	srcDir := filepath.Dir(filepath.Dir(fpath))
-	for _, mp := range metapaths {
+	for _, mp := range knownMetapaths() {
 		if metaName == mp.name && mp.hasFolder {
 			srcDir = filepath.Dir(srcDir)
 		}
@@ -348,7 +417,7 @@ func findMetapathForFile(file string) (path metapath) {
 	grandparentName := filepath.Base(filepath.Dir(parentDir))
 	fileExtension := filepath.Ext(file)
 
-	for _, mp := range metapaths {
+	for _, mp := range knownMetapaths() {
 		if mp.hasFolder && grandparentName == mp.path {
 			return mp
 		}
@@ -358,7 +427,7 @@ func findMetapathForFile(file string) (path metapath) {
 	}
 
 	// Hmm, maybe we can use the extension to determine the type
-	for _, mp := range metapaths {
+	for _, mp := range knownMetapaths() {
 		if mp.extension == fileExtension {
 			return mp
 		}
@@ -366,6 +435,20 @@ func findMetapathForFile(file string) (path metapath) {
 	return
 }
 
+// Returns the metadata type and member name of a file, given its path
+// relative to the source directory, e.g. ApexClass and Foo for
+// classes/Foo.cls-meta.xml, or CustomField and Book__c.Title__c for
+// objects/Book__c/fields/Title__c.field in a decomposed object.
+func MetadataMemberForFile(name string) (metaName string, member string) {
+	if _, metaName, member, ok := decomposedObjectMember(name); ok {
+		return metaName, member
+	}
+	name = strings.TrimSuffix(filepath.FromSlash(name), "-meta.xml")
+	metaName, fileName := getMetaForPath(name)
+	member = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	return
+}
+
 // Gets meta type and name based on a path
 func getMetaForPath(path string) (metaName string, objectName string) {
 	parentDir := filepath.Dir(path)
@@ -373,7 +456,7 @@ func getMetaForPath(path string) (metaName string, objectName string) {
 	grandparentName := filepath.Base(filepath.Dir(parentDir))
 	fileName := filepath.Base(path)
 
-	for _, mp := range metapaths {
+	for _, mp := range knownMetapaths() {
 		if mp.hasFolder && grandparentName == mp.path {
 			metaName = mp.name
 			if mp.onlyFolder {
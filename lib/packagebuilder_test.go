@@ -1,6 +1,7 @@
 package lib_test
 
 import (
+	"encoding/xml"
 	. "github.com/ForceCLI/force/lib"
 	"io/ioutil"
 	"os"
@@ -157,4 +158,67 @@ var _ = Describe("Packagebuilder", func() {
 			})
 		})
 	})
+
+	Describe("AddDirectory", func() {
+		var (
+			pb      PackageBuilder
+			tempDir string
+		)
+
+		BeforeEach(func() {
+			pb = NewPushBuilder()
+			tempDir, _ = ioutil.TempDir("", "packagebuilder-test")
+			os.MkdirAll(tempDir+"/src/lwc/myCmp/__tests__", 0755)
+			ioutil.WriteFile(tempDir+"/src/lwc/jsconfig.json", []byte("{}"), 0644)
+			ioutil.WriteFile(tempDir+"/src/lwc/myCmp/myCmp.js", []byte("export default class MyCmp {}"), 0644)
+			ioutil.WriteFile(tempDir+"/src/lwc/myCmp/myCmp.js-meta.xml", []byte(`<?xml version="1.0" encoding="UTF-8"?>`), 0644)
+			ioutil.WriteFile(tempDir+"/src/lwc/myCmp/__tests__/myCmp.test.js", []byte(""), 0644)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tempDir)
+		})
+
+		It("should add lightning web component bundles", func() {
+			pb.AddDirectory(tempDir + "/src/lwc")
+			Expect(pb.Files).To(HaveKey("lwc/myCmp/myCmp.js"))
+			Expect(pb.Files).To(HaveKey("lwc/myCmp/myCmp.js-meta.xml"))
+			Expect(pb.Metadata["LightningComponentBundle"].Members).To(Equal([]string{"myCmp"}))
+		})
+		It("should skip jest tests and configuration files", func() {
+			pb.AddDirectory(tempDir + "/src/lwc")
+			Expect(pb.Files).To(HaveLen(2))
+		})
+	})
+
+	Describe("MetadataMemberForFile", func() {
+		It("should return the member of a file", func() {
+			metaName, member := MetadataMemberForFile("classes/Foo.cls-meta.xml")
+			Expect([]string{metaName, member}).To(Equal([]string{"ApexClass", "Foo"}))
+		})
+
+		It("should return the members of decomposed objects' files", func() {
+			metaName, member := MetadataMemberForFile("objects/Book__c/fields/Title__c.field")
+			Expect([]string{metaName, member}).To(Equal([]string{"CustomField", "Book__c.Title__c"}))
+			metaName, member = MetadataMemberForFile("objects/Book__c/Book__c.object")
+			Expect([]string{metaName, member}).To(Equal([]string{"CustomObject", "Book__c"}))
+		})
+	})
+
+	Describe("PackageXml", func() {
+		It("should sort types and members", func() {
+			pb := NewFetchBuilder()
+			pb.AddMetaToPackage("CustomObject", "Zebra__c")
+			pb.AddMetaToPackage("ApexClass", "Foo")
+			pb.AddMetaToPackage("CustomObject", "Account")
+			pb.AddMetaToPackage("ApexClass", "Bar")
+
+			var pkg Package
+			Expect(xml.Unmarshal(pb.PackageXml(), &pkg)).To(Succeed())
+			Expect(pkg.Types).To(Equal([]MetaType{
+				{Name: "ApexClass", Members: []string{"Bar", "Foo"}},
+				{Name: "CustomObject", Members: []string{"Account", "Zebra__c"}},
+			}))
+		})
+	})
 })
@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"sort"
+)
+
+// The types whose members the elements of profiles and permission sets
+// grant access to. Retrieving profiles with all members of one of the types
+// returns all of the elements.
+var profileElementTypes = map[string][]string{
+	"applicationVisibilities":       {"CustomApplication"},
+	"categoryGroupVisibilities":     {"DataCategoryGroup"},
+	"classAccesses":                 {"ApexClass"},
+	"customMetadataTypeAccesses":    {"CustomObject"},
+	"customPermissions":             {"CustomPermission"},
+	"customSettingAccesses":         {"CustomObject"},
+	"externalDataSourceAccesses":    {"ExternalDataSource"},
+	"fieldPermissions":              {"CustomObject", "CustomField"},
+	"flowAccesses":                  {"Flow"},
+	"layoutAssignments":             {"Layout"},
+	"loginFlows":                    {"Flow", "ApexPage"},
+	"objectPermissions":             {"CustomObject"},
+	"pageAccesses":                  {"ApexPage"},
+	"profileActionOverrides":        {"CustomObject", "CustomApplication", "FlexiPage"},
+	"recordTypeVisibilities":        {"CustomObject", "RecordType"},
+	"servicePresenceStatusAccesses": {"ServicePresenceStatus"},
+	"tabSettings":                   {"CustomTab"},
+	"tabVisibilities":               {"CustomTab"},
+}
+
+func isProfileType(typeName string) bool {
+	return typeName == "Profile" || typeName == "PermissionSet"
+}
+
+// Retrieve the profiles or permission sets in the query together with all
+// members of the types, since a profile only includes its permissions for
+// the members retrieved with it. Only the files of the profiles or
+// permission sets are returned. The retrieve can't be split into chunks.
+func (f *Force) RetrieveProfilesWith(query ForceMetadataQuery, types []string) (files ForceMetadataFiles, problems []string, err error) {
+	var withQuery ForceMetadataQuery
+	for _, typeName := range types {
+		withQuery = append(withQuery, ForceMetadataQueryElement{Name: []string{typeName}, Members: []string{"*"}})
+	}
+	if withQuery, err = f.ExpandWildcards(withQuery); err != nil {
+		return
+	}
+	query = append(query, withQuery...)
+	retrieved, problems, properties, err := f.Metadata.retrieveQuery(query)
+	if err != nil {
+		return
+	}
+	f.Metadata.RetrievedFileProperties = nil
+	for _, p := range properties {
+		if isProfileType(p.Type) {
+			f.Metadata.RetrievedFileProperties = append(f.Metadata.RetrievedFileProperties, p)
+		}
+	}
+	files = make(ForceMetadataFiles)
+	for name, data := range retrieved {
+		if metaName, _ := MetadataMemberForFile(name); isProfileType(metaName) {
+			files[name] = data
+		}
+	}
+	return
+}
+
+// Merge a profile or permission set retrieved with all members of the types
+// into the local version. Elements granting access to members of the types
+// are taken from the retrieved version, and those for other types are kept
+// from the local one. The profile's own settings, such as its user
+// permissions, are taken from the retrieved version, but elements the
+// retrieved version doesn't have at all are kept from the local one in case
+// they depend on members that weren't retrieved. The result is in the
+// canonical form of CanonicalizeXml.
+func MergeProfileXml(local, retrieved []byte, types []string) (merged []byte, err error) {
+	root, err := parseXmlTree(retrieved)
+	if err != nil {
+		return
+	}
+	if local != nil {
+		localRoot, parseErr := parseXmlTree(local)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		inScope := make(map[string]bool)
+		for element, elementTypes := range profileElementTypes {
+			for _, t := range elementTypes {
+				for _, typeName := range types {
+					if t == typeName {
+						inScope[element] = true
+					}
+				}
+			}
+		}
+		retrievedElements := make(map[string]bool)
+		for _, child := range root.children {
+			retrievedElements[child.name] = true
+		}
+		var children []*xmlNode
+		for _, child := range localRoot.children {
+			_, scoped := profileElementTypes[child.name]
+			if (scoped && !inScope[child.name]) || (!scoped && !retrievedElements[child.name]) {
+				children = append(children, child)
+			}
+		}
+		for _, child := range root.children {
+			if _, scoped := profileElementTypes[child.name]; !scoped || inScope[child.name] {
+				children = append(children, child)
+			}
+		}
+		// The elements of profiles and permission sets are in alphabetical
+		// order
+		sort.SliceStable(children, func(i, j int) bool {
+			return children[i].name < children[j].name
+		})
+		root.children = children
+	}
+	sortKeyedXmlNodes(root)
+	return xmlDocument(root), nil
+}
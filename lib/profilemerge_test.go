@@ -0,0 +1,107 @@
+package lib_test
+
+import (
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MergeProfileXml", func() {
+	local := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Profile xmlns="http://soap.sforce.com/2006/04/metadata">
+    <classAccesses>
+        <apexClass>Deleted</apexClass>
+        <enabled>true</enabled>
+    </classAccesses>
+    <custom>false</custom>
+    <fieldPermissions>
+        <editable>true</editable>
+        <field>Book__c.Title__c</field>
+        <readable>true</readable>
+    </fieldPermissions>
+    <userLicense>Salesforce</userLicense>
+</Profile>
+`)
+	retrieved := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Profile xmlns="http://soap.sforce.com/2006/04/metadata">
+    <classAccesses>
+        <apexClass>Book</apexClass>
+        <enabled>true</enabled>
+    </classAccesses>
+    <classAccesses>
+        <apexClass>Author</apexClass>
+        <enabled>false</enabled>
+    </classAccesses>
+    <custom>true</custom>
+    <userLicense>Salesforce</userLicense>
+</Profile>
+`)
+
+	It("should replace the elements for the types and keep the others", func() {
+		merged, err := MergeProfileXml(local, retrieved, []string{"ApexClass"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(merged)).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<Profile xmlns="http://soap.sforce.com/2006/04/metadata">
+    <classAccesses>
+        <apexClass>Author</apexClass>
+        <enabled>false</enabled>
+    </classAccesses>
+    <classAccesses>
+        <apexClass>Book</apexClass>
+        <enabled>true</enabled>
+    </classAccesses>
+    <custom>true</custom>
+    <fieldPermissions>
+        <editable>true</editable>
+        <field>Book__c.Title__c</field>
+        <readable>true</readable>
+    </fieldPermissions>
+    <userLicense>Salesforce</userLicense>
+</Profile>
+`))
+	})
+
+	It("should keep local elements out of scope or missing from the retrieved file", func() {
+		local := []byte(`<Profile xmlns="http://soap.sforce.com/2006/04/metadata">
+    <custom>false</custom>
+    <loginFlows>
+        <flow>Verify</flow>
+    </loginFlows>
+    <profileActionOverrides>
+        <content>Book_Record_Page</content>
+    </profileActionOverrides>
+    <someNewAccesses>
+        <name>Future</name>
+    </someNewAccesses>
+</Profile>
+`)
+		merged, err := MergeProfileXml(local, retrieved, []string{"ApexClass"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(merged)).To(ContainSubstring("<flow>Verify</flow>"))
+		Expect(string(merged)).To(ContainSubstring("<content>Book_Record_Page</content>"))
+		Expect(string(merged)).To(ContainSubstring("<name>Future</name>"))
+		Expect(string(merged)).To(ContainSubstring("<custom>true</custom>"))
+		Expect(string(merged)).ToNot(ContainSubstring("<custom>false</custom>"))
+	})
+
+	It("should replace mapped elements of the types", func() {
+		local := []byte(`<Profile xmlns="http://soap.sforce.com/2006/04/metadata">
+    <loginFlows>
+        <flow>Old</flow>
+    </loginFlows>
+</Profile>
+`)
+		merged, err := MergeProfileXml(local, retrieved, []string{"Flow"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(merged)).ToNot(ContainSubstring("<flow>Old</flow>"))
+	})
+
+	It("should use the retrieved file when there is no local one", func() {
+		merged, err := MergeProfileXml(nil, retrieved, []string{"ApexClass"})
+		Expect(err).ToNot(HaveOccurred())
+		canonical, err := CanonicalizeXml(retrieved)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(merged).To(Equal(canonical))
+	})
+})
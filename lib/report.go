@@ -0,0 +1,338 @@
+package lib
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	. "github.com/ForceCLI/force/error"
+)
+
+// Machine-readable reports of deploy and test results, for consumption by
+// CI servers.
+
+type ReportComponentFailure struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	File        string `json:"file,omitempty"`
+	Line        int    `json:"line,omitempty"`
+	ProblemType string `json:"problemType,omitempty"`
+	Problem     string `json:"problem"`
+}
+
+type ReportTestResult struct {
+	ClassName  string  `json:"className"`
+	MethodName string  `json:"methodName"`
+	Passed     bool    `json:"passed"`
+	Message    string  `json:"message,omitempty"`
+	StackTrace string  `json:"stackTrace,omitempty"`
+	Time       float64 `json:"time"`
+}
+
+type ReportCoverageWarning struct {
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+type ResultReport struct {
+	Success           bool                     `json:"success"`
+	Status            string                   `json:"status,omitempty"`
+	ComponentFailures []ReportComponentFailure `json:"componentFailures"`
+	Tests             []ReportTestResult       `json:"tests"`
+	CoverageWarnings  []ReportCoverageWarning  `json:"coverageWarnings"`
+}
+
+// Build a report from the result of a deploy. namePaths maps component names
+// to local file paths, which are preferred over the package-relative file
+// names returned by Salesforce.
+func NewDeployReport(result ForceCheckDeploymentStatusResult, namePaths map[string]string) (report ResultReport) {
+	report.Success = result.Success
+	report.Status = result.Status
+	for _, problem := range result.Details.ComponentFailures {
+		file := problem.FileName
+		if fname, found := namePaths[problem.FullName]; found {
+			file = fname
+		}
+		report.ComponentFailures = append(report.ComponentFailures, ReportComponentFailure{
+			Name:        problem.FullName,
+			Type:        problem.ComponentType,
+			File:        file,
+			Line:        problem.LineNumber,
+			ProblemType: problem.ProblemType,
+			Problem:     problem.Problem,
+		})
+	}
+	testResult := result.Details.RunTestResult
+	for _, success := range testResult.TestSuccesses {
+		report.Tests = append(report.Tests, ReportTestResult{
+			ClassName:  success.Name,
+			MethodName: success.MethodName,
+			Passed:     true,
+			Time:       float64(success.Time),
+		})
+	}
+	for _, failure := range testResult.TestFailures {
+		report.Tests = append(report.Tests, ReportTestResult{
+			ClassName:  failure.Name,
+			MethodName: failure.MethodName,
+			Message:    failure.Message,
+			StackTrace: failure.StackTrace,
+			Time:       float64(failure.Time),
+		})
+	}
+	for _, warning := range testResult.CodeCoverageWarnings {
+		report.CoverageWarnings = append(report.CoverageWarnings, ReportCoverageWarning{
+			Name:    warning.Name,
+			Message: warning.Message,
+		})
+	}
+	return
+}
+
+// Build a report from the result of running tests. Coverage warnings are
+// reported but don't make the run fail.
+func NewTestReport(output TestCoverage) (report ResultReport) {
+	for index := range output.SMethodNames {
+		report.Tests = append(report.Tests, ReportTestResult{
+			ClassName:  stringAt(output.SClassNames, index),
+			MethodName: output.SMethodNames[index],
+			Passed:     true,
+			Time:       timeAt(output.STime, index),
+		})
+	}
+	for index := range output.FMethodNames {
+		report.Tests = append(report.Tests, ReportTestResult{
+			ClassName:  stringAt(output.FClassNames, index),
+			MethodName: output.FMethodNames[index],
+			Message:    stringAt(output.FMessage, index),
+			StackTrace: stringAt(output.FStackTrace, index),
+			Time:       timeAt(output.FTime, index),
+		})
+	}
+	for _, warning := range output.CoverageWarnings {
+		report.CoverageWarnings = append(report.CoverageWarnings, ReportCoverageWarning{
+			Name:    warning.Name,
+			Message: warning.Message,
+		})
+	}
+	report.Success = len(output.FMethodNames) == 0
+	return
+}
+
+func timeAt(times []float32, index int) float64 {
+	if index < len(times) {
+		return float64(times[index])
+	}
+	return 0
+}
+
+func stringAt(values []string, index int) string {
+	if index < len(values) {
+		return values[index]
+	}
+	return ""
+}
+
+// Returns the process exit code that describes the most significant failure
+// in the report, or 0 if there was none.
+func (report ResultReport) ExitCode() int {
+	switch {
+	case len(report.ComponentFailures) > 0:
+		return ExitCodeComponentFailures
+	case report.failedTests() > 0:
+		return ExitCodeTestFailures
+	case !report.Success && len(report.CoverageWarnings) > 0:
+		return ExitCodeCoverageWarnings
+	case !report.Success:
+		return ExitCodeError
+	}
+	return 0
+}
+
+func (report ResultReport) failedTests() (failures int) {
+	for _, test := range report.Tests {
+		if !test.Passed {
+			failures++
+		}
+	}
+	return
+}
+
+func (report ResultReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(report, "", "  ")
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+	time     float64
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// Salesforce reports test times in milliseconds; JUnit expects seconds.
+func junitTime(milliseconds float64) string {
+	return fmt.Sprintf("%.3f", milliseconds/1000)
+}
+
+// Render the report as JUnit XML. Each test class becomes a test suite.
+// Component failures and coverage warnings are reported as failed test cases
+// in their own suites so that CI servers display them alongside tests.
+func (report ResultReport) JUnit() ([]byte, error) {
+	suitesByClass := make(map[string]*junitTestSuite)
+	var classNames []string
+	for _, test := range report.Tests {
+		suite, found := suitesByClass[test.ClassName]
+		if !found {
+			suite = &junitTestSuite{Name: test.ClassName}
+			suitesByClass[test.ClassName] = suite
+			classNames = append(classNames, test.ClassName)
+		}
+		testCase := junitTestCase{
+			Name:      test.MethodName,
+			ClassName: test.ClassName,
+			Time:      junitTime(test.Time),
+		}
+		if !test.Passed {
+			testCase.Failure = &junitFailure{Message: test.Message, Body: test.StackTrace}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.time += test.Time
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	sort.Strings(classNames)
+
+	suites := junitTestSuites{Name: "force"}
+	var totalTime float64
+	for _, className := range classNames {
+		suite := suitesByClass[className]
+		suite.Time = junitTime(suite.time)
+		totalTime += suite.time
+		suites.Suites = append(suites.Suites, *suite)
+	}
+
+	if len(report.ComponentFailures) > 0 {
+		suite := junitTestSuite{Name: "Deploy", Time: junitTime(0)}
+		for _, problem := range report.ComponentFailures {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      problem.Name,
+				ClassName: problem.Type,
+				Time:      junitTime(0),
+				File:      problem.File,
+				Line:      problem.Line,
+				Failure: &junitFailure{
+					Message: problem.Problem,
+					Type:    problem.ProblemType,
+					Body:    fmt.Sprintf("%s, line %d: %s", problem.File, problem.Line, problem.Problem),
+				},
+			})
+		}
+		suite.Tests = len(suite.Cases)
+		suite.Failures = len(suite.Cases)
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if len(report.CoverageWarnings) > 0 {
+		suite := junitTestSuite{Name: "CodeCoverage", Time: junitTime(0)}
+		for _, warning := range report.CoverageWarnings {
+			name := warning.Name
+			if name == "" {
+				name = "Organization"
+			}
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      name,
+				ClassName: "CodeCoverage",
+				Time:      junitTime(0),
+				Failure:   &junitFailure{Message: warning.Message, Type: "CoverageWarning"},
+			})
+		}
+		suite.Tests = len(suite.Cases)
+		suite.Failures = len(suite.Cases)
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	for _, suite := range suites.Suites {
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+	}
+	suites.Time = junitTime(totalTime)
+
+	out, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// Returns the file a report should be written to, defaulting to
+// test-results.xml or test-results.json depending on the format.
+func ReportFileName(format string, file string) string {
+	if file != "" {
+		return file
+	}
+	if strings.ToLower(format) == "json" {
+		return "test-results.json"
+	}
+	return "test-results.xml"
+}
+
+func ValidateReportFormat(format string) (err error) {
+	switch strings.ToLower(format) {
+	case "", "junit", "json":
+	default:
+		err = fmt.Errorf("Unknown reporter %q; use junit or json", format)
+	}
+	return
+}
+
+// Write the report in the given format (junit or json) to file, or to the
+// default report file if file is empty.
+func (report ResultReport) Write(format string, file string) (err error) {
+	var data []byte
+	switch strings.ToLower(format) {
+	case "junit":
+		data, err = report.JUnit()
+	case "json":
+		data, err = report.JSON()
+	default:
+		err = ValidateReportFormat(format)
+	}
+	if err != nil {
+		return
+	}
+	file = ReportFileName(format, file)
+	if err = ioutil.WriteFile(file, data, 0644); err != nil {
+		return
+	}
+	fmt.Printf("Wrote %s report to %s\n", strings.ToLower(format), file)
+	return
+}
@@ -0,0 +1,117 @@
+package lib_test
+
+import (
+	"encoding/json"
+
+	. "github.com/ForceCLI/force/error"
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Report", func() {
+	var result ForceCheckDeploymentStatusResult
+
+	BeforeEach(func() {
+		result = ForceCheckDeploymentStatusResult{Success: false, Status: "Failed"}
+		result.Details.RunTestResult.TestSuccesses = []TestSuccess{
+			{Name: "MyTest", MethodName: "passes", Time: 1500},
+		}
+		result.Details.RunTestResult.TestFailures = []TestFailure{
+			{Name: "MyTest", MethodName: "fails", Message: "Assertion Failed", StackTrace: "Class.MyTest.fails: line 7", Time: 250},
+		}
+	})
+
+	Describe("NewDeployReport", func() {
+		It("should use local paths for component failures", func() {
+			result.Details.ComponentFailures = []ComponentFailure{
+				{FullName: "MyClass", ComponentType: "ApexClass", FileName: "classes/MyClass.cls", LineNumber: 12, Problem: "Unexpected token"},
+			}
+			report := NewDeployReport(result, map[string]string{"MyClass": "src/classes/MyClass.cls"})
+			Expect(report.ComponentFailures).To(HaveLen(1))
+			Expect(report.ComponentFailures[0].File).To(Equal("src/classes/MyClass.cls"))
+			Expect(report.ComponentFailures[0].Line).To(Equal(12))
+		})
+	})
+
+	Describe("ExitCode", func() {
+		It("should prefer component failures", func() {
+			result.Details.ComponentFailures = []ComponentFailure{{FullName: "MyClass", Problem: "Unexpected token"}}
+			Expect(NewDeployReport(result, nil).ExitCode()).To(Equal(ExitCodeComponentFailures))
+		})
+		It("should report test failures", func() {
+			Expect(NewDeployReport(result, nil).ExitCode()).To(Equal(ExitCodeTestFailures))
+		})
+		It("should report coverage warnings on failed deploys", func() {
+			result.Details.RunTestResult.TestFailures = nil
+			result.Details.RunTestResult.CodeCoverageWarnings = []CodeCoverageWarning{{Message: "Average test coverage across all Apex Classes and Triggers is 60%"}}
+			Expect(NewDeployReport(result, nil).ExitCode()).To(Equal(ExitCodeCoverageWarnings))
+		})
+		It("should return 0 on success", func() {
+			Expect(NewTestReport(TestCoverage{SClassNames: []string{"MyTest"}, SMethodNames: []string{"passes"}}).ExitCode()).To(Equal(0))
+		})
+		It("should not fail test runs with coverage warnings", func() {
+			report := NewTestReport(TestCoverage{
+				SClassNames:  []string{"MyTest"},
+				SMethodNames: []string{"passes"},
+				CoverageWarnings: []CodeCoverageWarning{
+					{Message: "Average test coverage across all Apex Classes and Triggers is 60%"},
+					{Name: "MyClass", Message: "Test coverage of selected Apex Class is 0%"},
+				},
+			})
+			Expect(report.ExitCode()).To(Equal(0))
+			Expect(report.CoverageWarnings).To(Equal([]ReportCoverageWarning{
+				{Message: "Average test coverage across all Apex Classes and Triggers is 60%"},
+				{Name: "MyClass", Message: "Test coverage of selected Apex Class is 0%"},
+			}))
+		})
+	})
+
+	Describe("JUnit", func() {
+		It("should group tests by class with times in seconds", func() {
+			out, err := NewDeployReport(result, nil).JUnit()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(out)).To(ContainSubstring(`<testsuite name="MyTest" tests="2" failures="1" time="1.750">`))
+			Expect(string(out)).To(ContainSubstring(`<testcase name="passes" classname="MyTest" time="1.500">`))
+			Expect(string(out)).To(ContainSubstring(`<failure message="Assertion Failed">Class.MyTest.fails: line 7</failure>`))
+		})
+		It("should report component failures with file and line", func() {
+			result.Details.ComponentFailures = []ComponentFailure{
+				{FullName: "MyClass", ComponentType: "ApexClass", FileName: "classes/MyClass.cls", LineNumber: 12, Problem: "Unexpected token"},
+			}
+			out, _ := NewDeployReport(result, nil).JUnit()
+			Expect(string(out)).To(ContainSubstring(`file="classes/MyClass.cls" line="12"`))
+		})
+	})
+
+	Describe("NewTestReport", func() {
+		It("should tolerate results missing class names, messages and stack traces", func() {
+			report := NewTestReport(TestCoverage{
+				SMethodNames: []string{"passes"},
+				FClassNames:  []string{"MyTest"},
+				FMethodNames: []string{"fails", "fails too"},
+				FMessage:     []string{"Assertion Failed"},
+			})
+			Expect(report.Tests).To(HaveLen(3))
+			Expect(report.Tests[2].ClassName).To(Equal(""))
+			Expect(report.Tests[2].Message).To(Equal(""))
+		})
+	})
+
+	Describe("JSON", func() {
+		It("should include test results", func() {
+			out, err := NewTestReport(TestCoverage{
+				FClassNames:  []string{"MyTest"},
+				FMethodNames: []string{"fails"},
+				FMessage:     []string{"Assertion Failed"},
+				FStackTrace:  []string{"Class.MyTest.fails: line 7"},
+			}).JSON()
+			Expect(err).ToNot(HaveOccurred())
+			var report ResultReport
+			Expect(json.Unmarshal(out, &report)).To(Succeed())
+			Expect(report.Success).To(BeFalse())
+			Expect(report.Tests[0].StackTrace).To(Equal("Class.MyTest.fails: line 7"))
+		})
+	})
+})
@@ -0,0 +1,493 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Retrieves are limited to 10,000 files and a 39 MB zip, so large queries
+// are retrieved in chunks of at most this estimated number of files.
+const DefaultRetrieveChunkSize = 5000
+
+// The number of chunks retrieved at once.
+const DefaultRetrieveConcurrency = 3
+
+// Estimated number of files of a wildcard member.
+const wildcardWeight = 500
+
+// Types whose files are large, weighted by their estimated size relative to
+// a typical file.
+var heavyTypes = map[string]int{
+	"ContentAsset":   20,
+	"Document":       20,
+	"StaticResource": 50,
+}
+
+func (fm *ForceMetadata) retrieveChunkSize() int {
+	if fm.RetrieveChunkSize > 0 {
+		return fm.RetrieveChunkSize
+	}
+	return DefaultRetrieveChunkSize
+}
+
+func (fm *ForceMetadata) retrieveConcurrency() int {
+	if fm.RetrieveConcurrency > 0 {
+		return fm.RetrieveConcurrency
+	}
+	return DefaultRetrieveConcurrency
+}
+
+// Returns the estimated number of files of a member, weighted by size.
+func memberWeight(typeName, member string) int {
+	if member == "*" {
+		return wildcardWeight
+	}
+	weight := 1
+	if t, found := FindMetadataType(loadedMetadataTypes(), typeName); found {
+		if t.MetaFile {
+			weight = 2
+		}
+		if t.IsBundle() {
+			weight = 5
+		}
+	}
+	if heavy, found := heavyTypes[typeName]; found {
+		weight *= heavy
+	}
+	return weight
+}
+
+// Types whose files only have the parts that relate to the other members
+// retrieved with them, such as a profile's permissions, by the types they
+// relate to.
+var relatedContentTypes = map[string][]string{
+	"Profile":       profileRelatedTypes(),
+	"PermissionSet": profileRelatedTypes(),
+	"Translations":  {"CustomApplication", "CustomLabels", "CustomPageWebLink", "CustomTab", "Flow", "QuickAction", "ReportType", "Scontrol"},
+}
+
+func profileRelatedTypes() (types []string) {
+	seen := make(map[string]bool)
+	for _, elementTypes := range profileElementTypes {
+		for _, t := range elementTypes {
+			if !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	sort.Strings(types)
+	return
+}
+
+// Split the query into the elements of types with related content and the
+// rest.
+func splitRelatedContent(query ForceMetadataQuery) (related, rest ForceMetadataQuery) {
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			e := ForceMetadataQueryElement{Name: []string{typeName}, Members: element.Members}
+			if _, found := relatedContentTypes[typeName]; found {
+				related = append(related, e)
+			} else {
+				rest = append(rest, e)
+			}
+		}
+	}
+	return
+}
+
+func queryWeight(query ForceMetadataQuery) (weight int) {
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			for _, member := range element.Members {
+				weight += memberWeight(typeName, member)
+			}
+		}
+	}
+	return
+}
+
+// Split the query into chunks of at most maxWeight estimated files, keeping
+// the members of each type in order. A member heavier than maxWeight gets
+// a chunk of its own. Types with related content, such as profiles, are
+// split into batches of at most half a chunk, and each batch is retrieved
+// with each batch of the members of the types they relate to, so that
+// their files are complete.
+func ChunkQuery(query ForceMetadataQuery, maxWeight int) (chunks []ForceMetadataQuery) {
+	related, rest := splitRelatedContent(query)
+	if len(related) == 0 || queryWeight(query) <= maxWeight {
+		return chunkByWeight(query, maxWeight)
+	}
+	relatedTypes := make(map[string]bool)
+	for _, element := range related {
+		for _, t := range relatedContentTypes[element.Name[0]] {
+			relatedTypes[t] = true
+		}
+	}
+	var relatedMembers, others ForceMetadataQuery
+	for _, element := range rest {
+		if relatedTypes[element.Name[0]] {
+			relatedMembers = append(relatedMembers, element)
+		} else {
+			others = append(others, element)
+		}
+	}
+	chunks = chunkByWeight(others, maxWeight)
+
+	batchWeight := queryWeight(related)
+	if batchWeight > maxWeight/2 {
+		batchWeight = maxWeight / 2
+	}
+	if batchWeight < 1 {
+		batchWeight = 1
+	}
+	memberChunks := chunkByWeight(relatedMembers, maxWeight-batchWeight)
+	for _, batch := range chunkByWeight(related, batchWeight) {
+		if len(memberChunks) == 0 {
+			chunks = append(chunks, batch)
+		}
+		for _, members := range memberChunks {
+			chunk := append(ForceMetadataQuery{}, batch...)
+			chunks = append(chunks, append(chunk, members...))
+		}
+	}
+	return
+}
+
+func chunkByWeight(query ForceMetadataQuery, maxWeight int) (chunks []ForceMetadataQuery) {
+	var chunk ForceMetadataQuery
+	weight := 0
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			var members []string
+			for _, member := range element.Members {
+				memberWeight := memberWeight(typeName, member)
+				if weight+memberWeight > maxWeight && weight > 0 {
+					if len(members) > 0 {
+						chunk = append(chunk, ForceMetadataQueryElement{Name: []string{typeName}, Members: members})
+						members = nil
+					}
+					chunks = append(chunks, chunk)
+					chunk = nil
+					weight = 0
+				}
+				members = append(members, member)
+				weight += memberWeight
+			}
+			if len(members) > 0 {
+				chunk = append(chunk, ForceMetadataQueryElement{Name: []string{typeName}, Members: members})
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return
+}
+
+// Split a chunk in two halves by weight, or return false if it has a
+// single member. The members of types with related content are kept in
+// both halves until the rest of the chunk can't be split any further.
+func splitChunk(chunk ForceMetadataQuery) (first, second ForceMetadataQuery, ok bool) {
+	related, rest := splitRelatedContent(chunk)
+	if len(related) == 0 {
+		return splitByWeight(chunk)
+	}
+	if first, second, ok = splitByWeight(rest); ok {
+		first = append(append(ForceMetadataQuery{}, related...), first...)
+		second = append(append(ForceMetadataQuery{}, related...), second...)
+		return
+	}
+	if first, second, ok = splitByWeight(related); ok {
+		first = append(first, rest...)
+		second = append(second, rest...)
+	}
+	return
+}
+
+func splitByWeight(chunk ForceMetadataQuery) (first, second ForceMetadataQuery, ok bool) {
+	weight := queryWeight(chunk)
+	if weight <= 1 {
+		return nil, nil, false
+	}
+	halves := chunkByWeight(chunk, (weight+1)/2)
+	if len(halves) < 2 {
+		return nil, nil, false
+	}
+	first = halves[0]
+	for _, half := range halves[1:] {
+		second = append(second, half...)
+	}
+	return first, second, true
+}
+
+// Receives the files of a retrieve as they're unzipped.
+type retrieveSink interface {
+	add(name string, r io.Reader) error
+}
+
+// Collects retrieved files in memory, merging those retrieved by several
+// chunks.
+type memorySink ForceMetadataFiles
+
+func (s memorySink) add(name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if existing, found := s[name]; found {
+		data = mergeRetrievedFile(existing, data)
+	}
+	s[name] = data
+	return nil
+}
+
+// Writes retrieved files under a directory as they're unzipped. Files
+// retrieved by several chunks are merged with the copy written by the
+// earlier chunk; files already in the directory are replaced.
+type dirSink struct {
+	dir     string
+	skip    func(path string) bool
+	written map[string]bool
+}
+
+func newDirSink(dir string, skip func(path string) bool) *dirSink {
+	return &dirSink{dir: dir, skip: skip, written: make(map[string]bool)}
+}
+
+func (s *dirSink) add(name string, r io.Reader) (err error) {
+	path := filepath.Join(s.dir, name)
+	if s.skip != nil && s.skip(path) {
+		return nil
+	}
+	if s.written[name] {
+		var existing, data []byte
+		if existing, err = ioutil.ReadFile(path); err != nil {
+			return
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+		return ioutil.WriteFile(path, mergeRetrievedFile(existing, data), 0644)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err = io.Copy(f, r); err != nil {
+		return
+	}
+	s.written[name] = true
+	return
+}
+
+// Passes the files of concurrently retrieved chunks to a sink one at a
+// time, collecting the members of their package.xml files.
+type chunkSink struct {
+	sink retrieveSink
+	mu   sync.Mutex
+	pb   PackageBuilder
+}
+
+func (s *chunkSink) add(name string, r io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "package.xml" {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		addPackageMembers(&s.pb, data)
+		return nil
+	}
+	return s.sink.add(name, r)
+}
+
+// Retrieve the chunks concurrently and merge their results.
+func (fm *ForceMetadata) retrieveChunks(chunks []ForceMetadataQuery) (files ForceMetadataFiles, problems []string, err error) {
+	files = make(ForceMetadataFiles)
+	if problems, err = fm.retrieveChunksTo(chunks, memorySink(files)); err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// Retrieve the chunks concurrently into the sink, then retry the failed
+// chunks one at a time, splitting those that fail again. A package.xml
+// listing the members of all of them is added last.
+func (fm *ForceMetadata) retrieveChunksTo(chunks []ForceMetadataQuery, sink retrieveSink) (problems []string, err error) {
+	fmt.Printf("Retrieving in %d chunks...\n", len(chunks))
+	merged := &chunkSink{sink: sink, pb: NewFetchBuilder()}
+	chunkProblems := make([][]string, len(chunks))
+	chunkProperties := make([][]MDFileProperties, len(chunks))
+	errs := make([]error, len(chunks))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < fm.retrieveConcurrency(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				chunkProblems[i], chunkProperties[i], errs[i] = fm.retrieveQueryTo(chunks[i], merged)
+				if errs[i] == nil {
+					fmt.Printf("Retrieved chunk %d of %d\n", i+1, len(chunks))
+				}
+			}
+		}()
+	}
+	for i := range chunks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, chunkErr := range errs {
+		if chunkErr == nil {
+			continue
+		}
+		fmt.Printf("Chunk %d of %d failed (%s); retrying\n", i+1, len(chunks), chunkErr.Error())
+		if chunkProblems[i], chunkProperties[i], err = fm.retryChunk(chunks[i], merged); err != nil {
+			return
+		}
+	}
+
+	var properties []MDFileProperties
+	for i := range chunks {
+		problems = append(problems, chunkProblems[i]...)
+		properties = append(properties, chunkProperties[i]...)
+	}
+	fm.RetrievedFileProperties = properties
+	err = sink.add("package.xml", bytes.NewReader(merged.pb.PackageXml()))
+	return
+}
+
+// Retrieve a chunk that failed on its own, splitting it in two if it fails
+// again, e.g. because it's over the size limit.
+func (fm *ForceMetadata) retryChunk(chunk ForceMetadataQuery, sink retrieveSink) (problems []string, properties []MDFileProperties, err error) {
+	if problems, properties, err = fm.retrieveQueryTo(chunk, sink); err == nil {
+		return
+	}
+	first, second, ok := splitChunk(chunk)
+	if !ok {
+		return nil, nil, err
+	}
+	fmt.Printf("Retry failed (%s); retrying in two halves\n", err.Error())
+	firstProblems, firstProperties, err := fm.retryChunk(first, sink)
+	if err != nil {
+		return
+	}
+	secondProblems, secondProperties, err := fm.retryChunk(second, sink)
+	if err != nil {
+		return
+	}
+	return append(firstProblems, secondProblems...), append(firstProperties, secondProperties...), nil
+}
+
+func addPackageMembers(pb *PackageBuilder, packageXml []byte) {
+	var pkg Package
+	if xml.Unmarshal(packageXml, &pkg) != nil {
+		return
+	}
+	for _, t := range pkg.Types {
+		for _, member := range t.Members {
+			pb.AddMetaToPackage(t.Name, member)
+		}
+	}
+}
+
+// Merge a file retrieved by two chunks. Retrieving child types, such as
+// fields, returns their parent's file with only those children, so the
+// top-level elements of XML files are combined. Otherwise the larger file
+// is kept.
+func mergeRetrievedFile(a, b []byte) []byte {
+	if len(b) > len(a) {
+		a, b = b, a
+	}
+	if merged, err := mergeXmlChildren(a, b); err == nil {
+		return merged
+	}
+	return a
+}
+
+// Returns a with the top-level elements of b that a doesn't have added
+// before its closing tag.
+func mergeXmlChildren(a, b []byte) (merged []byte, err error) {
+	aChildren, aEnd, err := xmlTopLevelChildren(a)
+	if err != nil {
+		return
+	}
+	bChildren, _, err := xmlTopLevelChildren(b)
+	if err != nil {
+		return
+	}
+	present := make(map[string]bool)
+	for _, child := range aChildren {
+		present[child] = true
+	}
+	var added bytes.Buffer
+	for _, child := range bChildren {
+		if !present[child] {
+			present[child] = true
+			added.WriteString("    " + child + "\n")
+		}
+	}
+	if added.Len() == 0 {
+		return a, nil
+	}
+	merged = append(merged, a[:aEnd]...)
+	if !bytes.HasSuffix(merged, []byte("\n")) {
+		merged = append(merged, '\n')
+	}
+	merged = append(merged, added.Bytes()...)
+	merged = append(merged, a[aEnd:]...)
+	return
+}
+
+// Returns the top-level elements of an XML document, as text, and the
+// offset of the root element's closing tag.
+func xmlTopLevelChildren(data []byte) (children []string, rootEnd int, err error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	childStart := 0
+	for {
+		offset := int(decoder.InputOffset())
+		token, tokenErr := decoder.RawToken()
+		if tokenErr == io.EOF {
+			break
+		}
+		if tokenErr != nil {
+			return nil, 0, tokenErr
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				childStart = offset
+			}
+		case xml.EndElement:
+			depth--
+			switch depth {
+			case 1:
+				children = append(children, strings.TrimSpace(string(data[childStart:decoder.InputOffset()])))
+			case 0:
+				rootEnd = offset
+			}
+		}
+	}
+	if rootEnd == 0 {
+		err = fmt.Errorf("no root element")
+	}
+	return
+}
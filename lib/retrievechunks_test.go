@@ -0,0 +1,256 @@
+package lib_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChunkQuery", func() {
+	It("should keep small queries in one chunk", func() {
+		query := ForceMetadataQuery{
+			{Name: []string{"ApexClass"}, Members: []string{"A", "B"}},
+			{Name: []string{"ApexPage"}, Members: []string{"C"}},
+		}
+		Expect(ChunkQuery(query, 10)).To(Equal([]ForceMetadataQuery{query}))
+	})
+
+	It("should split members across chunks in order", func() {
+		query := ForceMetadataQuery{
+			{Name: []string{"CustomLabels"}, Members: []string{"A", "B", "C"}},
+			{Name: []string{"Group"}, Members: []string{"D", "E"}},
+		}
+		Expect(ChunkQuery(query, 2)).To(Equal([]ForceMetadataQuery{
+			{{Name: []string{"CustomLabels"}, Members: []string{"A", "B"}}},
+			{{Name: []string{"CustomLabels"}, Members: []string{"C"}}, {Name: []string{"Group"}, Members: []string{"D"}}},
+			{{Name: []string{"Group"}, Members: []string{"E"}}},
+		}))
+	})
+
+	It("should give wildcards a chunk of their own", func() {
+		query := ForceMetadataQuery{
+			{Name: []string{"CustomLabels"}, Members: []string{"A"}},
+			{Name: []string{"Group"}, Members: []string{"*"}},
+			{Name: []string{"Queue"}, Members: []string{"B"}},
+		}
+		Expect(ChunkQuery(query, 100)).To(Equal([]ForceMetadataQuery{
+			{{Name: []string{"CustomLabels"}, Members: []string{"A"}}},
+			{{Name: []string{"Group"}, Members: []string{"*"}}},
+			{{Name: []string{"Queue"}, Members: []string{"B"}}},
+		}))
+	})
+
+	It("should keep profiles in a chunk with the types they relate to", func() {
+		query := ForceMetadataQuery{
+			{Name: []string{"CustomTab"}, Members: []string{"A", "B"}},
+			{Name: []string{"Group"}, Members: []string{"C", "D"}},
+			{Name: []string{"Profile"}, Members: []string{"Admin"}},
+		}
+		Expect(ChunkQuery(query, 2)).To(Equal([]ForceMetadataQuery{
+			{{Name: []string{"Group"}, Members: []string{"C", "D"}}},
+			{
+				{Name: []string{"Profile"}, Members: []string{"Admin"}},
+				{Name: []string{"CustomTab"}, Members: []string{"A"}},
+			},
+			{
+				{Name: []string{"Profile"}, Members: []string{"Admin"}},
+				{Name: []string{"CustomTab"}, Members: []string{"B"}},
+			},
+		}))
+	})
+
+	It("should keep every chunk of an export under the limit", func() {
+		members := func(prefix string, n int) (names []string) {
+			for i := 0; i < n; i++ {
+				names = append(names, fmt.Sprintf("%s%d", prefix, i))
+			}
+			return
+		}
+		query := ForceMetadataQuery{
+			{Name: []string{"ApexClass"}, Members: members("Class", 4000)},
+			{Name: []string{"CustomObject"}, Members: members("Object", 3000)},
+			{Name: []string{"EmailTemplate"}, Members: members("Template", 2000)},
+			{Name: []string{"PermissionSet"}, Members: members("PermSet", 200)},
+			{Name: []string{"Profile"}, Members: members("Profile", 300)},
+		}
+		chunks := ChunkQuery(query, 5000)
+		relatedCount := make(map[string]int)
+		for _, chunk := range chunks {
+			size := 0
+			var profiles []string
+			related := 0
+			for _, element := range chunk {
+				size += len(element.Members)
+				switch element.Name[0] {
+				case "PermissionSet", "Profile":
+					profiles = append(profiles, element.Members...)
+				case "ApexClass", "CustomObject":
+					related += len(element.Members)
+				}
+			}
+			Expect(size).To(BeNumerically("<=", 5000))
+			if len(profiles) == 0 {
+				Expect(related).To(BeZero())
+			}
+			for _, profile := range profiles {
+				relatedCount[profile] += related
+			}
+		}
+		Expect(relatedCount).To(HaveLen(500))
+		for _, count := range relatedCount {
+			Expect(count).To(Equal(7000))
+		}
+	})
+})
+
+var _ = Describe("Retrieve in chunks", func() {
+	var org *fakeOrg
+
+	objectWithFields := func(fields ...string) []byte {
+		var xml strings.Builder
+		xml.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+		xml.WriteString(`<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">` + "\n")
+		for _, field := range fields {
+			fmt.Fprintf(&xml, "    <fields>\n        <fullName>%s</fullName>\n    </fields>\n", field)
+		}
+		xml.WriteString("</CustomObject>\n")
+		return []byte(xml.String())
+	}
+
+	// Retrieves fail with more than one member, as if they were too large
+	memberLimit := func(query ForceMetadataQuery) (files ForceMetadataFiles, err error) {
+		var fields []string
+		for _, element := range query {
+			fields = append(fields, element.Members...)
+		}
+		if len(fields) > 1 {
+			return nil, errors.New("LIMIT_EXCEEDED")
+		}
+		for i := range fields {
+			fields[i] = strings.TrimPrefix(fields[i], "Book__c.")
+		}
+		return ForceMetadataFiles{"objects/Book__c.object": objectWithFields(fields...)}, nil
+	}
+
+	BeforeEach(func() {
+		org = newFakeOrg()
+	})
+
+	AfterEach(func() {
+		org.Close()
+	})
+
+	It("should retry failed chunks in halves and merge their files", func() {
+		org.retrieve = memberLimit
+		force := org.force()
+		force.Metadata.RetrieveChunkSize = 2
+		query := ForceMetadataQuery{{Name: []string{"CustomField"}, Members: []string{"Book__c.A__c", "Book__c.B__c", "Book__c.C__c"}}}
+		files, _, err := force.Metadata.Retrieve(query)
+		Expect(err).ToNot(HaveOccurred())
+		object := string(files["objects/Book__c.object"])
+		for _, field := range []string{"A__c", "B__c", "C__c"} {
+			Expect(strings.Count(object, "<fullName>"+field+"</fullName>")).To(Equal(1))
+		}
+		Expect(object).To(HaveSuffix("</CustomObject>\n"))
+		Expect(string(files["package.xml"])).To(ContainSubstring("<members>Book__c.C__c</members>"))
+	})
+
+	It("should write chunks to a directory, merging files retrieved by several", func() {
+		org.retrieve = memberLimit
+		force := org.force()
+		force.Metadata.RetrieveChunkSize = 2
+		dir, _ := ioutil.TempDir("", "force-retrieve")
+		defer os.RemoveAll(dir)
+		objectPath := filepath.Join(dir, "objects", "Book__c.object")
+		os.MkdirAll(filepath.Dir(objectPath), 0755)
+		Expect(ioutil.WriteFile(objectPath, objectWithFields("Stale__c"), 0644)).To(Succeed())
+		query := ForceMetadataQuery{{Name: []string{"CustomField"}, Members: []string{"Book__c.A__c", "Book__c.B__c", "Book__c.C__c"}}}
+		_, err := force.Metadata.RetrieveToDir(query, dir, nil)
+		Expect(err).ToNot(HaveOccurred())
+		object, _ := ioutil.ReadFile(objectPath)
+		for _, field := range []string{"A__c", "B__c", "C__c"} {
+			Expect(strings.Count(string(object), "<fullName>"+field+"</fullName>")).To(Equal(1))
+		}
+		Expect(string(object)).ToNot(ContainSubstring("Stale__c"))
+		packageXml, _ := ioutil.ReadFile(filepath.Join(dir, "package.xml"))
+		Expect(string(packageXml)).To(ContainSubstring("<members>Book__c.C__c</members>"))
+	})
+
+	It("should not write skipped files to the directory", func() {
+		org.retrieve = memberLimit
+		force := org.force()
+		dir, _ := ioutil.TempDir("", "force-retrieve")
+		defer os.RemoveAll(dir)
+		skip := func(path string) bool {
+			return filepath.Ext(path) == ".object"
+		}
+		query := ForceMetadataQuery{{Name: []string{"CustomField"}, Members: []string{"Book__c.A__c"}}}
+		_, err := force.Metadata.RetrieveToDir(query, dir, skip)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filepath.Join(dir, "objects", "Book__c.object")).ToNot(BeAnExistingFile())
+		Expect(filepath.Join(dir, "package.xml")).To(BeAnExistingFile())
+	})
+
+	It("should keep profiles in both halves of a failed chunk", func() {
+		org.retrieve = func(query ForceMetadataQuery) (ForceMetadataFiles, error) {
+			members := 0
+			for _, element := range query {
+				members += len(element.Members)
+			}
+			if members > 2 {
+				return nil, errors.New("LIMIT_EXCEEDED")
+			}
+			return ForceMetadataFiles{}, nil
+		}
+		force := org.force()
+		force.Metadata.RetrieveChunkSize = 4
+		_, _, err := force.Metadata.Retrieve(ForceMetadataQuery{
+			{Name: []string{"Group"}, Members: []string{"C", "D"}},
+			{Name: []string{"CustomTab"}, Members: []string{"S", "T"}},
+			{Name: []string{"Profile"}, Members: []string{"Admin"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(org.retrieved).To(ContainElement(ForceMetadataQuery{
+			{Name: []string{"Profile"}, Members: []string{"Admin"}},
+			{Name: []string{"CustomTab"}, Members: []string{"S"}},
+		}))
+		Expect(org.retrieved).To(ContainElement(ForceMetadataQuery{
+			{Name: []string{"Profile"}, Members: []string{"Admin"}},
+			{Name: []string{"CustomTab"}, Members: []string{"T"}},
+		}))
+	})
+
+	It("should not split a chunk of one profile and one member", func() {
+		org.retrieve = func(query ForceMetadataQuery) (ForceMetadataFiles, error) {
+			for _, element := range query {
+				if element.Name[0] == "Profile" {
+					return nil, errors.New("LIMIT_EXCEEDED")
+				}
+			}
+			return ForceMetadataFiles{}, nil
+		}
+		force := org.force()
+		force.Metadata.RetrieveChunkSize = 2
+		_, _, err := force.Metadata.Retrieve(ForceMetadataQuery{
+			{Name: []string{"Group"}, Members: []string{"C", "D"}},
+			{Name: []string{"CustomTab"}, Members: []string{"T"}},
+			{Name: []string{"Profile"}, Members: []string{"Admin"}},
+		})
+		Expect(err).To(MatchError("LIMIT_EXCEEDED"))
+		for _, retrieved := range org.retrieved {
+			for _, element := range retrieved {
+				if element.Name[0] == "Profile" {
+					Expect(retrieved).To(ContainElement(ForceMetadataQueryElement{Name: []string{"CustomTab"}, Members: []string{"T"}}))
+				}
+			}
+		}
+	})
+})
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/ForceCLI/force/error"
+)
+
+// Returns a package that restores the org to the state of the files
+// retrieved from it before deploying the outgoing files of the members in
+// the query: the org's versions of the members that the deploy changes, and
+// a destructiveChanges.xml listing the members that the deploy creates. Both
+// are at the granularity of the query, so pushing a field restores or
+// deletes just the field, not its object.
+func RollbackPackage(outgoing, org ForceMetadataFiles, query ForceMetadataQuery) (files ForceMetadataFiles, comparison MetadataComparison) {
+	deployed := make(ForceMetadataFiles)
+	for name, data := range outgoing {
+		name = filepath.ToSlash(name)
+		// Only files in type directories are members
+		if strings.Contains(name, "/") {
+			deployed[name] = data
+		}
+	}
+	comparison = compareMetadataMembers(deployed, org, query).only(query)
+	files = comparison.DeployFiles(org)
+	return
+}
+
+// Retrieve the current versions of the members in the query and write a
+// package to dir that rolls back a deploy of the outgoing files.
+func (f *Force) WriteRollbackSnapshot(outgoing ForceMetadataFiles, query ForceMetadataQuery, dir string) (err error) {
+	if entries, readErr := ioutil.ReadDir(dir); readErr == nil && len(entries) > 0 {
+		return fmt.Errorf("%s already exists and is not empty", dir)
+	}
+	fmt.Println("Retrieving current versions for the rollback snapshot...")
+	org, problems, err := f.Metadata.Retrieve(query)
+	if err != nil {
+		return
+	}
+	// Members that don't exist yet are reported as problems
+	if Verbose {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+	}
+	files, comparison := RollbackPackage(outgoing, org, query)
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return
+		}
+		if err = ioutil.WriteFile(file, data, 0644); err != nil {
+			return
+		}
+	}
+	fmt.Printf("Wrote rollback snapshot to %s: %d to restore, %d to delete\n", dir, len(comparison.Modified)+len(comparison.Added), len(comparison.Removed))
+	return
+}
+
+// Deploy the rollback package written by push -snapshot.
+func DeployRollbackSnapshot(dir string, opts *ForceDeployOptions) {
+	if _, err := os.Stat(filepath.Join(dir, "package.xml")); err != nil {
+		ErrorAndExit("%s is not a rollback snapshot: %s", dir, err.Error())
+	}
+	files := make(ForceMetadataFiles)
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !f.Mode().IsRegular() || f.Name() == ".DS_Store" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		ErrorAndExit(err.Error())
+	}
+	fmt.Println("Rolling back now...")
+	deployFiles(files, true, make(map[string]string), opts)
+}
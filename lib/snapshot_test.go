@@ -0,0 +1,104 @@
+package lib_test
+
+import (
+	"encoding/xml"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RollbackPackage", func() {
+	It("should restore changed members and delete created ones", func() {
+		outgoing := ForceMetadataFiles{
+			"package.xml":              []byte("<Package/>"),
+			"classes/Same.cls":         []byte("public class Same {}"),
+			"classes/Changed.cls":      []byte("public class Changed { Integer i; }"),
+			"classes/New.cls":          []byte("public class New {}"),
+			"classes/New.cls-meta.xml": []byte("<ApexClass/>"),
+		}
+		org := ForceMetadataFiles{
+			"package.xml":         []byte("<Package/>"),
+			"classes/Same.cls":    []byte("public class Same {}"),
+			"classes/Changed.cls": []byte("public class Changed {}"),
+		}
+		query := ForceMetadataQuery{{Name: []string{"ApexClass"}, Members: []string{"Changed", "New", "Same"}}}
+		files, comparison := RollbackPackage(outgoing, org, query)
+		Expect(comparison.Modified).To(Equal([]MetadataMember{{Type: "ApexClass", Name: "Changed"}}))
+		Expect(comparison.Removed).To(Equal([]MetadataMember{{Type: "ApexClass", Name: "New"}}))
+		Expect(files).To(HaveKey("package.xml"))
+		Expect(files).To(HaveKeyWithValue("classes/Changed.cls", []byte("public class Changed {}")))
+		Expect(files).ToNot(HaveKey("classes/Same.cls"))
+		Expect(files).ToNot(HaveKey("classes/New.cls"))
+
+		var destructive Package
+		Expect(xml.Unmarshal(files["destructiveChanges.xml"], &destructive)).To(Succeed())
+		Expect(destructive.Types).To(Equal([]MetaType{{Name: "ApexClass", Members: []string{"New"}}}))
+	})
+
+	It("should delete a pushed field that's new rather than its object", func() {
+		outgoing := ForceMetadataFiles{
+			"package.xml": []byte("<Package/>"),
+			"objects/Book__c.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>New__c</fullName>
+        <type>Text</type>
+    </fields>
+</CustomObject>
+`),
+		}
+		// Retrieving a field that doesn't exist yet returns an empty object
+		org := ForceMetadataFiles{
+			"package.xml": []byte("<Package/>"),
+			"objects/Book__c.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata"/>
+`),
+		}
+		query := ForceMetadataQuery{{Name: []string{"CustomField"}, Members: []string{"Book__c.New__c"}}}
+		files, comparison := RollbackPackage(outgoing, org, query)
+		Expect(comparison.Modified).To(BeEmpty())
+		Expect(comparison.Removed).To(Equal([]MetadataMember{{Type: "CustomField", Name: "Book__c.New__c"}}))
+		Expect(files).ToNot(HaveKey("objects/Book__c.object"))
+
+		var destructive Package
+		Expect(xml.Unmarshal(files["destructiveChanges.xml"], &destructive)).To(Succeed())
+		Expect(destructive.Types).To(Equal([]MetaType{{Name: "CustomField", Members: []string{"Book__c.New__c"}}}))
+	})
+
+	It("should restore only a pushed field that exists", func() {
+		outgoing := ForceMetadataFiles{
+			"package.xml": []byte("<Package/>"),
+			"objects/Book__c.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>Title__c</fullName>
+        <type>LongTextArea</type>
+    </fields>
+</CustomObject>
+`),
+		}
+		org := ForceMetadataFiles{
+			"package.xml": []byte("<Package/>"),
+			"objects/Book__c.object": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>Title__c</fullName>
+        <type>Text</type>
+    </fields>
+</CustomObject>
+`),
+		}
+		query := ForceMetadataQuery{{Name: []string{"CustomField"}, Members: []string{"Book__c.Title__c"}}}
+		files, comparison := RollbackPackage(outgoing, org, query)
+		Expect(comparison.Modified).To(Equal([]MetadataMember{{Type: "CustomField", Name: "Book__c.Title__c"}}))
+		Expect(comparison.Removed).To(BeEmpty())
+		Expect(files).ToNot(HaveKey("destructiveChanges.xml"))
+		Expect(string(files["objects/Book__c.object"])).To(ContainSubstring("<type>Text</type>"))
+
+		var pkg Package
+		Expect(xml.Unmarshal(files["package.xml"], &pkg)).To(Succeed())
+		Expect(pkg.Types).To(Equal([]MetaType{{Name: "CustomField", Members: []string{"Book__c.Title__c"}}}))
+	})
+})
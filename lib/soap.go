@@ -1,10 +1,13 @@
 package lib
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"strings"
 )
@@ -76,7 +79,15 @@ func (s *Soap) ExecuteLogin(username, password string) (response []byte, err err
 }
 
 func (s *Soap) Execute(action, query string) (response []byte, err error) {
-	soap := `
+	return s.ExecuteStream(action, strings.NewReader(query), int64(len(query)), nil)
+}
+
+// Execute the action with the request streamed from query, which is size
+// bytes long. If zipFile isn't nil, the base64 content of the response's
+// zipFile element is decoded into it as it's received, so that large zips
+// aren't held in memory, and left out of the response.
+func (s *Soap) ExecuteStream(action string, query io.Reader, size int64, zipFile io.Writer) (response []byte, err error) {
+	head := `
 		<env:Envelope xmlns:xsd="http://www.w3.org/2001/XMLSchema" 
 		xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" 
 		xmlns:env="http://schemas.xmlsoap.org/soap/envelope/" 
@@ -90,18 +101,20 @@ func (s *Soap) Execute(action, query string) (response []byte, err error) {
 			</env:Header>
 			<env:Body>
 				<%s xmlns="%s">
-					%s
+					`
+	tail := `
 				</%s>
 			</env:Body>
 		</env:Envelope>
 	`
-	rbody := fmt.Sprintf(soap, s.Namespace,
-		s.AccessToken, s.Header, action, s.Namespace, query, action)
-	//fmt.Println(rbody)
-	req, err := httpRequest("POST", s.Endpoint, strings.NewReader(rbody))
+	head = fmt.Sprintf(head, s.Namespace, s.AccessToken, s.Header, action, s.Namespace)
+	tail = fmt.Sprintf(tail, action)
+	rbody := io.MultiReader(strings.NewReader(head), query, strings.NewReader(tail))
+	req, err := httpRequest("POST", s.Endpoint, rbody)
 	if err != nil {
 		return
 	}
+	req.ContentLength = int64(len(head)) + size + int64(len(tail))
 	req.Header.Add("Content-Type", "text/xml")
 	req.Header.Add("SOAPACtion", action)
 	res, err := doRequest(req)
@@ -113,7 +126,13 @@ func (s *Soap) Execute(action, query string) (response []byte, err error) {
 		err = errors.New("authorization expired, please run `force login`")
 		return
 	}
-	response, err = ioutil.ReadAll(res.Body)
+	if zipFile != nil {
+		rest := new(bytes.Buffer)
+		err = decodeBase64Element(res.Body, "zipFile", rest, zipFile)
+		response = rest.Bytes()
+	} else {
+		response, err = ioutil.ReadAll(res.Body)
+	}
 	if err != nil {
 		return
 	}
@@ -125,6 +144,67 @@ func (s *Soap) Execute(action, query string) (response []byte, err error) {
 	return
 }
 
+// Copy the XML from r to rest, except for the content of the first element
+// named tag, which is decoded from base64 into decoded. The element is left
+// empty in rest.
+func decodeBase64Element(r io.Reader, tag string, rest, decoded io.Writer) (err error) {
+	br := bufio.NewReader(r)
+	open := []byte(tag + ">")
+	for {
+		chunk, readErr := br.ReadSlice('<')
+		if _, err = rest.Write(chunk); err != nil {
+			return
+		}
+		if readErr == bufio.ErrBufferFull {
+			continue
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+		if next, _ := br.Peek(len(open)); bytes.Equal(next, open) {
+			if _, err = br.Discard(len(open)); err != nil {
+				return
+			}
+			if _, err = rest.Write(open); err != nil {
+				return
+			}
+			if _, err = io.Copy(decoded, base64.NewDecoder(base64.StdEncoding, textReader{br})); err != nil {
+				return
+			}
+			_, err = io.Copy(rest, br)
+			return
+		}
+	}
+}
+
+// Reads character data up to the start of the next tag.
+type textReader struct {
+	r *bufio.Reader
+}
+
+func (t textReader) Read(p []byte) (n int, err error) {
+	if _, err = t.r.Peek(1); err != nil {
+		return
+	}
+	size := t.r.Buffered()
+	if size > len(p) {
+		size = len(p)
+	}
+	data, _ := t.r.Peek(size)
+	if i := bytes.IndexByte(data, '<'); i >= 0 {
+		data = data[:i]
+	}
+	if len(data) == 0 {
+		return 0, io.EOF
+	}
+	n = copy(p, data)
+	_, err = t.r.Discard(n)
+	return
+}
+
 func isSoapInvalidSessionError(body []byte) bool {
 	var soapError SoapError
 	xml.Unmarshal(body, &soapError)
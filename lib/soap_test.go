@@ -0,0 +1,58 @@
+package lib_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Soap", func() {
+	Describe("ExecuteStream", func() {
+		var (
+			server      *httptest.Server
+			requestBody string
+			zipData     []byte
+		)
+
+		BeforeEach(func() {
+			zipData = bytes.Repeat([]byte("zip data \x00\xff"), 10000)
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				Expect(r.ContentLength).To(Equal(int64(len(body))))
+				requestBody = string(body)
+				fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><checkRetrieveStatusResponse><result><zipFile>%s</zipFile><messages><problem>Entity cannot be found</problem></messages></result></checkRetrieveStatusResponse></soapenv:Body></soapenv:Envelope>`, base64.StdEncoding.EncodeToString(zipData))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should stream the request and decode the zip file into the writer", func() {
+			query := "<id>09S000000000001</id>"
+			soap := NewSoap(server.URL, "http://soap.sforce.com/2006/04/metadata", "token")
+			zipFile := new(bytes.Buffer)
+			response, err := soap.ExecuteStream("checkRetrieveStatus", strings.NewReader(query), int64(len(query)), zipFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requestBody).To(ContainSubstring(query))
+			Expect(zipFile.Bytes()).To(Equal(zipData))
+			Expect(string(response)).To(ContainSubstring("<zipFile></zipFile>"))
+			Expect(string(response)).To(ContainSubstring("<problem>Entity cannot be found</problem>"))
+		})
+
+		It("should return the whole response without a writer", func() {
+			response, err := NewSoap(server.URL, "", "token").Execute("checkRetrieveStatus", "<id>1</id>")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(response)).To(ContainSubstring(base64.StdEncoding.EncodeToString(zipData)))
+		})
+	})
+})
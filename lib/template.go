@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Templates used by force create. A template is a directory whose files are
+// rendered with text/template and written to the same relative paths in the
+// source directory. File names may use template variables too, e.g.
+// classes/{{.Name}}Test.cls.
+
+type TemplateVars struct {
+	Name       string
+	SObject    string
+	ApiVersion string
+	Author     string
+}
+
+type TemplateFile struct {
+	Path string
+	Body string
+}
+
+type Template struct {
+	Name string
+	// Directory the template was loaded from, or "built-in"
+	Source string
+	Files  []TemplateFile
+	// Built-in templates for Apex and Visualforce are created through the
+	// Tooling API rather than deployed.
+	ToolingType string
+}
+
+var templateFuncs = template.FuncMap{
+	"lowerFirst": func(s string) string {
+		if s == "" {
+			return s
+		}
+		r := []rune(s)
+		r[0] = unicode.ToLower(r[0])
+		return string(r)
+	},
+	"upperFirst": func(s string) string {
+		if s == "" {
+			return s
+		}
+		r := []rune(s)
+		r[0] = unicode.ToUpper(r[0])
+		return string(r)
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+var builtinTemplates = []Template{
+	{
+		Name:        "ApexClass",
+		ToolingType: "ApexClass",
+		Files:       []TemplateFile{{Path: "classes/{{.Name}}.cls", Body: "public with sharing class {{.Name}} {\n\n}"}},
+	},
+	{
+		Name:        "ApexTrigger",
+		ToolingType: "ApexTrigger",
+		Files: []TemplateFile{{Path: "triggers/{{.Name}}.trigger",
+			Body: "trigger {{.Name}} on {{.SObject}} (before insert, after insert, before update, after update, before delete, after delete, after undelete) { \n\n }"}},
+	},
+	{
+		Name:        "ApexPage",
+		ToolingType: "ApexPage",
+		Files:       []TemplateFile{{Path: "pages/{{.Name}}.page", Body: "<apex:page>\n\n</apex:page>"}},
+	},
+	{
+		Name:        "ApexComponent",
+		ToolingType: "ApexComponent",
+		Files:       []TemplateFile{{Path: "components/{{.Name}}.component", Body: "<apex:component>\n\n</apex:component>"}},
+	},
+	{
+		Name: "lwc",
+		Files: []TemplateFile{
+			{Path: "lwc/{{lowerFirst .Name}}/{{lowerFirst .Name}}.js",
+				Body: "import { LightningElement } from 'lwc';\n\nexport default class {{upperFirst .Name}} extends LightningElement {\n}\n"},
+			{Path: "lwc/{{lowerFirst .Name}}/{{lowerFirst .Name}}.html", Body: "<template>\n\n</template>\n"},
+			{Path: "lwc/{{lowerFirst .Name}}/{{lowerFirst .Name}}.js-meta.xml", Body: `<?xml version="1.0" encoding="UTF-8"?>
+<LightningComponentBundle xmlns="http://soap.sforce.com/2006/04/metadata">
+    <apiVersion>{{.ApiVersion}}</apiVersion>
+    <isExposed>false</isExposed>
+</LightningComponentBundle>
+`},
+		},
+	},
+}
+
+func init() {
+	for i := range builtinTemplates {
+		builtinTemplates[i].Source = "built-in"
+	}
+}
+
+// Load the templates in each of dirs, followed by the built-in templates.
+// Templates are matched by name without regard to case; those found earlier
+// take precedence. Directories and templates that can't be read are skipped
+// and described in problems.
+func LoadTemplates(dirs []string) (templates []Template, problems []string) {
+	seen := make(map[string]bool)
+	add := func(t Template) {
+		if !seen[strings.ToLower(t.Name)] {
+			seen[strings.ToLower(t.Name)] = true
+			templates = append(templates, t)
+		}
+	}
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			problems = append(problems, fmt.Sprintf("Could not read templates in %s: %s", dir, err.Error()))
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			t, err := loadTemplate(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Skipping template %s: %s", entry.Name(), err.Error()))
+				continue
+			}
+			add(t)
+		}
+	}
+	for _, t := range builtinTemplates {
+		add(t)
+	}
+	return
+}
+
+func loadTemplate(dir string) (t Template, err error) {
+	t.Name = filepath.Base(dir)
+	t.Source = dir
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		t.Files = append(t.Files, TemplateFile{Path: filepath.ToSlash(rel), Body: string(body)})
+		return nil
+	})
+	if err == nil && len(t.Files) == 0 {
+		err = fmt.Errorf("Template %s has no files", dir)
+	}
+	return
+}
+
+func FindTemplate(templates []Template, name string) (t Template, found bool) {
+	for _, t = range templates {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// Render the template's file paths and bodies. The returned paths are
+// relative to the source directory.
+func (t Template) Render(vars TemplateVars) (files map[string]string, err error) {
+	files = make(map[string]string)
+	for _, file := range t.Files {
+		var path, body string
+		if path, err = renderTemplate(t.Name, file.Path, vars); err != nil {
+			return
+		}
+		if body, err = renderTemplate(t.Name, file.Body, vars); err != nil {
+			return
+		}
+		files[filepath.FromSlash(path)] = body
+	}
+	return
+}
+
+func renderTemplate(name string, text string, vars TemplateVars) (result string, err error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return
+	}
+	var out bytes.Buffer
+	if err = tmpl.Execute(&out, vars); err != nil {
+		return
+	}
+	result = out.String()
+	return
+}
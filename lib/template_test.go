@@ -0,0 +1,82 @@
+package lib_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Template", func() {
+	var (
+		projectDir string
+		userDir    string
+	)
+
+	BeforeEach(func() {
+		projectDir, _ = ioutil.TempDir("", "template-test")
+		userDir, _ = ioutil.TempDir("", "template-test")
+		os.MkdirAll(filepath.Join(projectDir, "ClassWithTest", "classes"), 0755)
+		ioutil.WriteFile(filepath.Join(projectDir, "ClassWithTest", "classes", "{{.Name}}.cls"), []byte("// {{.Author}}\npublic class {{.Name}} {}"), 0644)
+		ioutil.WriteFile(filepath.Join(projectDir, "ClassWithTest", "classes", "{{.Name}}Test.cls"), []byte("@IsTest class {{.Name}}Test {}"), 0644)
+		os.MkdirAll(filepath.Join(userDir, "ApexClass", "classes"), 0755)
+		ioutil.WriteFile(filepath.Join(userDir, "ApexClass", "classes", "{{.Name}}.cls"), []byte("global class {{.Name}} {}"), 0644)
+		os.MkdirAll(filepath.Join(userDir, "classwithtest"), 0755)
+		ioutil.WriteFile(filepath.Join(userDir, "classwithtest", "ignored.cls"), []byte(""), 0644)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(projectDir)
+		os.RemoveAll(userDir)
+	})
+
+	Describe("LoadTemplates", func() {
+		It("should prefer earlier directories over later ones and built-ins", func() {
+			templates, problems := LoadTemplates([]string{projectDir, userDir})
+			Expect(problems).To(BeEmpty())
+			t, found := FindTemplate(templates, "classwithtest")
+			Expect(found).To(BeTrue())
+			Expect(t.Source).To(Equal(filepath.Join(projectDir, "ClassWithTest")))
+			t, _ = FindTemplate(templates, "ApexClass")
+			Expect(t.Source).To(Equal(filepath.Join(userDir, "ApexClass")))
+			Expect(t.ToolingType).To(BeEmpty())
+		})
+		It("should skip templates that can't be loaded", func() {
+			os.MkdirAll(filepath.Join(userDir, "Empty"), 0755)
+			templates, problems := LoadTemplates([]string{projectDir, userDir})
+			Expect(problems).To(Equal([]string{"Skipping template Empty: Template " + filepath.Join(userDir, "Empty") + " has no files"}))
+			_, found := FindTemplate(templates, "ClassWithTest")
+			Expect(found).To(BeTrue())
+			_, found = FindTemplate(templates, "Empty")
+			Expect(found).To(BeFalse())
+		})
+		It("should include built-in templates", func() {
+			templates, _ := LoadTemplates([]string{filepath.Join(projectDir, "missing")})
+			t, found := FindTemplate(templates, "ApexTrigger")
+			Expect(found).To(BeTrue())
+			Expect(t.Source).To(Equal("built-in"))
+		})
+	})
+
+	Describe("Render", func() {
+		It("should render file names and contents", func() {
+			templates, _ := LoadTemplates([]string{projectDir})
+			t, _ := FindTemplate(templates, "ClassWithTest")
+			files, err := t.Render(TemplateVars{Name: "AccountService", Author: "Pat"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(HaveKeyWithValue(filepath.Join("classes", "AccountService.cls"), "// Pat\npublic class AccountService {}"))
+			Expect(files).To(HaveKey(filepath.Join("classes", "AccountServiceTest.cls")))
+		})
+		It("should name lightning web components in camel case", func() {
+			templates, _ := LoadTemplates(nil)
+			t, _ := FindTemplate(templates, "lwc")
+			files, _ := t.Render(TemplateVars{Name: "MyCmp", ApiVersion: "45.0"})
+			Expect(files[filepath.Join("lwc", "myCmp", "myCmp.js")]).To(ContainSubstring("export default class MyCmp extends LightningElement"))
+			Expect(files[filepath.Join("lwc", "myCmp", "myCmp.js-meta.xml")]).To(ContainSubstring("<apiVersion>45.0</apiVersion>"))
+		})
+	})
+})
@@ -1,6 +1,13 @@
 package lib_test
 
 import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
 	. "github.com/ForceCLI/force/lib"
 
 	. "github.com/onsi/ginkgo"
@@ -37,4 +44,106 @@ var _ = Describe("Test", func() {
 			Expect(err).To(HaveOccurred())
 		})
 	})
+
+	Describe("NewAsyncTestRequest", func() {
+		It("should run local tests for all", func() {
+			request, err := NewAsyncTestRequest([]string{"all"}, nil, -1, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(request.TestLevel).To(Equal("RunLocalTests"))
+		})
+		It("should join class names", func() {
+			request, _ := NewAsyncTestRequest([]string{"MyClass", "MyOtherClass"}, nil, -1, false)
+			Expect(request.ClassNames).To(Equal("MyClass,MyOtherClass"))
+			Expect(request.Tests).To(BeEmpty())
+		})
+		It("should support methods from multiple classes", func() {
+			request, err := NewAsyncTestRequest([]string{"MyClass.method1", "MyOtherClass.method2", "MyClass.method3"}, nil, -1, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(request.Tests).To(Equal([]AsyncTestItem{
+				{ClassName: "MyClass", TestMethods: []string{"method1", "method3"}},
+				{ClassName: "MyOtherClass", TestMethods: []string{"method2"}},
+			}))
+		})
+		It("should support suites without tests", func() {
+			request, err := NewAsyncTestRequest(nil, []string{"Smoke", "Regression"}, 5, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(request.SuiteNames).To(Equal("Smoke,Regression"))
+			Expect(request.MaxFailedTests).To(Equal(5))
+			Expect(request.SkipCodeCoverage).To(BeTrue())
+		})
+		It("should fail if methods are combined with suites", func() {
+			_, err := NewAsyncTestRequest([]string{"MyClass.method1"}, []string{"Smoke"}, -1, false)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("AsyncTestRunner", func() {
+		var (
+			server    *httptest.Server
+			jobStatus string
+		)
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query().Get("q")
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/runTestsAsynchronous"):
+					fmt.Fprint(w, `"707000000000001"`)
+				case strings.Contains(query, "FROM ApexTestQueueItem"):
+					fmt.Fprint(w, `{"done": true, "totalSize": 0, "records": []}`)
+				case strings.Contains(query, "FROM AsyncApexJob"):
+					fmt.Fprintf(w, `{"done": true, "totalSize": 1, "records": [{"Status": "%s", "ExtendedStatus": "No tests"}]}`, jobStatus)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		newRunner := func() *AsyncTestRunner {
+			runner := NewAsyncTestRunner(NewForce(&ForceSession{InstanceUrl: server.URL}))
+			runner.PollInterval = time.Millisecond
+			runner.SkipCodeCoverage = true
+			return runner
+		}
+
+		It("should finish when the job completes without queue items", func() {
+			jobStatus = "Completed"
+			output, err := newRunner().RunTests([]string{"MyClass"}, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output.NumberRun).To(Equal(0))
+		})
+
+		It("should fail when the job fails without queue items", func() {
+			jobStatus = "Failed"
+			_, err := newRunner().RunTests([]string{"MyClass"}, "")
+			Expect(err).To(MatchError(ContainSubstring("No tests")))
+		})
+
+		It("should time out", func() {
+			jobStatus = "Processing"
+			runner := newRunner()
+			runner.Timeout = 20 * time.Millisecond
+			_, err := runner.RunTests([]string{"MyClass"}, "")
+			Expect(err).To(MatchError(ContainSubstring("Timed out")))
+		})
+	})
+})
+
+var _ = Describe("TestCoverage", func() {
+	It("should keep each coverage warning's name with its message", func() {
+		response := `<Envelope><Body><runTestsResponse><result>
+			<codeCoverageWarnings><message>Average test coverage across all Apex Classes and Triggers is 60%</message></codeCoverageWarnings>
+			<codeCoverageWarnings><name>MyClass</name><message>Test coverage of selected Apex Class is 0%</message></codeCoverageWarnings>
+		</result></runTestsResponse></Body></Envelope>`
+		var output TestCoverage
+		Expect(xml.Unmarshal([]byte(response), &output)).To(Succeed())
+		Expect(output.CoverageWarnings).To(Equal([]CodeCoverageWarning{
+			{Message: "Average test coverage across all Apex Classes and Triggers is 60%"},
+			{Name: "MyClass", Message: "Test coverage of selected Apex Class is 0%"},
+		}))
+	})
 })
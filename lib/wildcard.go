@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Expand "*" in the query into explicit members for the types where the
+// wildcard doesn't retrieve everything: standard objects aren't included
+// in CustomObject's wildcard, types in folders don't support it at all, so
+// it's replaced by their folders and members, and members installed from
+// managed packages are never included.
+func (f *Force) ExpandWildcards(query ForceMetadataQuery) (expanded ForceMetadataQuery, err error) {
+	var folders FolderedMetadata
+	var hasManagedPackages *bool
+	for _, element := range query {
+		for _, typeName := range element.Name {
+			if !containsMember(element.Members, "*") {
+				expanded = append(expanded, ForceMetadataQueryElement{Name: []string{typeName}, Members: element.Members})
+				continue
+			}
+			members := append([]string(nil), element.Members...)
+			if isInFolderType(typeName) {
+				if folders == nil {
+					if folders, err = f.GetAllFolders(); err != nil {
+						return nil, fmt.Errorf("Could not get folders: %s", err.Error())
+					}
+				}
+				folderKey := FolderType(typeName)
+				if folderKey == "EmailTemplate" {
+					folderKey = "Email"
+				}
+				inFolders, folderErr := f.GetMetadataInFolders(FolderType(typeName), folders[folderKey])
+				if folderErr != nil {
+					return nil, fmt.Errorf("Could not get metadata in folders: %s", folderErr.Error())
+				}
+				members = withoutMember(appendMembers(members, inFolders...), "*")
+			} else {
+				if typeName == "CustomObject" {
+					standardObjects, objectErr := f.standardObjectNames()
+					if objectErr != nil {
+						return nil, fmt.Errorf("Could not list standard objects: %s", objectErr.Error())
+					}
+					members = appendMembers(members, standardObjects...)
+				}
+				if hasManagedPackages == nil {
+					installed, listErr := f.Metadata.listMetadataProperties("InstalledPackage")
+					hasInstalled := listErr == nil && len(installed) > 0
+					hasManagedPackages = &hasInstalled
+				}
+				if *hasManagedPackages {
+					// Types that can't be listed keep the wildcard alone
+					managed, listErr := f.managedMemberNames(typeName)
+					if listErr != nil && Verbose {
+						fmt.Fprintf(os.Stderr, "Could not list managed %s: %s\n", typeName, listErr.Error())
+					}
+					members = appendMembers(members, managed...)
+				}
+			}
+			expanded = append(expanded, ForceMetadataQueryElement{Name: []string{typeName}, Members: members})
+		}
+	}
+	return
+}
+
+func containsMember(members []string, member string) bool {
+	for _, m := range members {
+		if m == member {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutMember(members []string, member string) (remaining []string) {
+	for _, m := range members {
+		if m != member {
+			remaining = append(remaining, m)
+		}
+	}
+	return
+}
+
+// Append the names that aren't already members.
+func appendMembers(members []string, names ...string) []string {
+	for _, name := range names {
+		if !containsMember(members, name) {
+			members = append(members, name)
+		}
+	}
+	return members
+}
+
+// Returns the names of the standard objects whose metadata can be
+// retrieved.
+func (f *Force) standardObjectNames() (names []string, err error) {
+	sobjects, err := f.ListSobjects()
+	if err != nil {
+		return
+	}
+	for _, sobject := range sobjects {
+		name := sobject["name"].(string)
+		if !sobject["custom"].(bool) && !strings.HasSuffix(name, "__Tag") && !strings.HasSuffix(name, "__History") && !strings.HasSuffix(name, "__Share") {
+			names = append(names, name)
+		}
+	}
+	names = append(names, "Activity")
+	return
+}
+
+// Returns the names of the members of a type installed from managed
+// packages.
+func (f *Force) managedMemberNames(typeName string) (names []string, err error) {
+	properties, err := f.Metadata.listMetadataProperties(typeName)
+	if err != nil {
+		return
+	}
+	for _, p := range properties {
+		if IsManagedMember(p) {
+			names = append(names, p.FullName)
+		}
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package lib_test
+
+import (
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExpandWildcards", func() {
+	var org *fakeOrg
+
+	BeforeEach(func() {
+		org = newFakeOrg()
+		org.sobjects = []ForceSobject{
+			{"name": "Account", "custom": false},
+			{"name": "Book__c", "custom": true},
+			{"name": "Book__Share", "custom": false},
+		}
+		org.records["Folder"] = []ForceRecord{
+			{"Id": "00l000000000001", "Type": "Report", "DeveloperName": "Sales"},
+		}
+		org.records["Report"] = []ForceRecord{
+			{"Id": "00O000000000001", "OwnerId": "00l000000000001", "DeveloperName": "Pipeline"},
+		}
+	})
+
+	AfterEach(func() {
+		org.Close()
+	})
+
+	It("should add standard objects to CustomObject", func() {
+		expanded, err := org.force().ExpandWildcards(ForceMetadataQuery{{Name: []string{"CustomObject"}, Members: []string{"*"}}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expanded).To(Equal(ForceMetadataQuery{
+			{Name: []string{"CustomObject"}, Members: []string{"*", "Account", "Activity"}},
+		}))
+	})
+
+	It("should replace the wildcard of types in folders with their folders and members", func() {
+		expanded, err := org.force().ExpandWildcards(ForceMetadataQuery{{Name: []string{"Report"}, Members: []string{"*"}}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expanded).To(Equal(ForceMetadataQuery{
+			{Name: []string{"Report"}, Members: []string{"Sales", "Sales/Pipeline"}},
+		}))
+	})
+
+	It("should add members installed from managed packages", func() {
+		org.members["InstalledPackage"] = []MDFileProperties{{FullName: "ns", Type: "InstalledPackage"}}
+		org.members["ApexClass"] = []MDFileProperties{
+			{FullName: "ns__Managed", Type: "ApexClass", ManageableState: "installed"},
+			{FullName: "Mine", Type: "ApexClass", ManageableState: "unmanaged"},
+		}
+		expanded, err := org.force().ExpandWildcards(ForceMetadataQuery{{Name: []string{"ApexClass"}, Members: []string{"*"}}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expanded).To(Equal(ForceMetadataQuery{
+			{Name: []string{"ApexClass"}, Members: []string{"*", "ns__Managed"}},
+		}))
+	})
+
+	It("should leave explicit members alone", func() {
+		query := ForceMetadataQuery{{Name: []string{"ApexClass"}, Members: []string{"Mine"}}}
+		expanded, err := org.force().ExpandWildcards(query)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expanded).To(Equal(query))
+	})
+})
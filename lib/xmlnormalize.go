@@ -0,0 +1,299 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A parsed XML element. Text holds the element's character data when it
+// has no child elements.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+var xmlTextEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&apos;",
+)
+
+// Normalize metadata XML so that documents that differ only in formatting
+// compare equal: whitespace between elements is replaced by four-space
+// indentation, attributes are sorted, and sibling elements are grouped by
+// name. Repeated elements with a key, such as fieldPermissions by field, are
+// sorted by it; other elements with the same name keep their relative order
+// since it's often significant, e.g. for picklist values.
+func NormalizeXml(data []byte) (normalized []byte, err error) {
+	root, err := parseXmlTree(data)
+	if err != nil {
+		return
+	}
+	var out bytes.Buffer
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	sortXmlNode(root)
+	sortKeyedXmlNodes(root)
+	writeXmlNode(&out, root, 0)
+	normalized = out.Bytes()
+	return
+}
+
+// Parse an XML document into a tree of elements. Documents with comments
+// or with elements holding both text and child elements, which the tree
+// can't represent, are rejected rather than losing their content.
+func parseXmlTree(data []byte) (root *xmlNode, err error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	var stack []*xmlNode
+	var text strings.Builder
+	for {
+		var token xml.Token
+		token, err = decoder.RawToken()
+		if err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: xmlName(t.Name), attrs: append([]xml.Attr(nil), t.Attr...)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				if strings.TrimSpace(text.String()) != "" {
+					return nil, fmt.Errorf("<%s> has mixed text and elements", parent.name)
+				}
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+			text.Reset()
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			node := stack[len(stack)-1]
+			if len(node.children) == 0 {
+				node.text = text.String()
+			} else if strings.TrimSpace(text.String()) != "" {
+				return nil, fmt.Errorf("<%s> has mixed text and elements", node.name)
+			}
+			stack = stack[:len(stack)-1]
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.Comment:
+			return nil, fmt.Errorf("comments are not supported")
+		}
+	}
+	if root == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+func sortXmlNode(node *xmlNode) {
+	sort.SliceStable(node.attrs, func(i, j int) bool {
+		return xmlName(node.attrs[i].Name) < xmlName(node.attrs[j].Name)
+	})
+	sort.SliceStable(node.children, func(i, j int) bool {
+		return node.children[i].name < node.children[j].name
+	})
+	for _, child := range node.children {
+		sortXmlNode(child)
+	}
+}
+
+func writeXmlNode(out *bytes.Buffer, node *xmlNode, depth int) {
+	indent := strings.Repeat("    ", depth)
+	out.WriteString(indent + "<" + node.name)
+	for _, attr := range node.attrs {
+		out.WriteString(" " + xmlName(attr.Name) + `="` + xmlTextEscaper.Replace(attr.Value) + `"`)
+	}
+	if len(node.children) == 0 {
+		if node.text == "" {
+			out.WriteString("/>\n")
+			return
+		}
+		out.WriteString(">" + xmlTextEscaper.Replace(node.text) + "</" + node.name + ">\n")
+		return
+	}
+	out.WriteString(">\n")
+	for _, child := range node.children {
+		writeXmlNode(out, child, depth+1)
+	}
+	out.WriteString(indent + "</" + node.name + ">\n")
+}
+
+// The child elements identifying repeated metadata elements, by element
+// name, used to sort them.
+var xmlSortKeys = map[string][]string{
+	"applicationVisibilities":    {"application"},
+	"businessProcesses":          {"fullName"},
+	"classAccesses":              {"apexClass"},
+	"compactLayouts":             {"fullName"},
+	"customMetadataTypeAccesses": {"name"},
+	"customPermissions":          {"name"},
+	"customSettingAccesses":      {"name"},
+	"externalDataSourceAccesses": {"externalDataSource"},
+	"fieldPermissions":           {"field"},
+	"fieldSets":                  {"fullName"},
+	"fields":                     {"fullName"},
+	"flowAccesses":               {"flow"},
+	"layoutAssignments":          {"layout", "recordType"},
+	"listViews":                  {"fullName"},
+	"objectPermissions":          {"object"},
+	"pageAccesses":               {"apexPage"},
+	"recordTypeVisibilities":     {"recordType"},
+	"recordTypes":                {"fullName"},
+	"tabSettings":                {"tab"},
+	"tabVisibilities":            {"tab"},
+	"userPermissions":            {"name"},
+	"validationRules":            {"fullName"},
+	"webLinks":                   {"fullName"},
+}
+
+// Returns metadata XML in a canonical form for storing, so that retrieves
+// of the same metadata produce the same file: repeated elements with a key,
+// such as fieldPermissions by field, are sorted by it, elements are
+// indented by four spaces and lines end in \n. Unlike NormalizeXml, elements
+// with different names keep their order, which the Metadata API requires.
+func CanonicalizeXml(data []byte) (canonical []byte, err error) {
+	root, err := parseXmlTree(data)
+	if err != nil {
+		return
+	}
+	var out bytes.Buffer
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	sortKeyedXmlNodes(root)
+	writeXmlNode(&out, root, 0)
+	canonical = out.Bytes()
+	return
+}
+
+// Sort each run of repeated elements with a key by their key.
+func sortKeyedXmlNodes(node *xmlNode) {
+	children := node.children
+	for start := 0; start < len(children); {
+		end := start + 1
+		for end < len(children) && children[end].name == children[start].name {
+			end++
+		}
+		if keys, found := xmlSortKeys[children[start].name]; found && end-start > 1 {
+			run := children[start:end]
+			if hasXmlKeys(run, keys[0]) {
+				sort.SliceStable(run, func(i, j int) bool {
+					for _, key := range keys {
+						a, b := xmlChildText(run[i], key), xmlChildText(run[j], key)
+						if a != b {
+							return a < b
+						}
+					}
+					return false
+				})
+			}
+		}
+		start = end
+	}
+	for _, child := range children {
+		sortKeyedXmlNodes(child)
+	}
+}
+
+// Whether every node has a child element named key.
+func hasXmlKeys(nodes []*xmlNode, key string) bool {
+	for _, node := range nodes {
+		found := false
+		for _, child := range node.children {
+			if child.name == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func xmlChildText(node *xmlNode, name string) string {
+	for _, child := range node.children {
+		if child.name == name {
+			return child.text
+		}
+	}
+	return ""
+}
+
+// Whether a file is metadata XML that can be canonicalized, as opposed to
+// the content of a member with a -meta.xml file, such as a class or a
+// static resource, or of a bundle, such as an .svg file of a Lightning
+// component, which are left alone even if they're XML. hasMetaFile tells
+// whether the file has a -meta.xml file alongside it.
+func IsMetadataXml(name string, data []byte, hasMetaFile bool) bool {
+	if hasMetaFile || !isMetadataXmlName(name) {
+		return false
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("<?xml"))
+}
+
+// Whether the file is package.xml, a -meta.xml file, or in the directory of
+// a metadata type that isn't a bundle, with the type's suffix if it's known.
+func isMetadataXmlName(name string) bool {
+	if filepath.Base(name) == "package.xml" {
+		return true
+	}
+	if _, _, _, ok := decomposedObjectMember(name); ok {
+		return true
+	}
+	isMetaFile := strings.HasSuffix(name, "-meta.xml")
+	name = filepath.FromSlash(strings.TrimSuffix(name, "-meta.xml"))
+	parentDir := filepath.Dir(name)
+	parentName := filepath.Base(parentDir)
+	grandparentName := filepath.Base(filepath.Dir(parentDir))
+	for _, mp := range knownMetapaths() {
+		if mp.path != parentName && !(mp.hasFolder && mp.path == grandparentName) {
+			continue
+		}
+		if mp.onlyFolder {
+			return false
+		}
+		return isMetaFile || mp.extension == "" || mp.extension == filepath.Ext(name)
+	}
+	return false
+}
+
+// Canonicalize the metadata XML files among files in place.
+func CanonicalizeMetadataFiles(files ForceMetadataFiles) (err error) {
+	for name, data := range files {
+		_, hasMetaFile := files[name+"-meta.xml"]
+		if !IsMetadataXml(name, data, hasMetaFile) {
+			continue
+		}
+		canonical, canonicalizeErr := CanonicalizeXml(data)
+		if canonicalizeErr != nil {
+			return fmt.Errorf("Could not normalize %s: %s", name, canonicalizeErr.Error())
+		}
+		files[name] = canonical
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package lib_test
+
+import (
+	. "github.com/ForceCLI/force/lib"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CanonicalizeXml", func() {
+	It("should sort repeated elements by their key and keep the order of the rest", func() {
+		canonical, err := CanonicalizeXml([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n" +
+			"<Profile xmlns=\"http://soap.sforce.com/2006/04/metadata\">\r\n" +
+			"\t<fieldPermissions><editable>true</editable><field>Book__c.Title__c</field><readable>true</readable></fieldPermissions>\r\n" +
+			"\t<fieldPermissions><editable>false</editable><field>Book__c.Author__c</field><readable>true</readable></fieldPermissions>\r\n" +
+			"\t<custom>true</custom>\r\n" +
+			"\t<layoutAssignments><layout>Book__c-Book Layout</layout><recordType>Book__c.Novel</recordType></layoutAssignments>\r\n" +
+			"\t<layoutAssignments><layout>Book__c-Book Layout</layout></layoutAssignments>\r\n" +
+			"\t<layoutAssignments><layout>Account-Account Layout</layout></layoutAssignments>\r\n" +
+			"\t<loginIpRanges><startAddress>10.0.0.2</startAddress></loginIpRanges>\r\n" +
+			"\t<loginIpRanges><startAddress>10.0.0.1</startAddress></loginIpRanges>\r\n" +
+			"</Profile>\r\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(canonical)).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<Profile xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fieldPermissions>
+        <editable>false</editable>
+        <field>Book__c.Author__c</field>
+        <readable>true</readable>
+    </fieldPermissions>
+    <fieldPermissions>
+        <editable>true</editable>
+        <field>Book__c.Title__c</field>
+        <readable>true</readable>
+    </fieldPermissions>
+    <custom>true</custom>
+    <layoutAssignments>
+        <layout>Account-Account Layout</layout>
+    </layoutAssignments>
+    <layoutAssignments>
+        <layout>Book__c-Book Layout</layout>
+    </layoutAssignments>
+    <layoutAssignments>
+        <layout>Book__c-Book Layout</layout>
+        <recordType>Book__c.Novel</recordType>
+    </layoutAssignments>
+    <loginIpRanges>
+        <startAddress>10.0.0.2</startAddress>
+    </loginIpRanges>
+    <loginIpRanges>
+        <startAddress>10.0.0.1</startAddress>
+    </loginIpRanges>
+</Profile>
+`))
+	})
+
+	It("should leave repeated elements without a key in order", func() {
+		canonical, err := CanonicalizeXml([]byte(`<CompactLayout><fields>Name</fields><fields>Author__c</fields></CompactLayout>`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(canonical)).To(ContainSubstring("<fields>Name</fields>\n    <fields>Author__c</fields>"))
+	})
+
+	It("should be idempotent", func() {
+		canonical, err := CanonicalizeXml([]byte(`<Profile><objectPermissions><object>B</object></objectPermissions><objectPermissions><object>A</object></objectPermissions></Profile>`))
+		Expect(err).ToNot(HaveOccurred())
+		again, err := CanonicalizeXml(canonical)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).To(Equal(canonical))
+	})
+
+	It("should fail on mixed text and elements rather than drop the text", func() {
+		_, err := CanonicalizeXml([]byte(`<svg><text>Hello <tspan>world</tspan></text></svg>`))
+		Expect(err).To(MatchError("<text> has mixed text and elements"))
+		_, err = CanonicalizeXml([]byte(`<svg><text><tspan>Hello</tspan> world</text></svg>`))
+		Expect(err).To(MatchError("<text> has mixed text and elements"))
+	})
+
+	It("should fail on comments rather than drop them", func() {
+		_, err := CanonicalizeXml([]byte(`<Profile><!-- keep --><custom>false</custom></Profile>`))
+		Expect(err).To(MatchError("comments are not supported"))
+	})
+})
+
+var _ = Describe("CanonicalizeMetadataFiles", func() {
+	It("should canonicalize metadata XML but not the content of members with -meta.xml files", func() {
+		files := ForceMetadataFiles{
+			"profiles/Admin.profile":                   []byte("<?xml version=\"1.0\"?>\n<Profile>\n  <custom>false</custom>\n</Profile>"),
+			"staticresources/Config.resource":          []byte("<?xml version=\"1.0\"?>\n<config>\n  <a/>\n</config>"),
+			"staticresources/Config.resource-meta.xml": []byte("<?xml version=\"1.0\"?>\n<StaticResource>\n  <contentType>text/xml</contentType>\n</StaticResource>"),
+			"classes/Book.cls":                         []byte("public class Book {}"),
+		}
+		Expect(CanonicalizeMetadataFiles(files)).To(Succeed())
+		Expect(string(files["profiles/Admin.profile"])).To(Equal("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Profile>\n    <custom>false</custom>\n</Profile>\n"))
+		Expect(string(files["staticresources/Config.resource"])).To(Equal("<?xml version=\"1.0\"?>\n<config>\n  <a/>\n</config>"))
+		Expect(string(files["staticresources/Config.resource-meta.xml"])).To(ContainSubstring("\n    <contentType>text/xml</contentType>\n"))
+		Expect(string(files["classes/Book.cls"])).To(Equal("public class Book {}"))
+	})
+
+	It("should leave the files of bundles and unknown types alone", func() {
+		svg := "<?xml version=\"1.0\"?>\n<svg><text>Hello <tspan>world</tspan></text></svg>"
+		files := ForceMetadataFiles{
+			"aura/Header/Header.svg": []byte(svg),
+			"lwc/card/card.svg":      []byte(svg),
+			"notes/readme.xml":       []byte(svg),
+		}
+		Expect(CanonicalizeMetadataFiles(files)).To(Succeed())
+		for name := range files {
+			Expect(string(files[name])).To(Equal(svg))
+		}
+	})
+})
+
+var _ = Describe("IsMetadataXml", func() {
+	xml := []byte("<?xml version=\"1.0\"?>\n<Package/>")
+
+	It("should accept package.xml, -meta.xml files and known suffixes", func() {
+		Expect(IsMetadataXml("package.xml", xml, false)).To(BeTrue())
+		Expect(IsMetadataXml("src/classes/Book.cls-meta.xml", xml, false)).To(BeTrue())
+		Expect(IsMetadataXml("src/profiles/Admin.profile", xml, false)).To(BeTrue())
+		Expect(IsMetadataXml("src/objects/Book__c/fields/Title__c.field", xml, false)).To(BeTrue())
+	})
+
+	It("should reject the files of bundles", func() {
+		Expect(IsMetadataXml("src/aura/Header/Header.svg", xml, false)).To(BeFalse())
+		Expect(IsMetadataXml("src/lwc/card/icons/card.svg", xml, false)).To(BeFalse())
+	})
+})
@@ -22,6 +22,7 @@ func main() {
 			if err := cmd.Flag.Parse(args[1:]); err != nil {
 				os.Exit(2)
 			}
+			command.ApplyProjectConfig(cmd)
 			_, err := ActiveCredentials(false)
 			if err != nil {
 				ErrorAndExit(err.Error())